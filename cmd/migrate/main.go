@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/logging"
+	"strconv"
+)
+
+const usage = `Usage: migrate <command>
+
+Commands:
+  up [version]  Apply pending migrations, up to version (default: latest)
+  down [steps]  Roll back the latest applied migrations (default: 1)
+  status        List migrations and whether they are applied`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+	command, args := os.Args[1], os.Args[2:]
+
+	config := configs.LoadAppConfigs()
+	slog.SetDefault(logging.New(os.Stderr, config))
+
+	db, err := database.Open(config)
+	if err != nil {
+		logging.Fatal("Failed to open database", "error", err)
+	}
+
+	switch command {
+	case "up":
+		version, err := parseArg(args, 0)
+		if err != nil {
+			logging.Fatal("Invalid version", "error", err)
+		}
+		if err := database.MigrateUp(db, uint(version)); err != nil {
+			logging.Fatal("Migrate up failed", "error", err)
+		}
+	case "down":
+		steps, err := parseArg(args, 1)
+		if err != nil {
+			logging.Fatal("Invalid steps", "error", err)
+		}
+		if err := database.MigrateDown(db, steps); err != nil {
+			logging.Fatal("Migrate down failed", "error", err)
+		}
+	case "status":
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	statuses, err := database.GetMigrationStatus(db)
+	if err != nil {
+		logging.Fatal("Failed to get migration status", "error", err)
+	}
+	for _, status := range statuses {
+		state := "pending"
+		if status.Applied {
+			state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%4d  %-45s %s\n", status.Version, status.Name, state)
+	}
+}
+
+// Parse optional non-negative integer argument
+func parseArg(args []string, fallback int) (int, error) {
+	if len(args) == 0 {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(args[0])
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("expected a non-negative integer, got %q", args[0])
+	}
+	return value, nil
+}
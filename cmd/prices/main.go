@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/logging"
+	"portfolio-investment/prices"
+	"portfolio-investment/repositories"
+)
+
+const usage = `Usage: prices [-dry-run] <file>...
+
+Import asset closing prices from CSV or JSON files, by extension. CSV files have a header naming
+asset (name or ticker), date (YYYY-MM-DD), close and, optionally, currency columns; JSON files hold
+an array of {"asset", "date", "close", "currency"} objects. Prices already imported for an asset
+and day are replaced, so importing a file again changes nothing.
+
+Gaps (weekdays without a close), outliers (daily moves over 50%) and duplicate days are reported,
+but imported; each asset's series is checked on from its last imported price. Exits with status 1,
+importing nothing, if any file or quote is invalid.
+
+Flags:`
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "Read and check the files against the database without importing")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	config := configs.LoadAppConfigs()
+	slog.SetDefault(logging.New(os.Stderr, config))
+
+	var quotes []prices.Quote
+	for _, path := range flag.Args() {
+		read, err := prices.ReadFile(path)
+		if err != nil {
+			logging.Fatal("Failed to read prices", "error", err)
+		}
+		fmt.Printf("Read %d quotes from %s\n", len(read), path)
+		quotes = append(quotes, read...)
+	}
+
+	db, err := database.Open(config)
+	if err != nil {
+		logging.Fatal("Failed to open database", "error", err)
+	}
+	if err := database.CheckSchema(db); err != nil {
+		logging.Fatal("Database schema is not current", "error", err)
+	}
+	store := repositories.NewStore(db, config, nil)
+
+	ctx := context.Background()
+	issues, err := store.CheckAssetPrices(&ctx, quotes)
+	if err != nil {
+		logging.Fatal("Failed to check prices", "error", err)
+	}
+	for _, issue := range issues {
+		fmt.Printf("%-9s  %-20s  %s  %s\n", issue.Kind, issue.Asset, issue.Date.Format(prices.DateLayout), issue.Detail)
+	}
+	fmt.Printf("Found %d issues\n", len(issues))
+	if *dryRun {
+		return
+	}
+
+	saved, err := store.SaveAssetPrices(&ctx, quotes)
+	if err != nil {
+		logging.Fatal("Failed to import prices", "error", err)
+	}
+	fmt.Printf("Imported %d prices\n", saved)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/logging"
+	"portfolio-investment/repositories"
+)
+
+const usage = `Usage: reconcile [-user <reference ID>] [-repair]
+
+Recompute user portfolio funds and cash balances from deposit, withdrawal and cash entry history,
+and check each processed transaction's records sum to its amount. Exits with status 1 if any
+discrepancy is left unrepaired.
+
+Flags:`
+
+func main() {
+	userReferenceID := flag.String("user", "", "Only reconcile the user with this reference ID")
+	repair := flag.Bool("repair", false, "Set funds and balances that differ to the recomputed amounts")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	config := configs.LoadAppConfigs()
+	slog.SetDefault(logging.New(os.Stderr, config))
+
+	db, err := database.Open(config)
+	if err != nil {
+		logging.Fatal("Failed to open database", "error", err)
+	}
+	if err := database.CheckSchema(db); err != nil {
+		logging.Fatal("Database schema is not current", "error", err)
+	}
+
+	ctx := context.Background()
+	report, err := repositories.NewStore(db, config, nil).Reconcile(&ctx, *userReferenceID, *repair)
+	if err != nil {
+		logging.Fatal("Reconciliation failed", "error", err)
+	}
+
+	fmt.Printf("Checked %d user portfolios, %d user cash balances and %d transactions\n",
+		report.UserPortfolios, report.UserCash, report.Transactions)
+	unrepaired := 0
+	for _, discrepancy := range report.Discrepancies {
+		state := "unrepaired"
+		if discrepancy.Repaired {
+			state = "repaired"
+		} else {
+			unrepaired++
+		}
+		subject := discrepancy.PortfolioReferenceID + discrepancy.TransactionReferenceID
+		fmt.Printf("%-18s  %-20s  %-36s  recorded %12s  expected %12s  difference %12s  %s\n",
+			discrepancy.Kind, discrepancy.UserReferenceID, subject,
+			discrepancy.Recorded, discrepancy.Expected, discrepancy.Difference(), state)
+	}
+	if unrepaired > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/handlers"
+	"portfolio-investment/logging"
+	"portfolio-investment/metrics"
+	"portfolio-investment/repositories"
+	"portfolio-investment/services"
+	"portfolio-investment/tracing"
+	"syscall"
+)
+
+func main() {
+	config := configs.LoadAppConfigs()
+	slog.SetDefault(logging.New(os.Stderr, config))
+
+	// Set up tracing before anything is traced, DB queries included
+	shutdownTracing, err := tracing.Setup(context.Background(), config, "portfolio-server")
+	if err != nil {
+		logging.Fatal("Failed to set up tracing", "error", err)
+	}
+
+	// Establish DB connection (and run migrations/seeds) before accepting traffic
+	db, err := database.Connect(config)
+	if err != nil {
+		logging.Fatal("Failed to connect to database", "error", err)
+	}
+	store := repositories.NewStore(db, config, metrics.New())
+	service := services.NewService(store)
+
+	server := &http.Server{
+		Addr:    config.ServerAddress,
+		Handler: handlers.NewRouter(handlers.NewHandler(service, store)),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		slog.Info("Server listening", "address", config.ServerAddress)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Fatal("Server failed", "error", err)
+		}
+	}()
+
+	// Wait for interrupt signal, then drain in-flight requests
+	<-ctx.Done()
+	slog.Info("Shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ServerShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logging.Fatal("Server forced to shutdown", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+	slog.Info("Server stopped")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/logging"
+	"portfolio-investment/metrics"
+	"portfolio-investment/repositories"
+	"portfolio-investment/services"
+	"portfolio-investment/tracing"
+	"portfolio-investment/workers"
+	"syscall"
+)
+
+func main() {
+	config := configs.LoadAppConfigs()
+	slog.SetDefault(logging.New(os.Stderr, config))
+
+	// Set up tracing before anything is traced, DB queries included
+	shutdownTracing, err := tracing.Setup(context.Background(), config, "portfolio-worker")
+	if err != nil {
+		logging.Fatal("Failed to set up tracing", "error", err)
+	}
+
+	// Establish DB connection (and run migrations/seeds) before polling
+	db, err := database.Connect(config)
+	if err != nil {
+		logging.Fatal("Failed to connect to database", "error", err)
+	}
+	workerMetrics := metrics.New()
+	store := repositories.NewStore(db, config, workerMetrics)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The worker serves nothing else, so metrics get their own server when asked for
+	if config.WorkerMetricsAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", workerMetrics.Handler())
+		go func() {
+			slog.Info("Serving worker metrics", "address", config.WorkerMetricsAddress)
+			if err := http.ListenAndServe(config.WorkerMetricsAddress, mux); err != nil {
+				logging.Fatal("Worker metrics server failed", "error", err)
+			}
+		}()
+	}
+
+	if config.ReconcileInterval > 0 {
+		go workers.NewReconciliationJob(config, store).Run(ctx)
+	}
+
+	// Runs until interrupted; unfinished claims are picked up again once their lease expires
+	workers.NewDepositWorker(config, services.NewService(store), store).Run(ctx)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ServerShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+}
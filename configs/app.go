@@ -4,7 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"sync"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,6 +14,30 @@ func GetEnv(key string) string {
 	return os.Getenv(key)
 }
 
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := GetEnv(key)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid duration for environment variable %s: %s", key, value)
+	}
+	return duration
+}
+
+func GetEnvInt(key string, fallback int) int {
+	value := GetEnv(key)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid integer for environment variable %s: %s", key, value)
+	}
+	return number
+}
+
 func SetEnv(key, value string) {
 	err := os.Setenv(key, value)
 	if err != nil {
@@ -20,49 +45,104 @@ func SetEnv(key, value string) {
 	}
 }
 
-var (
-	once      sync.Once
-	appConfig *AppConfig
-)
+// Load app config from the environment (and .env file, if any)
+// Binaries load it once at startup and pass it down; tests build their own
+func LoadAppConfigs() *AppConfig {
+	var dsn string
+	var dbType DBType
 
-func GetAppConfigs() *AppConfig {
-	// Singleton App Config
-	// This function will be executed exactly once, even with concurrent calls.
-	once.Do(func() {
-		var dsn string
-		var dbType DBType
+	// Load environment variables from .env file if it exists
+	godotenv.Load()
 
-		// Load environment variables from .env file if it exists
-		godotenv.Load()
+	// Parse DSN
+	if dsn = GetEnv("DB_FILE_PATH"); dsn != "" {
+		dsn = fmt.Sprintf("file:%s%s%s?cache=shared&mode=rwc", os.TempDir(), string(os.PathSeparator), dsn)
+	} else {
+		dsn = GetEnv("DB_DSN")
+	}
 
-		// Parse DSN
-		if dsn = GetEnv("DB_FILE_PATH"); dsn != "" {
-			dsn = fmt.Sprintf("file:%s%s%s?cache=shared&mode=rwc", os.TempDir(), string(os.PathSeparator), dsn)
-		} else {
-			dsn = GetEnv("DB_DSN")
+	// Parse Database Type
+	if dbTypeStr := GetEnv("DB_TYPE"); dbTypeStr != "" {
+		switch dbTypeStr {
+		case "sqlite":
+			dbType = SQLite
+		case "mysql":
+			dbType = MySQL
+		case "postgres":
+			dbType = Postgres
+		default:
+			log.Fatalf("Unsupported database type: %s", dbTypeStr)
 		}
+	}
 
-		// Parse Database Type
-		if dbTypeStr := GetEnv("DB_TYPE"); dbTypeStr != "" {
-			switch dbTypeStr {
-			case "sqlite":
-				dbType = SQLite
-			case "mysql":
-				dbType = MySQL
-			case "postgres":
-				dbType = Postgres
-			default:
-				log.Fatalf("Unsupported database type: %s", dbTypeStr)
-			}
+	// Parse Log Format & Level
+	logFormat := DefaultLogFormat
+	if logFormatStr := GetEnv("LOG_FORMAT"); logFormatStr != "" {
+		switch LogFormat(logFormatStr) {
+		case LogFormatText, LogFormatJSON:
+			logFormat = LogFormat(logFormatStr)
+		default:
+			log.Fatalf("Unsupported log format: %s", logFormatStr)
+		}
+	}
+	logLevel := DefaultLogLevel
+	if logLevelStr := GetEnv("LOG_LEVEL"); logLevelStr != "" {
+		if err := logLevel.UnmarshalText([]byte(logLevelStr)); err != nil {
+			log.Fatalf("Unsupported log level: %s", logLevelStr)
 		}
+	}
 
-		appConfig = &AppConfig{
-			DatabaseDSN:         dsn,
-			DatabaseType:        dbType,
-			DatabaseDryrun:      GetEnv("DB_DRYRUN") == "true" || GetEnv("DB_DRYRUN") == "1",
-			DatabaseAutoMigrate: GetEnv("DB_AUTO_MIGRATE") == "true" || GetEnv("DB_AUTO_MIGRATE") == "1",
-			DatabaseAutoSeed:    GetEnv("DB_AUTO_SEED") == "true" || GetEnv("DB_AUTO_SEED") == "1",
+	// Parse Trace Exporter
+	traceExporter := DefaultTraceExporter
+	if traceExporterStr := GetEnv("TRACE_EXPORTER"); traceExporterStr != "" {
+		switch TraceExporter(traceExporterStr) {
+		case TraceExporterNone, TraceExporterStdout, TraceExporterFile, TraceExporterOTLP:
+			traceExporter = TraceExporter(traceExporterStr)
+		default:
+			log.Fatalf("Unsupported trace exporter: %s", traceExporterStr)
 		}
-	})
-	return appConfig
+	}
+	traceFile := GetEnv("TRACE_FILE")
+	if traceFile == "" {
+		traceFile = DefaultTraceFile
+	}
+
+	// Parse Server Address
+	serverAddress := GetEnv("SERVER_ADDR")
+	if serverAddress == "" {
+		serverAddress = DefaultServerAddress
+	}
+
+	return &AppConfig{
+		DatabaseDSN:             dsn,
+		DatabaseType:            dbType,
+		DatabaseDryrun:          GetEnv("DB_DRYRUN") == "true" || GetEnv("DB_DRYRUN") == "1",
+		DatabaseAutoMigrate:     GetEnv("DB_AUTO_MIGRATE") == "true" || GetEnv("DB_AUTO_MIGRATE") == "1",
+		DatabaseAutoSeed:        GetEnv("DB_AUTO_SEED") == "true" || GetEnv("DB_AUTO_SEED") == "1",
+		DatabaseMaxRetries:      GetEnvInt("DB_MAX_RETRIES", DefaultDatabaseMaxRetries),
+		DatabaseRetryBackoff:    GetEnvDuration("DB_RETRY_BACKOFF", DefaultDatabaseRetryBackoff),
+		DatabaseMaxOpenConns:    GetEnvInt("DB_MAX_OPEN_CONNS", DefaultDatabaseMaxOpenConns),
+		DatabaseMaxIdleConns:    GetEnvInt("DB_MAX_IDLE_CONNS", DefaultDatabaseMaxIdleConns),
+		DatabaseConnMaxLifetime: GetEnvDuration("DB_CONN_MAX_LIFETIME", DefaultDatabaseConnMaxLifetime),
+		DatabaseConnMaxIdleTime: GetEnvDuration("DB_CONN_MAX_IDLE_TIME", DefaultDatabaseConnMaxIdleTime),
+		DatabaseSlowQuery:       GetEnvDuration("DB_SLOW_QUERY", DefaultDatabaseSlowQuery),
+		LogFormat:               logFormat,
+		LogLevel:                logLevel,
+		TraceExporter:           traceExporter,
+		TraceFile:               traceFile,
+		ServerAddress:           serverAddress,
+		ServerShutdownTimeout:   GetEnvDuration("SERVER_SHUTDOWN_TIMEOUT", DefaultServerShutdownTimeout),
+		WorkerPollInterval:      GetEnvDuration("WORKER_POLL_INTERVAL", DefaultWorkerPollInterval),
+		WorkerLeaseDuration:     GetEnvDuration("WORKER_LEASE_DURATION", DefaultWorkerLeaseDuration),
+		WorkerPendingGrace:      GetEnvDuration("WORKER_PENDING_GRACE", DefaultWorkerPendingGrace),
+		WorkerBatchSize:         GetEnvInt("WORKER_BATCH_SIZE", DefaultWorkerBatchSize),
+		WorkerMaxAttempts:       GetEnvInt("WORKER_MAX_ATTEMPTS", DefaultWorkerMaxAttempts),
+		WorkerBackoffBase:       GetEnvDuration("WORKER_BACKOFF_BASE", DefaultWorkerBackoffBase),
+		WorkerBackoffMax:        GetEnvDuration("WORKER_BACKOFF_MAX", DefaultWorkerBackoffMax),
+		WorkerMetricsAddress:    GetEnv("WORKER_METRICS_ADDR"),
+		ReconcileInterval:       GetEnvDuration("RECONCILE_INTERVAL", DefaultReconcileInterval),
+		ReconcileRepair:         GetEnv("RECONCILE_REPAIR") == "true" || GetEnv("RECONCILE_REPAIR") == "1",
+		RebalanceTolerance:      GetEnvInt("REBALANCE_TOLERANCE_BPS", DefaultRebalanceTolerance),
+		RebalanceOnDeposit:      GetEnv("REBALANCE_ON_DEPOSIT") == "true" || GetEnv("REBALANCE_ON_DEPOSIT") == "1",
+	}
 }
@@ -1,5 +1,10 @@
 package configs
 
+import (
+	"log/slog"
+	"time"
+)
+
 type DBType string
 
 const (
@@ -9,13 +14,54 @@ const (
 )
 
 type AppConfig struct {
-	DatabaseType        DBType
-	DatabaseDSN         string
-	DatabaseDryrun      bool
-	DatabaseAutoMigrate bool
-	DatabaseAutoSeed    bool
+	DatabaseType            DBType
+	DatabaseDSN             string
+	DatabaseDryrun          bool
+	DatabaseAutoMigrate     bool
+	DatabaseAutoSeed        bool
+	DatabaseMaxRetries      int
+	DatabaseRetryBackoff    time.Duration
+	DatabaseMaxOpenConns    int
+	DatabaseMaxIdleConns    int
+	DatabaseConnMaxLifetime time.Duration
+	DatabaseConnMaxIdleTime time.Duration
+	DatabaseSlowQuery       time.Duration // Queries taking longer are logged as warnings
+	LogFormat               LogFormat
+	LogLevel                slog.Level
+	TraceExporter           TraceExporter
+	TraceFile               string // File spans are appended to, with the file exporter
+	ServerAddress           string
+	ServerShutdownTimeout   time.Duration
+	WorkerPollInterval      time.Duration
+	WorkerLeaseDuration     time.Duration
+	WorkerPendingGrace      time.Duration
+	WorkerBatchSize         int
+	WorkerMaxAttempts       int
+	WorkerBackoffBase       time.Duration
+	WorkerBackoffMax        time.Duration
+	WorkerMetricsAddress    string        // Serve worker metrics on this address; empty to not serve them
+	ReconcileInterval       time.Duration // Reconcile funds on this interval in the worker; 0 to not schedule it
+	ReconcileRepair         bool          // Repair discrepancies found by the scheduled reconciliation
+	RebalanceTolerance      int           // Drift from target weights, in basis points, tolerated before rebalancing
+	RebalanceOnDeposit      bool          // Direct deposits to underweight assets instead of splitting them by weight
 }
 
+type LogFormat string
+
+const (
+	LogFormatText LogFormat = "text"
+	LogFormatJSON LogFormat = "json"
+)
+
+type TraceExporter string
+
+const (
+	TraceExporterNone   TraceExporter = "none"
+	TraceExporterStdout TraceExporter = "stdout"
+	TraceExporterFile   TraceExporter = "file"
+	TraceExporterOTLP   TraceExporter = "otlp"
+)
+
 type PlanType string
 
 const (
@@ -23,13 +69,73 @@ const (
 	PlanTypeMonthly  PlanType = "monthly"
 )
 
+type AllocationStrategyType string
+
+const (
+	AllocationStrategyWaterfall    AllocationStrategyType = "waterfall"
+	AllocationStrategyProRata      AllocationStrategyType = "pro-rata"
+	AllocationStrategyPriority     AllocationStrategyType = "priority"
+	AllocationStrategyTargetWeight AllocationStrategyType = "target-weight"
+)
+
 type TransactionType string
 
 const (
 	TrxnTypeDeposit    TransactionType = "deposit"
 	TrxnTypeWithdrawal TransactionType = "withdrawal"
+	TrxnTypeCashSweep  TransactionType = "cash-sweep"
+)
+
+type TransactionStatus string
+
+const (
+	TrxnStatusPending            TransactionStatus = "pending"
+	TrxnStatusProcessing         TransactionStatus = "processing"
+	TrxnStatusCompleted          TransactionStatus = "completed"
+	TrxnStatusPartiallyAllocated TransactionStatus = "partially-allocated"
+	TrxnStatusFailed             TransactionStatus = "failed"
+	TrxnStatusReversed           TransactionStatus = "reversed"
+	TrxnStatusDeadLetter         TransactionStatus = "dead-letter"
 )
 
+const (
+	DefaultDatabaseMaxRetries      int           = 5
+	DefaultDatabaseRetryBackoff    time.Duration = 10 * time.Millisecond
+	DefaultDatabaseMaxOpenConns    int           = 25
+	DefaultDatabaseMaxIdleConns    int           = 5
+	DefaultDatabaseConnMaxLifetime time.Duration = 30 * time.Minute
+	DefaultDatabaseConnMaxIdleTime time.Duration = 5 * time.Minute
+	DefaultDatabaseSlowQuery       time.Duration = 200 * time.Millisecond
+)
+
+const (
+	DefaultLogFormat LogFormat  = LogFormatText
+	DefaultLogLevel  slog.Level = slog.LevelInfo
+)
+
+const (
+	DefaultTraceExporter TraceExporter = TraceExporterNone
+	DefaultTraceFile     string        = "traces.json"
+)
+
+const (
+	DefaultServerAddress         string        = ":8080"
+	DefaultServerShutdownTimeout time.Duration = 10 * time.Second
+)
+
+const (
+	DefaultWorkerPollInterval  time.Duration = 5 * time.Second
+	DefaultWorkerLeaseDuration time.Duration = 1 * time.Minute
+	DefaultWorkerPendingGrace  time.Duration = 1 * time.Minute
+	DefaultWorkerBatchSize     int           = 50
+	DefaultWorkerMaxAttempts   int           = 5
+	DefaultWorkerBackoffBase   time.Duration = 30 * time.Second
+	DefaultWorkerBackoffMax    time.Duration = 1 * time.Hour
+	DefaultReconcileInterval   time.Duration = 1 * time.Hour
+)
+
+const DefaultRebalanceTolerance int = 500
+
 const (
 	DefaultPortfolioRetirement string = "portfolio-retirement"
 	DefaultPortfolioHighRisk   string = "portfolio-high-risk"
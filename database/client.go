@@ -3,86 +3,86 @@ package database
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"portfolio-investment/configs"
-	"sync"
+	"time"
 
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
 )
 
-var (
-	once       sync.Once
-	dbInstance *gorm.DB
-)
-
-func Migrate(db *gorm.DB) {
-	db.AutoMigrate(
-		&Asset{},
-		&Portfolio{},
-		&User{},
-		&UserPortfolio{},
-		&UserDepositPlan{},
-		&Transaction{},
-		&Deposit{},
-	)
+// Current time in UTC, as every timestamp is stored and compared
+// Times written or queried against timestamp columns must be in UTC too: SQLite compares them as text
+func Now() time.Time {
+	return time.Now().UTC()
 }
 
 func Seed(db *gorm.DB) {
+	// Persistent databases are only seeded once
+	var count int64
+	if err := db.Model(&Portfolio{}).Count(&count).Error; err != nil {
+		panic("Failed to check seeded portfolios: " + err.Error())
+	}
+	if count > 0 {
+		return
+	}
+
 	// Seed Portfolios
 	portfolios := SeedPortfolios(db)
 	// Seed User
 	SeedUser(db, "user-123", portfolios)
 }
 
-func Connect() *gorm.DB {
-	// Singleton DB Connection
-	// This function will be executed exactly once, even with concurrent calls.
-	once.Do(func() {
-		config := configs.GetAppConfigs()
-		switch config.DatabaseType {
-		case configs.SQLite:
-			db, err := gorm.Open(sqlite.Open(config.DatabaseDSN), &gorm.Config{
-				DryRun: config.DatabaseDryrun,
-			})
-			if err != nil {
-				panic(fmt.Errorf("failed to connect to database: %w", err))
-			}
-			db.Exec("PRAGMA foreign_keys = ON")    // Enable foreign key support for SQLite
-			db.Exec("PRAGMA journal_mode = WAL")   // Enable Write-Ahead Logging for better concurrency
-			db.Exec("PRAGMA synchronous = NORMAL") // Set synchronous mode to NORMAL for better performance
-			db.Exec("PRAGMA cache_size = 10000")   // Set cache size for better performance
-			dbInstance = db
-		case configs.MySQL:
-			// MySQL connection logic here
-			panic("MySQL connection not implemented")
-		case configs.Postgres:
-			// Postgres connection logic here
-			panic("Postgres connection not implemented")
-		default:
-			panic(fmt.Sprintf("Unsupported database type: %s", config.DatabaseType))
-		}
-
-		// Auto Migrate DB Schemas
-		if config.DatabaseAutoMigrate {
-			Migrate(dbInstance)
-		}
-
-		// Auto Seed
-		if config.DatabaseAutoSeed {
-			ctx := context.Background()
-			Seed(dbInstance.WithContext(ctx))
-		}
+// Open a database connection for the configured dialect, without migrating or seeding
+// Queries are logged to the default slog logger, and traced with the global tracer provider
+func Open(config *configs.AppConfig) (*gorm.DB, error) {
+	dialect, err := GetDialect(config.DatabaseType)
+	if err != nil {
+		return nil, err
+	}
+	dialector, err := dialect.Open(config.DatabaseDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
+		DryRun:  config.DatabaseDryrun,
+		NowFunc: Now,
+		Logger:  NewGormLogger(slog.Default(), config.DatabaseSlowQuery),
 	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := dialect.Setup(db, config); err != nil {
+		return nil, fmt.Errorf("failed to set up %s database: %w", config.DatabaseType, err)
+	}
 
-	return dbInstance
+	// Queries are traced under the span of the context they run with, without their parameters
+	if err := db.Use(gormtracing.NewPlugin(gormtracing.WithoutMetrics(), gormtracing.WithoutQueryVariables())); err != nil {
+		return nil, fmt.Errorf("failed to set up query tracing: %w", err)
+	}
+	return db, nil
 }
 
-func WithContext(ctx *context.Context) *gorm.DB {
-	db := Connect()
-	return db.WithContext(*ctx)
-}
+// Open a database connection, then migrate (or check the schema is current) and seed as configured
+func Connect(config *configs.AppConfig) (*gorm.DB, error) {
+	db, err := Open(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Auto Migrate DB Schemas, otherwise refuse to run against an outdated schema
+	if config.DatabaseAutoMigrate {
+		if err := Migrate(db); err != nil {
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+	} else if err := CheckSchema(db); err != nil {
+		return nil, err
+	}
 
-func WithTransaction(ctx *context.Context, handler func(tx *gorm.DB) error) error {
-	db := Connect()
-	return db.WithContext(*ctx).Transaction(handler)
+	// Auto Seed
+	if config.DatabaseAutoSeed {
+		ctx := context.Background()
+		Seed(db.WithContext(ctx))
+	}
+	return db, nil
 }
@@ -0,0 +1,88 @@
+// Fresh, isolated databases for tests
+package dbtest
+
+import (
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PUBLIC: Open a migrated and seeded database private to the test, and the config it was opened with
+// Uses an in-memory SQLite database, unless DB_TYPE selects a database server: then a database is created
+// on the server at DB_DSN_PREFIX (the DSN up to the database name) and dropped when the test ends
+func New(t testing.TB) (*gorm.DB, *configs.AppConfig) {
+	t.Helper()
+
+	config := configs.LoadAppConfigs()
+	config.DatabaseDryrun = false
+	config.DatabaseAutoMigrate = true
+	config.DatabaseAutoSeed = true
+
+	// Unique across test processes sharing a database server
+	name := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:16]
+	switch config.DatabaseType {
+	case "", configs.SQLite:
+		config.DatabaseType = configs.SQLite
+		config.DatabaseDSN = "file:" + name + "?mode=memory&cache=shared"
+	default:
+		config.DatabaseDSN = createDatabase(t, config, name)
+	}
+
+	db, err := database.Connect(config)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	closeOnCleanup(t, db)
+	return db, config
+}
+
+// PRIVATE: Create a database on the configured server, dropped once every connection to it is closed
+func createDatabase(t testing.TB, config *configs.AppConfig, name string) string {
+	t.Helper()
+
+	prefix := configs.GetEnv("DB_DSN_PREFIX")
+	if prefix == "" {
+		t.Fatalf("DB_DSN_PREFIX is required to create %s test databases", config.DatabaseType)
+	}
+	server := *config
+	server.DatabaseDSN = prefix
+	if config.DatabaseType == configs.Postgres {
+		server.DatabaseDSN += "postgres" // Postgres always connects to some database
+	}
+	db, err := database.Open(&server)
+	if err != nil {
+		t.Fatalf("Failed to connect to database server: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get connection pool: %v", err)
+	}
+
+	// Cleanups run last-in first-out, so this runs after the test database is closed
+	t.Cleanup(func() {
+		if err := db.Exec("DROP DATABASE " + name).Error; err != nil {
+			t.Errorf("Failed to drop test database %s: %v", name, err)
+		}
+		sqlDB.Close()
+	})
+
+	if err := db.Exec("CREATE DATABASE " + name).Error; err != nil {
+		t.Fatalf("Failed to create test database %s: %v", name, err)
+	}
+	return prefix + name
+}
+
+// PRIVATE: Close the connection pool when the test ends
+func closeOnCleanup(t testing.TB, db *gorm.DB) {
+	t.Helper()
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get connection pool: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+}
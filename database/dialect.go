@@ -0,0 +1,161 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"portfolio-investment/configs"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Database specific connection, setup and error handling
+type Dialect interface {
+	// Build gorm dialector for the DSN
+	Open(dsn string) (gorm.Dialector, error)
+	// Apply connection pool limits and session settings after connecting
+	Setup(db *gorm.DB, config *configs.AppConfig) error
+	// Check if an error is transient (lock contention, serialization failure or deadlock)
+	IsRetryable(err error) bool
+	// Check if an error is a unique constraint violation
+	IsDuplicate(err error) bool
+}
+
+var dialects = map[configs.DBType]Dialect{
+	configs.SQLite:   SQLiteDialect{},
+	configs.Postgres: PostgresDialect{},
+	configs.MySQL:    MySQLDialect{},
+}
+
+// Get dialect for database type
+func GetDialect(dbType configs.DBType) (Dialect, error) {
+	dialect, exists := dialects[dbType]
+	if !exists {
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+	return dialect, nil
+}
+
+// PRIVATE: Apply connection pool settings from config
+func setPool(db *gorm.DB, maxOpenConns int, maxIdleConns int, connMaxLifetime time.Duration, connMaxIdleTime time.Duration) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection pool: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(maxOpenConns)
+	sqlDB.SetMaxIdleConns(maxIdleConns)
+	sqlDB.SetConnMaxLifetime(connMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(connMaxIdleTime)
+	return nil
+}
+
+type SQLiteDialect struct{}
+
+func (SQLiteDialect) Open(dsn string) (gorm.Dialector, error) {
+	return sqlite.Open(dsn), nil
+}
+
+func (SQLiteDialect) Setup(db *gorm.DB, config *configs.AppConfig) error {
+	// SQLite allows a single writer; queue on one connection instead of failing with SQLITE_BUSY/LOCKED
+	// A single connection that never expires also applies the PRAGMAs below to every query,
+	// and keeps an in-memory database alive
+	if err := setPool(db, 1, 1, 0, 0); err != nil {
+		return err
+	}
+	pragmas := []string{
+		"PRAGMA foreign_keys = ON",    // Enable foreign key support for SQLite
+		"PRAGMA journal_mode = WAL",   // Enable Write-Ahead Logging for better concurrency
+		"PRAGMA synchronous = NORMAL", // Set synchronous mode to NORMAL for better performance
+		"PRAGMA cache_size = 10000",   // Set cache size for better performance
+		"PRAGMA busy_timeout = 5000",  // Wait for other processes' locks (e.g. server & worker)
+	}
+	for _, pragma := range pragmas {
+		if err := db.Exec(pragma).Error; err != nil {
+			return fmt.Errorf("failed to set %s: %w", pragma, err)
+		}
+	}
+	return nil
+}
+
+func (SQLiteDialect) IsRetryable(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+func (SQLiteDialect) IsDuplicate(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	return false
+}
+
+type PostgresDialect struct{}
+
+func (PostgresDialect) Open(dsn string) (gorm.Dialector, error) {
+	return postgres.Open(dsn), nil
+}
+
+func (PostgresDialect) Setup(db *gorm.DB, config *configs.AppConfig) error {
+	return setPool(db, config.DatabaseMaxOpenConns, config.DatabaseMaxIdleConns,
+		config.DatabaseConnMaxLifetime, config.DatabaseConnMaxIdleTime)
+}
+
+func (PostgresDialect) IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code == "40P01" // serialization_failure, deadlock_detected
+	}
+	return false
+}
+
+func (PostgresDialect) IsDuplicate(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505" // unique_violation
+	}
+	return false
+}
+
+type MySQLDialect struct{}
+
+func (MySQLDialect) Open(dsn string) (gorm.Dialector, error) {
+	mysqlConfig, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MySQL DSN: %w", err)
+	}
+	// Scan DATETIME columns into time.Time, in UTC as gorm writes them
+	mysqlConfig.ParseTime = true
+	mysqlConfig.Loc = time.UTC
+	return gormmysql.Open(mysqlConfig.FormatDSN()), nil
+}
+
+func (MySQLDialect) Setup(db *gorm.DB, config *configs.AppConfig) error {
+	return setPool(db, config.DatabaseMaxOpenConns, config.DatabaseMaxIdleConns,
+		config.DatabaseConnMaxLifetime, config.DatabaseConnMaxIdleTime)
+}
+
+func (MySQLDialect) IsRetryable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1213 || mysqlErr.Number == 1205 // ER_LOCK_DEADLOCK, ER_LOCK_WAIT_TIMEOUT
+	}
+	return false
+}
+
+func (MySQLDialect) IsDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062 // ER_DUP_ENTRY
+	}
+	return false
+}
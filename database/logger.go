@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Reports gorm's logs and queries to slog: failed queries as errors, slow queries as warnings, and the rest at debug
+// Query parameters are never logged, as they hold user and financial data: queries keep their placeholders
+type GormLogger struct {
+	logger    *slog.Logger
+	slowQuery time.Duration
+	level     gormlogger.LogLevel
+}
+
+// PUBLIC: Build gorm logger on a slog logger, warning of queries taking longer than slowQuery (0 to never warn)
+func NewGormLogger(logger *slog.Logger, slowQuery time.Duration) *GormLogger {
+	return &GormLogger{logger: logger, slowQuery: slowQuery, level: gormlogger.Info}
+}
+
+func (l *GormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	copied := *l
+	copied.level = level
+	return &copied
+}
+
+func (l *GormLogger) Info(ctx context.Context, message string, data ...any) {
+	if l.level >= gormlogger.Info {
+		l.logger.InfoContext(ctx, fmt.Sprintf(message, data...))
+	}
+}
+
+func (l *GormLogger) Warn(ctx context.Context, message string, data ...any) {
+	if l.level >= gormlogger.Warn {
+		l.logger.WarnContext(ctx, fmt.Sprintf(message, data...))
+	}
+}
+
+func (l *GormLogger) Error(ctx context.Context, message string, data ...any) {
+	if l.level >= gormlogger.Error {
+		l.logger.ErrorContext(ctx, fmt.Sprintf(message, data...))
+	}
+}
+
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+
+	// A missing record is an expected outcome, not a failure
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= gormlogger.Error:
+		sql, rows := fc()
+		l.logger.ErrorContext(ctx, "Query failed", "sql", sql, "rows", rows, "elapsed", elapsed, "error", err)
+	case l.slowQuery > 0 && elapsed > l.slowQuery && l.level >= gormlogger.Warn:
+		sql, rows := fc()
+		l.logger.WarnContext(ctx, "Slow query", "sql", sql, "rows", rows, "elapsed", elapsed, "threshold", l.slowQuery)
+	case l.level >= gormlogger.Info && l.logger.Enabled(ctx, slog.LevelDebug):
+		sql, rows := fc()
+		l.logger.DebugContext(ctx, "Query", "sql", sql, "rows", rows, "elapsed", elapsed)
+	}
+}
+
+// Drop query parameters before queries are rendered for logs
+func (l *GormLogger) ParamsFilter(ctx context.Context, sql string, params ...any) (string, []any) {
+	return sql, nil
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestGormLogger(t *testing.T) {
+	db := openTestDB(t, "gorm-logger")
+	if err := db.AutoMigrate(&User{}); err != nil {
+		t.Fatalf("AutoMigrate failed: %v", err)
+	}
+
+	var tests = []struct {
+		name      string
+		level     slog.Level
+		slowQuery time.Duration
+		query     func(db *gorm.DB) error
+		expected  string // Empty when nothing should be logged
+	}{
+		{"Test failed query logged as error", slog.LevelInfo, time.Hour, func(db *gorm.DB) error {
+			return db.Exec("SELECT * FROM missing WHERE reference_id = ?", "user-secret").Error
+		}, "level=ERROR msg=\"Query failed\""},
+		{"Test slow query logged as warning", slog.LevelInfo, time.Nanosecond, func(db *gorm.DB) error {
+			return db.Create(&User{ReferenceID: "user-secret"}).Error
+		}, "level=WARN msg=\"Slow query\""},
+		{"Test query logged at debug", slog.LevelDebug, time.Hour, func(db *gorm.DB) error {
+			return db.Where(&User{ReferenceID: "user-secret"}).Find(&[]User{}).Error
+		}, "level=DEBUG msg=Query"},
+		{"Test query not logged above debug", slog.LevelInfo, time.Hour, func(db *gorm.DB) error {
+			return db.Where(&User{ReferenceID: "user-secret"}).Find(&[]User{}).Error
+		}, ""},
+		{"Test record not found not logged", slog.LevelInfo, time.Hour, func(db *gorm.DB) error {
+			err := db.Where(&User{ReferenceID: "unknown"}).First(&User{}).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buffer, &slog.HandlerOptions{Level: tt.level}))
+			session := db.Session(&gorm.Session{Logger: NewGormLogger(logger, tt.slowQuery)})
+			tt.query(session)
+
+			logged := buffer.String()
+			if tt.expected == "" {
+				if logged != "" {
+					t.Errorf("❌ Expected nothing logged, got %s", logged)
+				}
+				return
+			}
+			if !strings.Contains(logged, tt.expected) {
+				t.Errorf("❌ Expected %s, got %s", tt.expected, logged)
+			} else if strings.Contains(logged, "user-secret") || !strings.Contains(logged, "?") {
+				t.Errorf("❌ Expected query logged with placeholders instead of values, got %s", logged)
+			} else {
+				t.Logf("✅ Logged %s", strings.TrimSpace(logged))
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSchemaBehind  = errors.New("database schema is behind; run `migrate up`")
+	ErrSchemaAhead   = errors.New("database schema is ahead of this build")
+	ErrNoSuchVersion = errors.New("no such migration version")
+)
+
+// Versioned schema change, applied in version order
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// Record of an applied migration
+type SchemaVersion struct {
+	Version   uint `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (SchemaVersion) TableName() string {
+	return "schema_version"
+}
+
+// Migration with its state in the database
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// PRIVATE: Get applied migrations => { Version : SchemaVersion }
+func appliedVersions(db *gorm.DB) (map[uint]SchemaVersion, error) {
+	if err := db.AutoMigrate(&SchemaVersion{}); err != nil {
+		return nil, fmt.Errorf("failed to create schema version table: %w", err)
+	}
+	var versions []SchemaVersion
+	if err := db.Order("version").Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get schema versions: %w", err)
+	}
+	applied := make(map[uint]SchemaVersion)
+	for _, version := range versions {
+		applied[version.Version] = version
+	}
+	return applied, nil
+}
+
+// Get every known migration with whether it is applied, oldest first
+func GetMigrationStatus(db *gorm.DB) ([]MigrationStatus, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Migration: migration}
+		if version, exists := applied[migration.Version]; exists {
+			status.Applied = true
+			status.AppliedAt = &version.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Apply pending migrations up to and including the target version (0 for latest)
+// Each migration runs in its own DB transaction together with its schema version record
+func MigrateUp(db *gorm.DB, target uint) error {
+	if target != 0 && !slices.ContainsFunc(migrations, func(m Migration) bool { return m.Version == target }) {
+		return fmt.Errorf("%w: %d", ErrNoSuchVersion, target)
+	}
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if target != 0 && migration.Version > target {
+			break
+		}
+		if _, exists := applied[migration.Version]; exists {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaVersion{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: Now(),
+			}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// Roll back the latest `steps` applied migrations, newest first
+func MigrateDown(db *gorm.DB, steps int) error {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		migration := migrations[i]
+		if _, exists := applied[migration.Version]; !exists {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaVersion{Version: migration.Version}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to roll back migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+		steps--
+	}
+	return nil
+}
+
+// Check that every known migration is applied, and no unknown one
+func CheckSchema(db *gorm.DB) error {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return err
+	}
+	for _, migration := range migrations {
+		if _, exists := applied[migration.Version]; !exists {
+			return fmt.Errorf("%w: migration %d (%s) is pending", ErrSchemaBehind, migration.Version, migration.Name)
+		}
+		delete(applied, migration.Version)
+	}
+	for version := range applied {
+		return fmt.Errorf("%w: unknown migration %d is applied", ErrSchemaAhead, version)
+	}
+	return nil
+}
+
+// Apply all pending migrations
+func Migrate(db *gorm.DB) error {
+	return MigrateUp(db, 0)
+}
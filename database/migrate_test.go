@@ -0,0 +1,205 @@
+package database
+
+import (
+	"errors"
+	"portfolio-investment/configs"
+	"portfolio-investment/money"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Open a private, empty in-memory database; dbtest.New migrates and seeds, so it is no use here
+func openTestDB(t *testing.T, name string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get connection pool: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t, "migrate")
+	latest := migrations[len(migrations)-1].Version
+
+	var tests = []struct {
+		name    string
+		migrate func() error
+		err     error
+		schema  error
+		tables  bool
+	}{
+		{"Test fresh database is behind", func() error { return nil }, nil, ErrSchemaBehind, false},
+		{"Test up to first version", func() error { return MigrateUp(db, 1) }, nil, ErrSchemaBehind, true},
+		{"Test up to latest", func() error { return Migrate(db) }, nil, nil, true},
+		{"Test up is idempotent", func() error { return Migrate(db) }, nil, nil, true},
+		{"Test down one step", func() error { return MigrateDown(db, 1) }, nil, ErrSchemaBehind, true},
+		{"Test up again", func() error { return MigrateUp(db, latest) }, nil, nil, true},
+		{"Test down everything", func() error { return MigrateDown(db, len(migrations)+1) }, nil, ErrSchemaBehind, false},
+		{"Test unknown version", func() error { return MigrateUp(db, latest+1) }, ErrNoSuchVersion, ErrSchemaBehind, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.migrate()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("❌ Expected migration error %v, got %v", tt.err, err)
+			}
+
+			err = CheckSchema(db)
+			if !errors.Is(err, tt.schema) {
+				t.Errorf("❌ Expected schema check %v, got %v", tt.schema, err)
+			}
+			if hasTables := db.Migrator().HasTable(&Transaction{}); hasTables != tt.tables {
+				t.Errorf("❌ Expected tables to exist: %v, got %v", tt.tables, hasTables)
+			}
+		})
+	}
+
+	// A schema migrated by a newer build is refused too
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if err := db.Create(&SchemaVersion{Version: latest + 1, Name: "from_the_future"}).Error; err != nil {
+		t.Fatalf("Failed to record schema version: %v", err)
+	}
+	if err := CheckSchema(db); !errors.Is(err, ErrSchemaAhead) {
+		t.Errorf("❌ Expected schema to be ahead, got %v", err)
+	} else {
+		t.Log("✅ Schema versions enforced")
+	}
+}
+
+func TestMigrateBaseSchemaFrozen(t *testing.T) {
+	db := openTestDB(t, "migrate-frozen")
+
+	// Columns added by a migration only exist once it is applied, and are gone once it is rolled back
+	// Holding units come with migration 6, asset ticker and currency with migration 7
+	var tests = []struct {
+		name    string
+		migrate func() error
+		units   bool
+		columns bool
+	}{
+		{"Test earlier version without later columns", func() error { return MigrateUp(db, 4) }, false, false},
+		{"Test holdings without units", func() error { return MigrateUp(db, 5) }, false, false},
+		{"Test latest version with later columns", func() error { return Migrate(db) }, true, true},
+		{"Test later columns rolled back", func() error { return MigrateDown(db, 1) }, true, false},
+		{"Test holding units rolled back", func() error { return MigrateDown(db, 1) }, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.migrate(); err != nil {
+				t.Fatalf("❌ Migration failed: %v", err)
+			}
+			if units := db.Migrator().HasColumn(&Holding{}, "units"); units != tt.units {
+				t.Errorf("❌ Expected holding units: %v, got %v", tt.units, units)
+			} else {
+				t.Logf("✅ Holding units: %v", units)
+			}
+			ticker, currency := db.Migrator().HasColumn(&Asset{}, "ticker"), db.Migrator().HasColumn(&Asset{}, "currency")
+			if ticker != tt.columns || currency != tt.columns {
+				t.Errorf("❌ Expected asset ticker and currency: %v, got %v and %v", tt.columns, ticker, currency)
+			} else {
+				t.Logf("✅ Asset ticker and currency: %v", ticker)
+			}
+		})
+	}
+}
+
+func TestMigrateLegacySchema(t *testing.T) {
+	db := openTestDB(t, "migrate-legacy")
+
+	// Schema as created by releases before minor units and transaction status
+	statements := []string{
+		"CREATE TABLE user_portfolios (id integer PRIMARY KEY, user_id integer, portfolio_id integer, fund real)",
+		"CREATE TABLE transactions (id integer PRIMARY KEY, reference_id text, user_id integer, type text, amount real, processed numeric)",
+		"INSERT INTO user_portfolios (id, user_id, portfolio_id, fund) VALUES (1, 1, 1, 100.255), (2, 1, 2, 0.1)",
+		"INSERT INTO transactions (id, reference_id, user_id, type, amount, processed) VALUES (1, 'a', 1, 'deposit', 99.99, true), (2, 'b', 1, 'deposit', 0.3, false)",
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("Failed to create legacy schema: %v", err)
+		}
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("❌ Migrate failed: %v", err)
+	}
+	var userPortfolios []UserPortfolio
+	db.Order("id").Find(&userPortfolios)
+	var transactions []Transaction
+	db.Order("id").Find(&transactions)
+
+	var tests = []struct {
+		name     string
+		actual   money.Money
+		expected money.Money
+	}{
+		{"Test fund rounded to cents", userPortfolios[0].Fund, 10026},
+		{"Test float artifact fund", userPortfolios[1].Fund, 10},
+		{"Test transaction amount", transactions[0].Amount, 9999},
+		{"Test float artifact amount", transactions[1].Amount, 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.actual != tt.expected {
+				t.Errorf("❌ Expected %d cents, got %d", tt.expected, tt.actual)
+			}
+		})
+	}
+	if transactions[0].Status != configs.TrxnStatusCompleted || transactions[1].Status != configs.TrxnStatusPending {
+		t.Errorf("❌ Expected completed & pending statuses, got %s & %s", transactions[0].Status, transactions[1].Status)
+	}
+	if db.Migrator().HasColumn(&legacyTransaction{}, "processed") {
+		t.Errorf("❌ Expected legacy processed column to be dropped")
+	}
+
+	// Rolling back to the first version restores the legacy columns for older releases
+	if err := MigrateDown(db, len(migrations)-1); err != nil {
+		t.Fatalf("❌ MigrateDown failed: %v", err)
+	}
+	var legacy legacyTransaction
+	db.Where("id = ?", 1).First(&legacy)
+	if legacy.Amount != 99.99 || !legacy.Processed {
+		t.Errorf("❌ Expected legacy amount 99.99 and processed, got %v and %v", legacy.Amount, legacy.Processed)
+	} else {
+		t.Log("✅ Legacy schema migrated up and down")
+	}
+}
+
+func TestMigrateAssetComposition(t *testing.T) {
+	db := openTestDB(t, "migrate-composition")
+	if err := MigrateUp(db, 4); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+
+	// Before compositions, a portfolio only had the asset sharing its ID
+	statements := []string{
+		"INSERT INTO portfolios (id, reference_id, name) VALUES (1, 'with-asset', 'With Asset'), (2, 'without-asset', 'Without Asset')",
+		"INSERT INTO assets (id, name, class) VALUES (1, 'Apple Inc.', 'Stock')",
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("Failed to create portfolios: %v", err)
+		}
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatalf("❌ Migrate failed: %v", err)
+	}
+
+	var portfolioAssets []PortfolioAsset
+	db.Order("id").Find(&portfolioAssets)
+	if len(portfolioAssets) != 1 || portfolioAssets[0].PortfolioID != 1 || portfolioAssets[0].AssetID != 1 ||
+		portfolioAssets[0].Weight != FullWeight {
+		t.Errorf("❌ Expected asset 1 as the whole of portfolio 1, got %+v", portfolioAssets)
+	} else {
+		t.Log("✅ Former portfolio asset carried over as its whole composition")
+	}
+}
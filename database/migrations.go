@@ -0,0 +1,225 @@
+package database
+
+import (
+	"portfolio-investment/configs"
+	"portfolio-investment/money"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Known migrations, in version order. Never edit or reorder an applied migration; add a new one.
+// Migrations that create tables or columns use AutoMigrate, which is idempotent, so they are safe on databases
+// created before versioned migrations existed. The schema each migration creates is frozen (migrations_v1.go,
+// migrations_v4.go, ...), not taken from the models.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_schema",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(baseModels()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			models := baseModels()
+			for i := len(models) - 1; i >= 0; i-- {
+				if err := tx.Migrator().DropTable(models[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 2,
+		Name:    "money_cents_from_legacy_floats",
+		Up:      migrateMoneyColumnsUp,
+		Down:    migrateMoneyColumnsDown,
+	},
+	{
+		Version: 3,
+		Name:    "transaction_status_from_legacy_processed",
+		Up:      migrateTransactionStatusUp,
+		Down:    migrateTransactionStatusDown,
+	},
+	{
+		Version: 4,
+		Name:    "create_allocation_decisions",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v4AllocationDecision{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v4AllocationDecision{})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create_portfolio_assets_and_holdings",
+		Up:      migrateAssetCompositionUp,
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v5Holding{}, &v5PortfolioAsset{})
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create_asset_prices_and_holding_entries",
+		Up:      migrateHoldingEntriesUp,
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&v6HoldingEntry{}, &v6AssetPrice{}); err != nil {
+				return err
+			}
+			return dropColumn(tx, "holdings", "units")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add_asset_ticker_and_currency",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v7Asset{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropIndex(&v7Asset{}, "Ticker"); err != nil {
+				return err
+			}
+			if err := dropColumn(tx, "assets", "ticker"); err != nil {
+				return err
+			}
+			return dropColumn(tx, "assets", "currency")
+		},
+	},
+}
+
+// PRIVATE: Drop a column with plain SQL; the SQLite migrator's DropColumn leaves it in place
+func dropColumn(tx *gorm.DB, table string, column string) error {
+	return tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: table}, clause.Column{Name: column}).Error
+}
+
+// Legacy float (major unit) columns and the `processed` flag, as read by older releases
+type legacyUserPortfolio struct{ Fund float64 }
+type legacyUserDepositPlan struct{ Amount float64 }
+type legacyTransaction struct {
+	Amount    float64
+	Processed bool
+}
+type legacyDeposit struct{ Amount float64 }
+type legacyWithdrawal struct{ Amount float64 }
+
+func (legacyUserPortfolio) TableName() string   { return "user_portfolios" }
+func (legacyUserDepositPlan) TableName() string { return "user_deposit_plans" }
+func (legacyTransaction) TableName() string     { return "transactions" }
+func (legacyDeposit) TableName() string         { return "deposits" }
+func (legacyWithdrawal) TableName() string      { return "withdrawals" }
+
+var legacyMoneyColumns = []struct {
+	model     any
+	table     string
+	field     string
+	oldColumn string
+	newColumn string
+}{
+	{&legacyUserPortfolio{}, "user_portfolios", "Fund", "fund", "fund_cents"},
+	{&legacyUserDepositPlan{}, "user_deposit_plans", "Amount", "amount", "amount_cents"},
+	{&legacyTransaction{}, "transactions", "Amount", "amount", "amount_cents"},
+	{&legacyDeposit{}, "deposits", "Amount", "amount", "amount_cents"},
+	{&legacyWithdrawal{}, "withdrawals", "Amount", "amount", "amount_cents"},
+}
+
+// PRIVATE: Convert legacy float columns (major units) into integer minor unit columns
+func migrateMoneyColumnsUp(tx *gorm.DB) error {
+	for _, column := range legacyMoneyColumns {
+		if !tx.Migrator().HasColumn(column.model, column.oldColumn) {
+			continue
+		}
+		table := clause.Table{Name: column.table}
+		// Rounded value is stored exactly by the integer column on every dialect
+		err := tx.Exec(
+			"UPDATE ? SET ? = ROUND(? * ?)",
+			table, clause.Column{Name: column.newColumn}, clause.Column{Name: column.oldColumn}, money.MinorUnits,
+		).Error
+		if err != nil {
+			return err
+		}
+		if err := dropColumn(tx, column.table, column.oldColumn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PRIVATE: Restore legacy float columns from the minor unit columns, for older releases
+func migrateMoneyColumnsDown(tx *gorm.DB) error {
+	for _, column := range legacyMoneyColumns {
+		if !tx.Migrator().HasColumn(column.model, column.oldColumn) {
+			if err := tx.Migrator().AddColumn(column.model, column.field); err != nil {
+				return err
+			}
+		}
+		table := clause.Table{Name: column.table}
+		err := tx.Exec(
+			"UPDATE ? SET ? = ? / ?",
+			table, clause.Column{Name: column.oldColumn}, clause.Column{Name: column.newColumn}, float64(money.MinorUnits),
+		).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PRIVATE: Convert legacy `processed` flag into transaction status
+func migrateTransactionStatusUp(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&legacyTransaction{}, "processed") {
+		return nil
+	}
+	err := tx.Model(&Transaction{}).Where("processed = ?", true).
+		Update("status", configs.TrxnStatusCompleted).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Model(&Transaction{}).Where("processed = ? OR processed IS NULL", false).
+		Update("status", configs.TrxnStatusPending).Error
+	if err != nil {
+		return err
+	}
+	return dropColumn(tx, "transactions", "processed")
+}
+
+// PRIVATE: Restore legacy `processed` flag from transaction status, for older releases
+func migrateTransactionStatusDown(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&legacyTransaction{}, "processed") {
+		if err := tx.Migrator().AddColumn(&legacyTransaction{}, "Processed"); err != nil {
+			return err
+		}
+	}
+	return tx.Model(&legacyTransaction{}).Where("1 = 1").Update("processed", gorm.Expr(
+		"status IN ?", []configs.TransactionStatus{configs.TrxnStatusCompleted, configs.TrxnStatusPartiallyAllocated},
+	)).Error
+}
+
+// PRIVATE: Create portfolio compositions and holdings
+// The former Portfolio.Assets relation joined assets on their own ID, so a portfolio could only keep the asset
+// sharing its ID: that asset is carried over as the portfolio's whole composition
+func migrateAssetCompositionUp(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&v5PortfolioAsset{}, &v5Holding{}); err != nil {
+		return err
+	}
+	return tx.Exec(
+		"INSERT INTO portfolio_assets (created_at, updated_at, portfolio_id, asset_id, weight) "+
+			"SELECT portfolios.created_at, portfolios.updated_at, portfolios.id, assets.id, ? FROM portfolios "+
+			"JOIN assets ON assets.id = portfolios.id AND assets.deleted_at IS NULL "+
+			"WHERE portfolios.id NOT IN (SELECT portfolio_id FROM portfolio_assets)",
+		FullWeight,
+	).Error
+}
+
+// PRIVATE: Create asset prices and holding entries, with holding units
+// Holdings from before entries were kept open with an entry for their cost, without units: they were bought at no price
+func migrateHoldingEntriesUp(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&v6AssetPrice{}, &v6Holding{}, &v6HoldingEntry{}); err != nil {
+		return err
+	}
+	return tx.Exec(
+		"INSERT INTO holding_entries (created_at, updated_at, holding_id, amount_cents, units) " +
+			"SELECT holdings.created_at, holdings.updated_at, holdings.id, holdings.amount_cents, 0 FROM holdings " +
+			"WHERE holdings.amount_cents <> 0 AND holdings.id NOT IN (SELECT holding_id FROM holding_entries)",
+	).Error
+}
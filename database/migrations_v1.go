@@ -0,0 +1,135 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Schema of migration 1, as it was when versioned migrations were introduced; never change these
+// Later migrations change the models, so creating the base schema from them would create later columns early
+type v1Asset struct {
+	gorm.Model
+	Name  string
+	Class string
+}
+
+type v1Portfolio struct {
+	gorm.Model
+	ReferenceID string `gorm:"uniqueIndex"`
+	Name        string
+}
+
+type v1User struct {
+	gorm.Model
+	ReferenceID        string `gorm:"uniqueIndex"`
+	AllocationStrategy string
+}
+
+type v1UserPortfolio struct {
+	gorm.Model
+	UserID      uint        `gorm:"uniqueIndex:idx_user_portfolio"`
+	User        v1User      `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	PortfolioID uint        `gorm:"uniqueIndex:idx_user_portfolio"`
+	Portfolio   v1Portfolio `gorm:"foreignKey:PortfolioID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Fund        int64       `gorm:"column:fund_cents;not null;default:0"`
+	Version     uint        `gorm:"not null;default:0"`
+}
+
+type v1UserCash struct {
+	gorm.Model
+	UserID  uint   `gorm:"uniqueIndex"`
+	User    v1User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Balance int64  `gorm:"column:balance_cents;not null;default:0"`
+	Version uint   `gorm:"not null;default:0"`
+}
+
+type v1UserDepositPlan struct {
+	gorm.Model
+	Type        string      `gorm:"uniqueIndex:idx_user_plan"`
+	UserID      uint        `gorm:"uniqueIndex:idx_user_plan"`
+	User        v1User      `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	PortfolioID uint        `gorm:"uniqueIndex:idx_user_plan"`
+	Portfolio   v1Portfolio `gorm:"foreignKey:PortfolioID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Amount      int64       `gorm:"column:amount_cents;not null;default:0"`
+}
+
+type v1Transaction struct {
+	gorm.Model
+	ReferenceID    string `gorm:"uniqueIndex"`
+	UserID         uint
+	User           v1User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Type           string
+	Amount         int64  `gorm:"column:amount_cents;not null;default:0"`
+	Status         string `gorm:"index;not null;default:'pending'"`
+	FailureReason  string
+	Attempts       int
+	NextAttemptAt  *time.Time
+	LeaseOwner     string
+	LeaseExpiresAt *time.Time
+}
+
+type v1TransactionTransition struct {
+	gorm.Model
+	TransactionID uint          `gorm:"index"`
+	Transaction   v1Transaction `gorm:"foreignKey:TransactionID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	From          string
+	To            string
+	Reason        string
+}
+
+type v1Deposit struct {
+	gorm.Model
+	TransactionID uint              `gorm:"uniqueIndex:idx_deposit"`
+	Transaction   v1Transaction     `gorm:"foreignKey:TransactionID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	PlanID        uint              `gorm:"uniqueIndex:idx_deposit"`
+	Plan          v1UserDepositPlan `gorm:"foreignKey:PlanID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Amount        int64             `gorm:"column:amount_cents;not null;default:0"`
+}
+
+type v1Withdrawal struct {
+	gorm.Model
+	TransactionID   uint            `gorm:"uniqueIndex:idx_withdrawal"`
+	Transaction     v1Transaction   `gorm:"foreignKey:TransactionID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	UserPortfolioID uint            `gorm:"uniqueIndex:idx_withdrawal"`
+	UserPortfolio   v1UserPortfolio `gorm:"foreignKey:UserPortfolioID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Amount          int64           `gorm:"column:amount_cents;not null;default:0"`
+}
+
+type v1CashEntry struct {
+	gorm.Model
+	TransactionID uint
+	Transaction   v1Transaction `gorm:"foreignKey:TransactionID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	UserCashID    uint
+	UserCash      v1UserCash `gorm:"foreignKey:UserCashID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Amount        int64      `gorm:"column:amount_cents;not null;default:0"`
+}
+
+func (v1Asset) TableName() string                 { return "assets" }
+func (v1Portfolio) TableName() string             { return "portfolios" }
+func (v1User) TableName() string                  { return "users" }
+func (v1UserPortfolio) TableName() string         { return "user_portfolios" }
+func (v1UserCash) TableName() string              { return "user_cashes" }
+func (v1UserDepositPlan) TableName() string       { return "user_deposit_plans" }
+func (v1Transaction) TableName() string           { return "transactions" }
+func (v1TransactionTransition) TableName() string { return "transaction_transitions" }
+func (v1Deposit) TableName() string               { return "deposits" }
+func (v1Withdrawal) TableName() string            { return "withdrawals" }
+func (v1CashEntry) TableName() string             { return "cash_entries" }
+
+// PRIVATE: Models of the base schema, dependencies first
+func baseModels() []any {
+	return []any{
+		&v1Asset{},
+		&v1Portfolio{},
+		&v1User{},
+		&v1UserPortfolio{},
+		&v1UserCash{},
+		&v1UserDepositPlan{},
+		&v1Transaction{},
+		&v1TransactionTransition{},
+		&v1Deposit{},
+		&v1Withdrawal{},
+		&v1CashEntry{},
+	}
+}
@@ -0,0 +1,31 @@
+package database
+
+import "gorm.io/gorm"
+
+// Schema of migration 4, as it was when allocation decisions were introduced; never change this
+type v4AllocationDecision struct {
+	gorm.Model
+	TransactionID   uint          `gorm:"uniqueIndex:idx_allocation_decision"`
+	Transaction     v1Transaction `gorm:"foreignKey:TransactionID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Sequence        int           `gorm:"uniqueIndex:idx_allocation_decision"`
+	Strategy        string        `gorm:"not null"`
+	Step            string        `gorm:"not null"`
+	DepositID       *uint
+	Deposit         *v1Deposit `gorm:"foreignKey:DepositID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	PlanID          *uint
+	Plan            *v1UserDepositPlan `gorm:"foreignKey:PlanID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	PortfolioID     *uint
+	Portfolio       *v1Portfolio `gorm:"foreignKey:PortfolioID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	PlanType        string
+	PlanAmount      int64   `gorm:"column:plan_amount_cents;not null;default:0"`
+	PlanContributed int64   `gorm:"column:plan_contributed_cents;not null;default:0"`
+	PortfolioFund   int64   `gorm:"column:portfolio_fund_cents;not null;default:0"`
+	Weight          int64   `gorm:"not null;default:0"`
+	TotalWeight     int64   `gorm:"not null;default:0"`
+	Ratio           float64 `gorm:"not null;default:0"`
+	Amount          int64   `gorm:"column:amount_cents;not null;default:0"`
+	RemainingBefore int64   `gorm:"column:remaining_before_cents;not null;default:0"`
+	RemainingAfter  int64   `gorm:"column:remaining_after_cents;not null;default:0"`
+}
+
+func (v4AllocationDecision) TableName() string { return "allocation_decisions" }
@@ -0,0 +1,26 @@
+package database
+
+import "gorm.io/gorm"
+
+// Schema of migration 5, as it was when portfolio compositions and holdings were introduced; never change these
+// Holdings had no units until migration 6
+type v5PortfolioAsset struct {
+	gorm.Model
+	PortfolioID uint        `gorm:"uniqueIndex:idx_portfolio_asset"`
+	Portfolio   v1Portfolio `gorm:"foreignKey:PortfolioID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	AssetID     uint        `gorm:"uniqueIndex:idx_portfolio_asset"`
+	Asset       v1Asset     `gorm:"foreignKey:AssetID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Weight      int         `gorm:"not null;default:0"`
+}
+
+type v5Holding struct {
+	gorm.Model
+	UserPortfolioID uint            `gorm:"uniqueIndex:idx_holding"`
+	UserPortfolio   v1UserPortfolio `gorm:"foreignKey:UserPortfolioID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	AssetID         uint            `gorm:"uniqueIndex:idx_holding"`
+	Asset           v1Asset         `gorm:"foreignKey:AssetID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Amount          int64           `gorm:"column:amount_cents;not null;default:0"`
+}
+
+func (v5PortfolioAsset) TableName() string { return "portfolio_assets" }
+func (v5Holding) TableName() string        { return "holdings" }
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Schema of migration 6, as it was when asset prices and holding entries were introduced; never change these
+type v6AssetPrice struct {
+	gorm.Model
+	AssetID uint      `gorm:"uniqueIndex:idx_asset_price"`
+	Asset   v1Asset   `gorm:"foreignKey:AssetID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Date    time.Time `gorm:"uniqueIndex:idx_asset_price"`
+	Price   int64     `gorm:"column:price_cents;not null;default:0"`
+}
+
+// Holdings of migration 5, with units
+type v6Holding struct {
+	gorm.Model
+	UserPortfolioID uint            `gorm:"uniqueIndex:idx_holding"`
+	UserPortfolio   v1UserPortfolio `gorm:"foreignKey:UserPortfolioID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	AssetID         uint            `gorm:"uniqueIndex:idx_holding"`
+	Asset           v1Asset         `gorm:"foreignKey:AssetID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Amount          int64           `gorm:"column:amount_cents;not null;default:0"`
+	Units           float64         `gorm:"not null;default:0"`
+}
+
+type v6HoldingEntry struct {
+	gorm.Model
+	HoldingID     uint      `gorm:"index"`
+	Holding       v6Holding `gorm:"foreignKey:HoldingID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	TransactionID *uint
+	Transaction   *v1Transaction `gorm:"foreignKey:TransactionID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Amount        int64          `gorm:"column:amount_cents;not null;default:0"`
+	Units         float64        `gorm:"not null;default:0"`
+}
+
+func (v6AssetPrice) TableName() string   { return "asset_prices" }
+func (v6Holding) TableName() string      { return "holdings" }
+func (v6HoldingEntry) TableName() string { return "holding_entries" }
@@ -0,0 +1,14 @@
+package database
+
+import "gorm.io/gorm"
+
+// Schema of migration 7, as it was when assets gained tickers and currencies; never change this
+type v7Asset struct {
+	gorm.Model
+	Name     string
+	Class    string
+	Ticker   string `gorm:"index"`
+	Currency string `gorm:"not null;default:'USD'"`
+}
+
+func (v7Asset) TableName() string { return "assets" }
@@ -2,35 +2,93 @@ package database
 
 import (
 	"portfolio-investment/configs"
+	"portfolio-investment/money"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 type Asset struct {
 	gorm.Model
-	Name  string
-	Class string
+	Name     string
+	Class    string
+	Ticker   string `gorm:"index"`                  // Symbol price feeds may quote it by, instead of its name
+	Currency string `gorm:"not null;default:'USD'"` // Currency its prices are quoted in
 }
 
 type Portfolio struct {
 	gorm.Model
 	ReferenceID string `gorm:"uniqueIndex"`
 	Name        string
-	Assets      []Asset `gorm:"foreignKey:ID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	Assets      []PortfolioAsset `gorm:"foreignKey:PortfolioID;references:ID"` // Composition, by target weight
+}
+
+// Basis points in 100%: a portfolio's asset weights sum to this
+const FullWeight = 10000
+
+// Target share of a portfolio held in an asset, in basis points
+type PortfolioAsset struct {
+	gorm.Model
+	PortfolioID uint      `gorm:"uniqueIndex:idx_portfolio_asset"`
+	Portfolio   Portfolio `gorm:"foreignKey:PortfolioID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	AssetID     uint      `gorm:"uniqueIndex:idx_portfolio_asset"`
+	Asset       Asset     `gorm:"foreignKey:AssetID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Weight      int       `gorm:"not null;default:0"`
 }
 
 type User struct {
 	gorm.Model
-	ReferenceID string `gorm:"uniqueIndex"`
+	ReferenceID        string `gorm:"uniqueIndex"`
+	AllocationStrategy configs.AllocationStrategyType
 }
 
 type UserPortfolio struct {
 	gorm.Model
-	UserID      uint      `gorm:"uniqueIndex:idx_user_portfolio"`
-	User        User      `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	PortfolioID uint      `gorm:"uniqueIndex:idx_user_portfolio"`
-	Portfolio   Portfolio `gorm:"foreignKey:PortfolioID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	Fund        float64
+	UserID      uint        `gorm:"uniqueIndex:idx_user_portfolio"`
+	User        User        `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	PortfolioID uint        `gorm:"uniqueIndex:idx_user_portfolio"`
+	Portfolio   Portfolio   `gorm:"foreignKey:PortfolioID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Fund        money.Money `gorm:"column:fund_cents;not null;default:0"`
+	Version     uint        `gorm:"not null;default:0"` // Bumped on every fund update, for optimistic concurrency
+}
+
+// Amount of a user portfolio held in an asset: the portfolio's deposits split by target weight, less withdrawals
+type Holding struct {
+	gorm.Model
+	UserPortfolioID uint          `gorm:"uniqueIndex:idx_holding"`
+	UserPortfolio   UserPortfolio `gorm:"foreignKey:UserPortfolioID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	AssetID         uint          `gorm:"uniqueIndex:idx_holding"`
+	Asset           Asset         `gorm:"foreignKey:AssetID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Amount          money.Money   `gorm:"column:amount_cents;not null;default:0"` // Cost: amount deposited less withdrawn
+	Units           float64       `gorm:"not null;default:0"`                     // Bought at the asset's price on each deposit date
+}
+
+// Change in a holding, for its cost and units as of any date
+type HoldingEntry struct {
+	gorm.Model
+	HoldingID     uint         `gorm:"index"`
+	Holding       Holding      `gorm:"foreignKey:HoldingID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	TransactionID *uint        // Deposit or withdrawal it was part of; none for balances from before entries were kept
+	Transaction   *Transaction `gorm:"foreignKey:TransactionID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Amount        money.Money  `gorm:"column:amount_cents;not null;default:0"` // Positive credits, negative debits
+	Units         float64      `gorm:"not null;default:0"`
+}
+
+// Closing price of one unit of an asset on a day
+type AssetPrice struct {
+	gorm.Model
+	AssetID uint        `gorm:"uniqueIndex:idx_asset_price"`
+	Asset   Asset       `gorm:"foreignKey:AssetID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Date    time.Time   `gorm:"uniqueIndex:idx_asset_price"` // Midnight UTC
+	Price   money.Money `gorm:"column:price_cents;not null;default:0"`
+}
+
+type UserCash struct {
+	gorm.Model
+	UserID  uint        `gorm:"uniqueIndex"`
+	User    User        `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Balance money.Money `gorm:"column:balance_cents;not null;default:0"`
+	Version uint        `gorm:"not null;default:0"` // Bumped on every balance update, for optimistic concurrency
 }
 
 type UserDepositPlan struct {
@@ -40,17 +98,32 @@ type UserDepositPlan struct {
 	User        User             `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 	PortfolioID uint             `gorm:"uniqueIndex:idx_user_plan"`
 	Portfolio   Portfolio        `gorm:"foreignKey:PortfolioID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
-	Amount      float64
+	Amount      money.Money      `gorm:"column:amount_cents;not null;default:0"`
 }
 
 type Transaction struct {
 	gorm.Model
-	ReferenceID string `gorm:"uniqueIndex"`
-	UserID      uint
-	User        User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
-	Type        configs.TransactionType
-	Amount      float64
-	Processed   bool
+	ReferenceID    string `gorm:"uniqueIndex"`
+	UserID         uint
+	User           User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Type           configs.TransactionType
+	Amount         money.Money               `gorm:"column:amount_cents;not null;default:0"`
+	Status         configs.TransactionStatus `gorm:"index;not null;default:'pending'"`
+	FailureReason  string
+	Attempts       int
+	NextAttemptAt  *time.Time
+	LeaseOwner     string
+	LeaseExpiresAt *time.Time
+	Replayed       bool `gorm:"-"` // Set when an existing transaction is returned for a reused reference ID
+}
+
+type TransactionTransition struct {
+	gorm.Model
+	TransactionID uint        `gorm:"index"`
+	Transaction   Transaction `gorm:"foreignKey:TransactionID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	From          configs.TransactionStatus
+	To            configs.TransactionStatus
+	Reason        string
 }
 
 type Deposit struct {
@@ -59,5 +132,51 @@ type Deposit struct {
 	Transaction   Transaction     `gorm:"foreignKey:TransactionID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
 	PlanID        uint            `gorm:"uniqueIndex:idx_deposit"`
 	Plan          UserDepositPlan `gorm:"foreignKey:PlanID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
-	Amount        float64
+	Amount        money.Money     `gorm:"column:amount_cents;not null;default:0"`
+}
+
+type Withdrawal struct {
+	gorm.Model
+	TransactionID   uint          `gorm:"uniqueIndex:idx_withdrawal"`
+	Transaction     Transaction   `gorm:"foreignKey:TransactionID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	UserPortfolioID uint          `gorm:"uniqueIndex:idx_withdrawal"`
+	UserPortfolio   UserPortfolio `gorm:"foreignKey:UserPortfolioID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Amount          money.Money   `gorm:"column:amount_cents;not null;default:0"`
+}
+
+type CashEntry struct {
+	gorm.Model
+	TransactionID uint
+	Transaction   Transaction `gorm:"foreignKey:TransactionID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	UserCashID    uint
+	UserCash      UserCash    `gorm:"foreignKey:UserCashID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Amount        money.Money `gorm:"column:amount_cents;not null;default:0"` // Positive credits, negative debits
+}
+
+// Why part of a deposit went where it did: one per strategy allocation, in order,
+// and a final 'remainder' decision for any amount credited to cash
+// Plan, fund and contribution amounts are snapshots from when the deposit was allocated
+type AllocationDecision struct {
+	gorm.Model
+	TransactionID   uint                           `gorm:"uniqueIndex:idx_allocation_decision"`
+	Transaction     Transaction                    `gorm:"foreignKey:TransactionID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Sequence        int                            `gorm:"uniqueIndex:idx_allocation_decision"` // Order decided in, from 1
+	Strategy        configs.AllocationStrategyType `gorm:"not null"`
+	Step            string                         `gorm:"not null"`
+	DepositID       *uint                          // Deposit the amount was recorded in; none for the remainder
+	Deposit         *Deposit                       `gorm:"foreignKey:DepositID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	PlanID          *uint
+	Plan            *UserDepositPlan `gorm:"foreignKey:PlanID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	PortfolioID     *uint
+	Portfolio       *Portfolio `gorm:"foreignKey:PortfolioID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	PlanType        configs.PlanType
+	PlanAmount      money.Money `gorm:"column:plan_amount_cents;not null;default:0"`
+	PlanContributed money.Money `gorm:"column:plan_contributed_cents;not null;default:0"` // In the plan's current period, before
+	PortfolioFund   money.Money `gorm:"column:portfolio_fund_cents;not null;default:0"`   // Before the deposit
+	Weight          int64       `gorm:"not null;default:0"`                               // Plan's weight in the step's split
+	TotalWeight     int64       `gorm:"not null;default:0"`                               // All weights in the step's split
+	Ratio           float64     `gorm:"not null;default:0"`                               // Weight / TotalWeight
+	Amount          money.Money `gorm:"column:amount_cents;not null;default:0"`
+	RemainingBefore money.Money `gorm:"column:remaining_before_cents;not null;default:0"` // Deposit left to allocate
+	RemainingAfter  money.Money `gorm:"column:remaining_after_cents;not null;default:0"`
 }
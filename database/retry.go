@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"portfolio-investment/configs"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Returned when a row changed between being read and written (optimistic concurrency)
+var ErrConflict = errors.New("concurrent update conflict")
+
+// Check if an error is transient, so the whole DB transaction may be retried
+func IsRetryable(err error) bool {
+	if errors.Is(err, ErrConflict) {
+		return true
+	}
+	for _, dialect := range dialects {
+		if dialect.IsRetryable(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if an error is a unique constraint violation, e.g. from losing a race to insert the same key
+func IsDuplicate(err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	for _, dialect := range dialects {
+		if dialect.IsDuplicate(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run handler in a DB transaction, retrying the whole transaction on conflict
+// The handler must re-read everything it depends on, since each attempt starts from a rolled back state
+func WithRetry(
+	ctx *context.Context,
+	db *gorm.DB,
+	config *configs.AppConfig,
+	handler func(tx *gorm.DB) error,
+) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = db.WithContext(*ctx).Transaction(handler)
+		if err == nil || !IsRetryable(err) || attempt >= config.DatabaseMaxRetries {
+			break
+		}
+
+		// Jittered exponential backoff, so conflicting callers don't collide again
+		backoff := config.DatabaseRetryBackoff << attempt
+		backoff += rand.N(backoff + 1)
+		select {
+		case <-(*ctx).Done():
+			return errors.Join(err, (*ctx).Err())
+		case <-time.After(backoff):
+		}
+	}
+	if err != nil && IsRetryable(err) {
+		return fmt.Errorf("gave up after %d retries: %w", config.DatabaseMaxRetries, err)
+	}
+	return err
+}
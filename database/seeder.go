@@ -2,6 +2,7 @@ package database
 
 import (
 	"portfolio-investment/configs"
+	"portfolio-investment/money"
 
 	"gorm.io/gorm"
 )
@@ -11,25 +12,25 @@ func SeedPortfolios(db *gorm.DB) []Portfolio {
 		{
 			ReferenceID: configs.DefaultPortfolioRetirement,
 			Name:        "Retirement",
-			Assets: []Asset{
-				{Name: "Apple Inc.", Class: "Stock"},
-				{Name: "Tesla Inc.", Class: "Stock"},
+			Assets: []PortfolioAsset{
+				{Asset: Asset{Name: "Apple Inc.", Class: "Stock", Ticker: "AAPL"}, Weight: 6000},
+				{Asset: Asset{Name: "Tesla Inc.", Class: "Stock", Ticker: "TSLA"}, Weight: 4000},
 			},
 		},
 		{
 			ReferenceID: configs.DefaultPortfolioHighRisk,
 			Name:        "High Risk",
-			Assets: []Asset{
-				{Name: "Bitcoin", Class: "Cryptocurrency"},
-				{Name: "Ethereum", Class: "Cryptocurrency"},
+			Assets: []PortfolioAsset{
+				{Asset: Asset{Name: "Bitcoin", Class: "Cryptocurrency", Ticker: "BTC"}, Weight: 7000},
+				{Asset: Asset{Name: "Ethereum", Class: "Cryptocurrency", Ticker: "ETH"}, Weight: 3000},
 			},
 		},
 		{
 			ReferenceID: "portfolio-low-risk",
 			Name:        "Low Risk",
-			Assets: []Asset{
-				{Name: "US Treasury Bonds", Class: "Bond"},
-				{Name: "Gold", Class: "Commodity"},
+			Assets: []PortfolioAsset{
+				{Asset: Asset{Name: "US Treasury Bonds", Class: "Bond", Ticker: "GOVT"}, Weight: 8000},
+				{Asset: Asset{Name: "Gold", Class: "Commodity", Ticker: "GLD"}, Weight: 2000},
 			},
 		},
 	}
@@ -56,19 +57,19 @@ func SeedUser(db *gorm.DB, userReferenceID string, portfolios []Portfolio) (*Use
 			userPortfolio := UserPortfolio{
 				User:      user,
 				Portfolio: portfolio,
-				Fund:      0,
+				Fund:      money.Zero,
 			}
 			oneTimePlan := UserDepositPlan{
 				User:      user,
 				Type:      configs.PlanTypeOnceTime,
 				Portfolio: portfolio,
-				Amount:    500.0,
+				Amount:    money.FromFloat(500.0),
 			}
 			monthlyPlan := UserDepositPlan{
 				User:      user,
 				Type:      configs.PlanTypeMonthly,
 				Portfolio: portfolio,
-				Amount:    100.0,
+				Amount:    money.FromFloat(100.0),
 			}
 			userPortfolios = append(userPortfolios, userPortfolio)
 			userDepositPlans = append(userDepositPlans, oneTimePlan, monthlyPlan)
@@ -76,19 +77,19 @@ func SeedUser(db *gorm.DB, userReferenceID string, portfolios []Portfolio) (*Use
 			userPortfolio := UserPortfolio{
 				User:      user,
 				Portfolio: portfolio,
-				Fund:      0,
+				Fund:      money.Zero,
 			}
 			oneTimePlan := UserDepositPlan{
 				User:      user,
 				Type:      configs.PlanTypeOnceTime,
 				Portfolio: portfolio,
-				Amount:    10000.0,
+				Amount:    money.FromFloat(10000.0),
 			}
 			monthlyPlan := UserDepositPlan{
 				User:      user,
 				Type:      configs.PlanTypeMonthly,
 				Portfolio: portfolio,
-				Amount:    0.0,
+				Amount:    money.FromFloat(0.0),
 			}
 			userPortfolios = append(userPortfolios, userPortfolio)
 			userDepositPlans = append(userDepositPlans, oneTimePlan, monthlyPlan)
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"portfolio-investment/logging"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header carrying the request ID, given by the client or generated
+const RequestIDHeader = "X-Request-ID"
+
+// Response writer remembering the status code written
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// PRIVATE: Give every request an ID carried by its context and echoed in the response, and log it once served
+// A client's request ID is kept (up to the reference ID length), so logs can be matched across services
+func withRequestContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" || len(requestID) > maxReferenceIDLength {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		r = r.WithContext(logging.WithRequestID(r.Context(), requestID))
+		next.ServeHTTP(recorder, r)
+
+		// The router has matched the request by now, so the user reference ID and route are known
+		if r.Pattern != "" {
+			_, route, _ := strings.Cut(r.Pattern, " ")
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Pattern)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(logging.WithUserID(r.Context(), r.PathValue("userReferenceID")), level, "Request served",
+			"method", r.Method, "route", r.Pattern, "status", recorder.status, "elapsed", time.Since(start))
+	})
+}
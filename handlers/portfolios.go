@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"portfolio-investment/database"
+	"portfolio-investment/repositories"
+)
+
+type PortfolioAssetRequest struct {
+	AssetID   uint `json:"asset_id"`
+	WeightBps int  `json:"weight_bps"`
+}
+
+type PortfolioAssetsRequest struct {
+	Assets []PortfolioAssetRequest `json:"assets"`
+}
+
+type PortfolioAssetResponse struct {
+	AssetID   uint   `json:"asset_id"`
+	Name      string `json:"name"`
+	Class     string `json:"class"`
+	WeightBps int    `json:"weight_bps"`
+}
+
+type PortfolioAssetsResponse struct {
+	PortfolioReferenceID string                   `json:"portfolio_reference_id"`
+	Assets               []PortfolioAssetResponse `json:"assets"`
+}
+
+// PRIVATE: Build portfolio composition response
+func newPortfolioAssetsResponse(portfolioReferenceID string, portfolioAssets []database.PortfolioAsset) PortfolioAssetsResponse {
+	assets := make([]PortfolioAssetResponse, 0, len(portfolioAssets))
+	for _, portfolioAsset := range portfolioAssets {
+		assets = append(assets, PortfolioAssetResponse{
+			AssetID:   portfolioAsset.AssetID,
+			Name:      portfolioAsset.Asset.Name,
+			Class:     portfolioAsset.Asset.Class,
+			WeightBps: portfolioAsset.Weight,
+		})
+	}
+	return PortfolioAssetsResponse{PortfolioReferenceID: portfolioReferenceID, Assets: assets}
+}
+
+// PUBLIC: List portfolio's assets with their target weights
+func (h *Handler) ListPortfolioAssets(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	portfolioReferenceID := r.PathValue("portfolioReferenceID")
+
+	portfolioAssets, err := h.store.GetPortfolioAssets(&ctx, portfolioReferenceID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newPortfolioAssetsResponse(portfolioReferenceID, portfolioAssets))
+}
+
+// PUBLIC: Replace portfolio's assets and target weights; later deposits are split by the new weights
+func (h *Handler) SetPortfolioAssets(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	portfolioReferenceID := r.PathValue("portfolioReferenceID")
+
+	var req PortfolioAssetsRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	weights := make([]repositories.AssetWeight, 0, len(req.Assets))
+	for i, asset := range req.Assets {
+		if asset.AssetID == 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("assets[%d].asset_id is required", i))
+			return
+		}
+		weights = append(weights, repositories.AssetWeight{AssetID: asset.AssetID, Weight: asset.WeightBps})
+	}
+
+	portfolioAssets, err := h.store.SetPortfolioAssets(&ctx, portfolioReferenceID, weights)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newPortfolioAssetsResponse(portfolioReferenceID, portfolioAssets))
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"portfolio-investment/repositories"
+	"portfolio-investment/services"
+	"portfolio-investment/strategies"
+
+	"gorm.io/gorm"
+)
+
+type ErrorCode string
+
+const (
+	ErrCodeInvalidRequest ErrorCode = "invalid_request"
+	ErrCodeNotFound       ErrorCode = "not_found"
+	ErrCodeInsufficient   ErrorCode = "insufficient_funds"
+	ErrCodeNoPlans        ErrorCode = "no_deposit_plans"
+	ErrCodeConflict       ErrorCode = "conflict"
+	ErrCodeComposition    ErrorCode = "invalid_composition"
+	ErrCodeInternal       ErrorCode = "internal_error"
+)
+
+type ErrorBody struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// PRIVATE: Write value as JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// PRIVATE: Write consistent error response body
+func writeError(w http.ResponseWriter, status int, code ErrorCode, message string) {
+	writeJSON(w, status, ErrorResponse{
+		Error: ErrorBody{Code: code, Message: message},
+	})
+}
+
+// PRIVATE: Map service/repository errors to HTTP error responses
+// Unexpected errors are logged with the request ID, and not told to the client
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "resource not found")
+		return
+	}
+	if errors.Is(err, repositories.ErrPlanExists) || errors.Is(err, repositories.ErrIdempotencyConflict) {
+		writeError(w, http.StatusConflict, ErrCodeConflict, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrInvalidRange) {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if errors.Is(err, strategies.ErrNoPlans) {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeNoPlans, err.Error())
+		return
+	}
+	if errors.Is(err, repositories.ErrInvalidComposition) {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeComposition, err.Error())
+		return
+	}
+	if errors.Is(err, repositories.ErrInsufficientFunds) {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeInsufficient, err.Error())
+		return
+	}
+	slog.ErrorContext(userContext(r), "Request failed", "error", err)
+	writeError(w, http.StatusInternalServerError, ErrCodeInternal, "internal error")
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"portfolio-investment/metrics"
+	"portfolio-investment/repositories"
+	"portfolio-investment/services"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// HTTP handlers for the portfolio investment API
+type Handler struct {
+	service *services.Service
+	store   *repositories.Store
+	metrics *metrics.Metrics
+}
+
+// PUBLIC: Build handlers on a service, and the store it uses for plain reads, serving the store's metrics
+func NewHandler(service *services.Service, store *repositories.Store) *Handler {
+	return &Handler{service: service, store: store, metrics: store.Metrics()}
+}
+
+// PUBLIC: Build HTTP router for the portfolio investment API
+func NewRouter(h *Handler) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /health", HealthCheck)
+	mux.Handle("GET /metrics", h.metrics.Handler())
+
+	mux.HandleFunc("POST /users/{userReferenceID}/deposits", h.CreateDeposits)
+	mux.HandleFunc("POST /users/{userReferenceID}/deposits/preview", h.PreviewDeposit)
+	mux.HandleFunc("GET /users/{userReferenceID}/transactions/{transactionReferenceID}/allocation-decisions", h.ListAllocationDecisions)
+	mux.HandleFunc("POST /users/{userReferenceID}/withdrawals", h.CreateWithdrawals)
+	mux.HandleFunc("GET /users/{userReferenceID}/portfolios", h.ListUserPortfolios)
+	mux.HandleFunc("GET /users/{userReferenceID}/deposit-plans", h.ListUserDepositPlans)
+	mux.HandleFunc("POST /users/{userReferenceID}/deposit-plans", h.CreateDepositPlan)
+	mux.HandleFunc("PUT /users/{userReferenceID}/deposit-plans/{portfolioReferenceID}/{type}", h.UpdateDepositPlan)
+	mux.HandleFunc("GET /users/{userReferenceID}/totals", h.GetUserTotals)
+	mux.HandleFunc("GET /users/{userReferenceID}/holdings", h.ListUserHoldings)
+	mux.HandleFunc("GET /users/{userReferenceID}/market-value", h.GetUserMarketValue)
+	mux.HandleFunc("GET /users/{userReferenceID}/returns", h.GetUserReturns)
+	mux.HandleFunc("GET /users/{userReferenceID}/rebalance", h.ProposeRebalance)
+	mux.HandleFunc("PUT /users/{userReferenceID}/allocation-strategy", h.SetUserAllocationStrategy)
+
+	mux.HandleFunc("GET /portfolios/{portfolioReferenceID}/assets", h.ListPortfolioAssets)
+	mux.HandleFunc("PUT /portfolios/{portfolioReferenceID}/assets", h.SetPortfolioAssets)
+
+	// Trace requests, continuing the client's trace if the request carries one, except for probes and scrapes
+	return otelhttp.NewHandler(withRequestContext(mux), "http.server", otelhttp.WithFilter(func(r *http.Request) bool {
+		return r.URL.Path != "/health" && r.URL.Path != "/metrics"
+	}))
+}
+
+// PUBLIC: Liveness check
+func HealthCheck(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,736 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/logging"
+	"portfolio-investment/money"
+	"portfolio-investment/prices"
+	"portfolio-investment/repositories"
+	"portfolio-investment/services"
+	"portfolio-investment/strategies"
+	"strconv"
+	"time"
+)
+
+const (
+	maxRequestBodyBytes  = 1 << 20
+	maxReferenceIDLength = 128
+)
+
+type DepositRequest struct {
+	Amounts  []money.Money                  `json:"amounts,omitempty"`
+	Deposits []DepositItemRequest           `json:"deposits,omitempty"`
+	Strategy configs.AllocationStrategyType `json:"strategy,omitempty"`
+}
+
+type DepositItemRequest struct {
+	ReferenceID string      `json:"reference_id"`
+	Amount      money.Money `json:"amount"`
+}
+
+type AllocationStrategyRequest struct {
+	Strategy configs.AllocationStrategyType `json:"strategy"`
+}
+
+type AllocationStrategyResponse struct {
+	UserReferenceID string                         `json:"user_reference_id"`
+	Strategy        configs.AllocationStrategyType `json:"strategy"`
+}
+
+type WithdrawalRequest struct {
+	Amounts              []money.Money `json:"amounts"`
+	PortfolioReferenceID string        `json:"portfolio_reference_id,omitempty"`
+}
+
+type DepositResponse struct {
+	UserReferenceID string                       `json:"user_reference_id"`
+	Portfolios      map[string]money.Money       `json:"portfolios"`
+	Transactions    []DepositTransactionResponse `json:"transactions"`
+}
+
+type DepositTransactionResponse struct {
+	ReferenceID string                    `json:"reference_id"`
+	Amount      money.Money               `json:"amount"`
+	Status      configs.TransactionStatus `json:"status"`
+	Replayed    bool                      `json:"replayed"`
+	Allocations map[string]money.Money    `json:"allocations"`
+	Cash        money.Money               `json:"cash"`
+}
+
+type DepositPreviewRequest struct {
+	Amount   money.Money                    `json:"amount"`
+	Strategy configs.AllocationStrategyType `json:"strategy,omitempty"`
+}
+
+type DepositPreviewResponse struct {
+	UserReferenceID string                          `json:"user_reference_id"`
+	Amount          money.Money                     `json:"amount"`
+	Strategy        configs.AllocationStrategyType  `json:"strategy"`
+	Plans           []PlanAllocationResponse        `json:"plans"`
+	Portfolios      map[string]money.Money          `json:"portfolios"`
+	Steps           map[strategies.Step]money.Money `json:"steps"`
+	Cash            money.Money                     `json:"cash"`
+}
+
+type PlanAllocationResponse struct {
+	Type                 configs.PlanType                `json:"type"`
+	PortfolioReferenceID string                          `json:"portfolio_reference_id"`
+	Amount               money.Money                     `json:"amount"`
+	Steps                map[strategies.Step]money.Money `json:"steps"`
+}
+
+type AllocationDecisionsResponse struct {
+	UserReferenceID string                       `json:"user_reference_id"`
+	ReferenceID     string                       `json:"reference_id"`
+	Amount          money.Money                  `json:"amount"`
+	Status          configs.TransactionStatus    `json:"status"`
+	Decisions       []AllocationDecisionResponse `json:"decisions"`
+}
+
+type AllocationDecisionResponse struct {
+	Sequence             int                            `json:"sequence"`
+	DecidedAt            time.Time                      `json:"decided_at"`
+	Strategy             configs.AllocationStrategyType `json:"strategy"`
+	Step                 string                         `json:"step"`
+	PlanType             configs.PlanType               `json:"plan_type,omitempty"`
+	PortfolioReferenceID string                         `json:"portfolio_reference_id,omitempty"`
+	PlanAmount           money.Money                    `json:"plan_amount"`
+	PlanContributed      money.Money                    `json:"plan_contributed"`
+	PortfolioFund        money.Money                    `json:"portfolio_fund"`
+	Weight               int64                          `json:"weight"`
+	TotalWeight          int64                          `json:"total_weight"`
+	Ratio                float64                        `json:"ratio"`
+	Amount               money.Money                    `json:"amount"`
+	RemainingBefore      money.Money                    `json:"remaining_before"`
+	RemainingAfter       money.Money                    `json:"remaining_after"`
+}
+
+type WithdrawalResponse struct {
+	UserReferenceID string                 `json:"user_reference_id"`
+	Portfolios      map[string]money.Money `json:"portfolios"`
+}
+
+type PortfolioResponse struct {
+	ReferenceID string      `json:"reference_id"`
+	Name        string      `json:"name"`
+	Fund        money.Money `json:"fund"`
+}
+
+type DepositPlanResponse struct {
+	Type                 configs.PlanType `json:"type"`
+	PortfolioReferenceID string           `json:"portfolio_reference_id"`
+	PortfolioName        string           `json:"portfolio_name"`
+	Amount               money.Money      `json:"amount"`
+}
+
+type DepositPlanRequest struct {
+	Type                 configs.PlanType `json:"type"`
+	PortfolioReferenceID string           `json:"portfolio_reference_id"`
+	Amount               money.Money      `json:"amount"`
+}
+
+type DepositPlanAmountRequest struct {
+	Amount money.Money `json:"amount"`
+}
+
+type TotalsResponse struct {
+	UserReferenceID string                 `json:"user_reference_id"`
+	Total           money.Money            `json:"total"`
+	Cash            money.Money            `json:"cash"`
+	Portfolios      map[string]money.Money `json:"portfolios"`
+}
+
+type MarketValueResponse struct {
+	UserReferenceID string                 `json:"user_reference_id"`
+	Date            string                 `json:"date"`
+	Total           money.Money            `json:"total"`
+	Portfolios      map[string]money.Money `json:"portfolios"`
+}
+
+type ReturnResponse struct {
+	StartValue    money.Money `json:"start_value"`
+	EndValue      money.Money `json:"end_value"`
+	NetCashFlow   money.Money `json:"net_cash_flow"`
+	TimeWeighted  float64     `json:"time_weighted"`
+	MoneyWeighted *float64    `json:"money_weighted"`
+}
+
+type ReturnsResponse struct {
+	UserReferenceID string                    `json:"user_reference_id"`
+	From            string                    `json:"from"`
+	To              string                    `json:"to"`
+	Total           ReturnResponse            `json:"total"`
+	Portfolios      map[string]ReturnResponse `json:"portfolios"`
+}
+
+type RebalanceOrderResponse struct {
+	AssetID uint        `json:"asset_id"`
+	Side    string      `json:"side"`
+	Amount  money.Money `json:"amount"`
+}
+
+type RebalanceResponse struct {
+	PortfolioReferenceID string                   `json:"portfolio_reference_id"`
+	Value                money.Money              `json:"value"`
+	Drift                map[uint]int             `json:"drift_bps"`
+	Orders               []RebalanceOrderResponse `json:"orders"`
+}
+
+type HoldingResponse struct {
+	PortfolioReferenceID string      `json:"portfolio_reference_id"`
+	AssetID              uint        `json:"asset_id"`
+	AssetName            string      `json:"asset_name"`
+	AssetClass           string      `json:"asset_class"`
+	Amount               money.Money `json:"amount"`
+}
+
+// PRIVATE: Validate that amounts are present and positive
+func validateAmounts(amounts []money.Money) error {
+	if len(amounts) == 0 {
+		return fmt.Errorf("amounts must contain at least one value")
+	}
+	for i, amount := range amounts {
+		if amount <= 0 {
+			return fmt.Errorf("amounts[%d] must be a positive number", i)
+		}
+	}
+	return nil
+}
+
+// PRIVATE: Build deposit transaction requests from either plain amounts or keyed deposits
+func depositRequests(req *DepositRequest) ([]repositories.TransactionRequest, error) {
+	if len(req.Amounts) > 0 && len(req.Deposits) > 0 {
+		return nil, fmt.Errorf("only one of amounts or deposits may be given")
+	}
+	if len(req.Deposits) == 0 {
+		if err := validateAmounts(req.Amounts); err != nil {
+			return nil, err
+		}
+		return repositories.NewTransactionRequests(req.Amounts), nil
+	}
+
+	requests := make([]repositories.TransactionRequest, 0, len(req.Deposits))
+	for i, deposit := range req.Deposits {
+		if deposit.ReferenceID == "" || len(deposit.ReferenceID) > maxReferenceIDLength {
+			return nil, fmt.Errorf("deposits[%d].reference_id must be 1 to %d characters", i, maxReferenceIDLength)
+		}
+		if deposit.Amount <= 0 {
+			return nil, fmt.Errorf("deposits[%d].amount must be a positive number", i)
+		}
+		requests = append(requests, repositories.TransactionRequest{
+			ReferenceID: deposit.ReferenceID,
+			Amount:      deposit.Amount,
+		})
+	}
+	return requests, nil
+}
+
+// PRIVATE: Validate deposit plan type and amount
+func validatePlan(planType configs.PlanType, amount money.Money) error {
+	switch planType {
+	case configs.PlanTypeOnceTime, configs.PlanTypeMonthly:
+	default:
+		return fmt.Errorf("type must be one of: %s, %s", configs.PlanTypeOnceTime, configs.PlanTypeMonthly)
+	}
+	if amount < 0 {
+		return fmt.Errorf("amount must not be negative")
+	}
+	return nil
+}
+
+// PRIVATE: Build deposit plan response
+func newDepositPlanResponse(plan *database.UserDepositPlan) DepositPlanResponse {
+	return DepositPlanResponse{
+		Type:                 plan.Type,
+		PortfolioReferenceID: plan.Portfolio.ReferenceID,
+		PortfolioName:        plan.Portfolio.Name,
+		Amount:               plan.Amount,
+	}
+}
+
+// PRIVATE: Request context, also carrying the user reference ID from the path for logs
+func userContext(r *http.Request) context.Context {
+	return logging.WithUserID(r.Context(), r.PathValue("userReferenceID"))
+}
+
+// PRIVATE: Decode JSON request body, rejecting unknown fields
+func decodeJSON(w http.ResponseWriter, r *http.Request, value any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+	return nil
+}
+
+// PUBLIC: Submit deposits for a user
+func (h *Handler) CreateDeposits(w http.ResponseWriter, r *http.Request) {
+	ctx := userContext(r)
+	userReferenceID := r.PathValue("userReferenceID")
+
+	var req DepositRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	requests, err := depositRequests(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if _, err := strategies.Get(req.Strategy); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	results, err := h.service.ProcessDeposits(&ctx, userReferenceID, requests, req.Strategy)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	// Replaying every deposit creates nothing
+	status := http.StatusOK
+	transactions := make([]DepositTransactionResponse, 0, len(results.Transactions))
+	for _, transaction := range results.Transactions {
+		if !transaction.Replayed {
+			status = http.StatusCreated
+		}
+		transactions = append(transactions, DepositTransactionResponse{
+			ReferenceID: transaction.ReferenceID,
+			Amount:      transaction.Amount,
+			Status:      transaction.Status,
+			Replayed:    transaction.Replayed,
+			Allocations: transaction.Allocations,
+			Cash:        transaction.Cash,
+		})
+	}
+
+	writeJSON(w, status, DepositResponse{
+		UserReferenceID: userReferenceID,
+		Portfolios:      results.Portfolios,
+		Transactions:    transactions,
+	})
+}
+
+// PUBLIC: Preview how a deposit would be allocated for a user, without making it
+func (h *Handler) PreviewDeposit(w http.ResponseWriter, r *http.Request) {
+	ctx := userContext(r)
+	userReferenceID := r.PathValue("userReferenceID")
+
+	var req DepositPreviewRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if req.Amount <= 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "amount must be a positive number")
+		return
+	}
+	if _, err := strategies.Get(req.Strategy); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	preview, err := h.service.PreviewDeposit(&ctx, userReferenceID, req.Amount, req.Strategy)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	plans := make([]PlanAllocationResponse, 0, len(preview.Plans))
+	for _, plan := range preview.Plans {
+		plans = append(plans, PlanAllocationResponse{
+			Type:                 plan.Plan.Type,
+			PortfolioReferenceID: plan.Plan.Portfolio.ReferenceID,
+			Amount:               plan.Amount,
+			Steps:                plan.Steps,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, DepositPreviewResponse{
+		UserReferenceID: userReferenceID,
+		Amount:          preview.Amount,
+		Strategy:        preview.Strategy,
+		Plans:           plans,
+		Portfolios:      preview.Portfolios,
+		Steps:           preview.Steps,
+		Cash:            preview.Cash,
+	})
+}
+
+// PUBLIC: Explain how a user's deposit transaction was allocated, decision by decision
+func (h *Handler) ListAllocationDecisions(w http.ResponseWriter, r *http.Request) {
+	ctx := userContext(r)
+	userReferenceID := r.PathValue("userReferenceID")
+	transactionReferenceID := r.PathValue("transactionReferenceID")
+
+	transaction, decisions, err := h.service.GetAllocationDecisions(&ctx, userReferenceID, transactionReferenceID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	response := AllocationDecisionsResponse{
+		UserReferenceID: userReferenceID,
+		ReferenceID:     transaction.ReferenceID,
+		Amount:          transaction.Amount,
+		Status:          transaction.Status,
+		Decisions:       make([]AllocationDecisionResponse, 0, len(decisions)),
+	}
+	for _, decision := range decisions {
+		portfolioReferenceID := ""
+		if decision.Portfolio != nil {
+			portfolioReferenceID = decision.Portfolio.ReferenceID
+		}
+		response.Decisions = append(response.Decisions, AllocationDecisionResponse{
+			Sequence:             decision.Sequence,
+			DecidedAt:            decision.CreatedAt,
+			Strategy:             decision.Strategy,
+			Step:                 decision.Step,
+			PlanType:             decision.PlanType,
+			PortfolioReferenceID: portfolioReferenceID,
+			PlanAmount:           decision.PlanAmount,
+			PlanContributed:      decision.PlanContributed,
+			PortfolioFund:        decision.PortfolioFund,
+			Weight:               decision.Weight,
+			TotalWeight:          decision.TotalWeight,
+			Ratio:                decision.Ratio,
+			Amount:               decision.Amount,
+			RemainingBefore:      decision.RemainingBefore,
+			RemainingAfter:       decision.RemainingAfter,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// PUBLIC: Submit withdrawals for a user, from one portfolio or pro-rata across all
+func (h *Handler) CreateWithdrawals(w http.ResponseWriter, r *http.Request) {
+	ctx := userContext(r)
+	userReferenceID := r.PathValue("userReferenceID")
+
+	var req WithdrawalRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if err := validateAmounts(req.Amounts); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	results, err := h.service.ProcessWithdrawals(&ctx, userReferenceID, req.PortfolioReferenceID, req.Amounts)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, WithdrawalResponse{
+		UserReferenceID: userReferenceID,
+		Portfolios:      results,
+	})
+}
+
+// PUBLIC: Set user's default allocation strategy
+func (h *Handler) SetUserAllocationStrategy(w http.ResponseWriter, r *http.Request) {
+	ctx := userContext(r)
+	userReferenceID := r.PathValue("userReferenceID")
+
+	var req AllocationStrategyRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	strategy, err := strategies.Get(req.Strategy)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	user, err := h.store.SetUserAllocationStrategy(&ctx, userReferenceID, strategy.Type())
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, AllocationStrategyResponse{
+		UserReferenceID: user.ReferenceID,
+		Strategy:        user.AllocationStrategy,
+	})
+}
+
+// PUBLIC: List user's portfolios with current funds
+func (h *Handler) ListUserPortfolios(w http.ResponseWriter, r *http.Request) {
+	ctx := userContext(r)
+	userReferenceID := r.PathValue("userReferenceID")
+
+	userPortfolios, err := h.store.GetUserPortfolios(&ctx, userReferenceID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	response := make([]PortfolioResponse, 0, len(userPortfolios))
+	for _, userPortfolio := range userPortfolios {
+		response = append(response, PortfolioResponse{
+			ReferenceID: userPortfolio.Portfolio.ReferenceID,
+			Name:        userPortfolio.Portfolio.Name,
+			Fund:        userPortfolio.Fund,
+		})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// PUBLIC: List user's deposit plans
+func (h *Handler) ListUserDepositPlans(w http.ResponseWriter, r *http.Request) {
+	ctx := userContext(r)
+	userReferenceID := r.PathValue("userReferenceID")
+
+	plans, err := h.store.GetUserDepositPlans(&ctx, userReferenceID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	response := make([]DepositPlanResponse, 0, len(plans))
+	for _, plan := range plans {
+		response = append(response, newDepositPlanResponse(&plan))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// PUBLIC: Add a deposit plan for a user; unallocated cash is swept into plans
+func (h *Handler) CreateDepositPlan(w http.ResponseWriter, r *http.Request) {
+	ctx := userContext(r)
+	userReferenceID := r.PathValue("userReferenceID")
+
+	var req DepositPlanRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if err := validatePlan(req.Type, req.Amount); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	plan, err := h.service.AddDepositPlan(&ctx, userReferenceID, req.PortfolioReferenceID, req.Type, req.Amount)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newDepositPlanResponse(plan))
+}
+
+// PUBLIC: Update a deposit plan's amount; topping up sweeps unallocated cash into plans
+func (h *Handler) UpdateDepositPlan(w http.ResponseWriter, r *http.Request) {
+	ctx := userContext(r)
+	userReferenceID := r.PathValue("userReferenceID")
+	portfolioReferenceID := r.PathValue("portfolioReferenceID")
+	planType := configs.PlanType(r.PathValue("type"))
+
+	var req DepositPlanAmountRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if err := validatePlan(planType, req.Amount); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	plan, err := h.service.UpdateDepositPlan(&ctx, userReferenceID, portfolioReferenceID, planType, req.Amount)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newDepositPlanResponse(plan))
+}
+
+// PUBLIC: Get user's total funds, overall and per portfolio
+func (h *Handler) GetUserTotals(w http.ResponseWriter, r *http.Request) {
+	ctx := userContext(r)
+	userReferenceID := r.PathValue("userReferenceID")
+
+	total, err := h.service.GetUserTotalFunds(&ctx, userReferenceID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	portfolios, err := h.service.GetPortfolioTotalFunds(&ctx, userReferenceID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	cash, err := h.store.GetUserCash(&ctx, userReferenceID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, TotalsResponse{
+		UserReferenceID: userReferenceID,
+		Total:           total,
+		Cash:            cash,
+		Portfolios:      portfolios,
+	})
+}
+
+// PUBLIC: List user's holdings per portfolio and asset
+func (h *Handler) ListUserHoldings(w http.ResponseWriter, r *http.Request) {
+	ctx := userContext(r)
+	userReferenceID := r.PathValue("userReferenceID")
+
+	holdings, err := h.store.GetUserHoldings(&ctx, userReferenceID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	response := make([]HoldingResponse, 0, len(holdings))
+	for _, holding := range holdings {
+		response = append(response, HoldingResponse{
+			PortfolioReferenceID: holding.UserPortfolio.Portfolio.ReferenceID,
+			AssetID:              holding.AssetID,
+			AssetName:            holding.Asset.Name,
+			AssetClass:           holding.Asset.Class,
+			Amount:               holding.Amount,
+		})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// PUBLIC: Get market value of user's portfolios at the close of a day (`?date=YYYY-MM-DD`, today by default)
+func (h *Handler) GetUserMarketValue(w http.ResponseWriter, r *http.Request) {
+	ctx := userContext(r)
+	userReferenceID := r.PathValue("userReferenceID")
+
+	day := prices.Day(time.Now())
+	if date := r.URL.Query().Get("date"); date != "" {
+		parsed, err := time.Parse(prices.DateLayout, date)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "date must be formatted as YYYY-MM-DD")
+			return
+		}
+		day = parsed
+	}
+
+	portfolios, err := h.service.GetPortfolioMarketValues(&ctx, userReferenceID, day)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	values := make([]money.Money, 0, len(portfolios))
+	for _, value := range portfolios {
+		values = append(values, value)
+	}
+
+	writeJSON(w, http.StatusOK, MarketValueResponse{
+		UserReferenceID: userReferenceID,
+		Date:            day.Format(prices.DateLayout),
+		Total:           money.Sum(values...),
+		Portfolios:      portfolios,
+	})
+}
+
+// PUBLIC: Get time-weighted and money-weighted returns of user's portfolios over a range of days
+// (`?from=YYYY-MM-DD&to=YYYY-MM-DD`); to is today by default, and from a year before to
+func (h *Handler) GetUserReturns(w http.ResponseWriter, r *http.Request) {
+	ctx := userContext(r)
+	userReferenceID := r.PathValue("userReferenceID")
+
+	to := prices.Day(time.Now())
+	if date := r.URL.Query().Get("to"); date != "" {
+		parsed, err := time.Parse(prices.DateLayout, date)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "to must be formatted as YYYY-MM-DD")
+			return
+		}
+		to = parsed
+	}
+	from := to.AddDate(-1, 0, 0)
+	if date := r.URL.Query().Get("from"); date != "" {
+		parsed, err := time.Parse(prices.DateLayout, date)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "from must be formatted as YYYY-MM-DD")
+			return
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "from must not be after to")
+		return
+	}
+
+	results, err := h.service.GetReturns(&ctx, userReferenceID, from, to)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	response := ReturnsResponse{
+		UserReferenceID: userReferenceID,
+		From:            from.Format(prices.DateLayout),
+		To:              to.Format(prices.DateLayout),
+		Total:           newReturnResponse(&results.User),
+		Portfolios:      make(map[string]ReturnResponse, len(results.Portfolios)),
+	}
+	for portfolioReferenceID, result := range results.Portfolios {
+		response.Portfolios[portfolioReferenceID] = newReturnResponse(&result)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// PRIVATE: Build return response from a service return
+func newReturnResponse(result *services.Return) ReturnResponse {
+	return ReturnResponse{
+		StartValue:    result.StartValue,
+		EndValue:      result.EndValue,
+		NetCashFlow:   result.NetCashFlow,
+		TimeWeighted:  result.TimeWeighted,
+		MoneyWeighted: result.MoneyWeighted,
+	}
+}
+
+// PUBLIC: Propose trades restoring target asset weights of user's portfolios; nothing is traded
+// Assets may drift from their target weights by `?tolerance_bps=` (the configured tolerance by default) either way
+func (h *Handler) ProposeRebalance(w http.ResponseWriter, r *http.Request) {
+	ctx := userContext(r)
+	userReferenceID := r.PathValue("userReferenceID")
+
+	tolerance := -1
+	if value := r.URL.Query().Get("tolerance_bps"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || parsed > database.FullWeight {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest,
+				fmt.Sprintf("tolerance_bps must be a whole number from 0 to %d", database.FullWeight))
+			return
+		}
+		tolerance = parsed
+	}
+
+	proposals, err := h.service.ProposeRebalance(&ctx, userReferenceID, tolerance)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	response := make([]RebalanceResponse, 0, len(proposals))
+	for _, proposal := range proposals {
+		orders := make([]RebalanceOrderResponse, 0, len(proposal.Orders))
+		for _, order := range proposal.Orders {
+			orders = append(orders, RebalanceOrderResponse{AssetID: order.AssetID, Side: string(order.Side), Amount: order.Amount})
+		}
+		response = append(response, RebalanceResponse{
+			PortfolioReferenceID: proposal.PortfolioReferenceID,
+			Value:                proposal.Value,
+			Drift:                proposal.Drift,
+			Orders:               orders,
+		})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
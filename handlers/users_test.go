@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"portfolio-investment/database/dbtest"
+	"portfolio-investment/metrics"
+	"portfolio-investment/repositories"
+	"portfolio-investment/services"
+	"portfolio-investment/tracing/tracingtest"
+	"strings"
+	"testing"
+)
+
+func TestUserEndpoints(t *testing.T) {
+	db, config := dbtest.New(t)
+	store := repositories.NewStore(db, config, metrics.New())
+	router := NewRouter(NewHandler(services.NewService(store), store))
+	userReferenceID := "user-123"
+
+	var tests = []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"Health check", http.MethodGet, "/health", "", http.StatusOK},
+		{"Metrics", http.MethodGet, "/metrics", "", http.StatusOK},
+		{"List portfolios", http.MethodGet, "/users/" + userReferenceID + "/portfolios", "", http.StatusOK},
+		{"List deposit plans", http.MethodGet, "/users/" + userReferenceID + "/deposit-plans", "", http.StatusOK},
+		{"Get totals", http.MethodGet, "/users/" + userReferenceID + "/totals", "", http.StatusOK},
+		{"Get totals for unknown user", http.MethodGet, "/users/unknown-user/totals", "", http.StatusNotFound},
+		{"Deposit valid amounts", http.MethodPost, "/users/" + userReferenceID + "/deposits", `{"amounts":[10500,100]}`, http.StatusCreated},
+		{"Deposit for unknown user", http.MethodPost, "/users/unknown-user/deposits", `{"amounts":[100]}`, http.StatusNotFound},
+		{"Deposit empty amounts", http.MethodPost, "/users/" + userReferenceID + "/deposits", `{"amounts":[]}`, http.StatusBadRequest},
+		{"Deposit negative amount", http.MethodPost, "/users/" + userReferenceID + "/deposits", `{"amounts":[100,-1]}`, http.StatusBadRequest},
+		{"Deposit unknown field", http.MethodPost, "/users/" + userReferenceID + "/deposits", `{"amount":100}`, http.StatusBadRequest},
+		{"Deposit with reference ID", http.MethodPost, "/users/" + userReferenceID + "/deposits", `{"deposits":[{"reference_id":"webhook-1","amount":25}]}`, http.StatusCreated},
+		{"Replay deposit reference ID", http.MethodPost, "/users/" + userReferenceID + "/deposits", `{"deposits":[{"reference_id":"webhook-1","amount":25}]}`, http.StatusOK},
+		{"Reuse deposit reference ID with different amount", http.MethodPost, "/users/" + userReferenceID + "/deposits", `{"deposits":[{"reference_id":"webhook-1","amount":30}]}`, http.StatusConflict},
+		{"Deposit with empty reference ID", http.MethodPost, "/users/" + userReferenceID + "/deposits", `{"deposits":[{"reference_id":"","amount":25}]}`, http.StatusBadRequest},
+		{"Deposit with both amounts and deposits", http.MethodPost, "/users/" + userReferenceID + "/deposits", `{"amounts":[25],"deposits":[{"reference_id":"webhook-2","amount":25}]}`, http.StatusBadRequest},
+		{"Preview deposit", http.MethodPost, "/users/" + userReferenceID + "/deposits/preview", `{"amount":10500}`, http.StatusOK},
+		{"Preview deposit for unknown user", http.MethodPost, "/users/unknown-user/deposits/preview", `{"amount":100}`, http.StatusNotFound},
+		{"Preview deposit of zero", http.MethodPost, "/users/" + userReferenceID + "/deposits/preview", `{"amount":0}`, http.StatusBadRequest},
+		{"Preview deposit with unknown strategy", http.MethodPost, "/users/" + userReferenceID + "/deposits/preview", `{"amount":100,"strategy":"unknown"}`, http.StatusBadRequest},
+		{"List allocation decisions", http.MethodGet, "/users/" + userReferenceID + "/transactions/webhook-1/allocation-decisions", "", http.StatusOK},
+		{"List allocation decisions of unknown transaction", http.MethodGet, "/users/" + userReferenceID + "/transactions/unknown/allocation-decisions", "", http.StatusNotFound},
+		{"List allocation decisions of another user's transaction", http.MethodGet, "/users/user-456/transactions/webhook-1/allocation-decisions", "", http.StatusNotFound},
+		{"Withdraw valid amount", http.MethodPost, "/users/" + userReferenceID + "/withdrawals", `{"amounts":[50]}`, http.StatusCreated},
+		{"Withdraw more than available", http.MethodPost, "/users/" + userReferenceID + "/withdrawals", `{"amounts":[99999999999]}`, http.StatusUnprocessableEntity},
+		{"Withdraw from unknown portfolio", http.MethodPost, "/users/" + userReferenceID + "/withdrawals", `{"amounts":[1],"portfolio_reference_id":"unknown"}`, http.StatusNotFound},
+		{"Deposit with strategy", http.MethodPost, "/users/" + userReferenceID + "/deposits", `{"amounts":[100],"strategy":"pro-rata"}`, http.StatusCreated},
+		{"Deposit with unknown strategy", http.MethodPost, "/users/" + userReferenceID + "/deposits", `{"amounts":[100],"strategy":"unknown"}`, http.StatusBadRequest},
+		{"Set allocation strategy", http.MethodPut, "/users/" + userReferenceID + "/allocation-strategy", `{"strategy":"target-weight"}`, http.StatusOK},
+		{"Set unknown allocation strategy", http.MethodPut, "/users/" + userReferenceID + "/allocation-strategy", `{"strategy":"unknown"}`, http.StatusBadRequest},
+		{"Add deposit plan", http.MethodPost, "/users/" + userReferenceID + "/deposit-plans", `{"type":"monthly","portfolio_reference_id":"portfolio-low-risk","amount":50}`, http.StatusCreated},
+		{"Add duplicate deposit plan", http.MethodPost, "/users/" + userReferenceID + "/deposit-plans", `{"type":"monthly","portfolio_reference_id":"portfolio-low-risk","amount":50}`, http.StatusConflict},
+		{"Add deposit plan with invalid type", http.MethodPost, "/users/" + userReferenceID + "/deposit-plans", `{"type":"weekly","portfolio_reference_id":"portfolio-low-risk","amount":50}`, http.StatusBadRequest},
+		{"Add deposit plan for unknown portfolio", http.MethodPost, "/users/" + userReferenceID + "/deposit-plans", `{"type":"monthly","portfolio_reference_id":"unknown","amount":50}`, http.StatusNotFound},
+		{"Update deposit plan", http.MethodPut, "/users/" + userReferenceID + "/deposit-plans/portfolio-low-risk/monthly", `{"amount":75}`, http.StatusOK},
+		{"Update unknown deposit plan", http.MethodPut, "/users/" + userReferenceID + "/deposit-plans/portfolio-low-risk/onetime", `{"amount":75}`, http.StatusNotFound},
+		{"List holdings", http.MethodGet, "/users/" + userReferenceID + "/holdings", "", http.StatusOK},
+		{"List holdings for unknown user", http.MethodGet, "/users/unknown-user/holdings", "", http.StatusNotFound},
+		{"Get market value", http.MethodGet, "/users/" + userReferenceID + "/market-value", "", http.StatusOK},
+		{"Get market value on a date", http.MethodGet, "/users/" + userReferenceID + "/market-value?date=2025-01-03", "", http.StatusOK},
+		{"Get market value on an invalid date", http.MethodGet, "/users/" + userReferenceID + "/market-value?date=03/01/2025", "", http.StatusBadRequest},
+		{"Get market value for unknown user", http.MethodGet, "/users/unknown-user/market-value", "", http.StatusNotFound},
+		{"Get returns", http.MethodGet, "/users/" + userReferenceID + "/returns", "", http.StatusOK},
+		{"Get returns over a range", http.MethodGet, "/users/" + userReferenceID + "/returns?from=2025-01-01&to=2025-01-31", "", http.StatusOK},
+		{"Get returns over a reversed range", http.MethodGet, "/users/" + userReferenceID + "/returns?from=2025-02-01&to=2025-01-01", "", http.StatusBadRequest},
+		{"Get returns over too long a range", http.MethodGet, "/users/" + userReferenceID + "/returns?from=2015-01-01&to=2025-01-01", "", http.StatusBadRequest},
+		{"Get returns from an invalid date", http.MethodGet, "/users/" + userReferenceID + "/returns?from=01/01/2025", "", http.StatusBadRequest},
+		{"Get returns for unknown user", http.MethodGet, "/users/unknown-user/returns", "", http.StatusNotFound},
+		{"Propose rebalance", http.MethodGet, "/users/" + userReferenceID + "/rebalance", "", http.StatusOK},
+		{"Propose rebalance with tolerance", http.MethodGet, "/users/" + userReferenceID + "/rebalance?tolerance_bps=100", "", http.StatusOK},
+		{"Propose rebalance with invalid tolerance", http.MethodGet, "/users/" + userReferenceID + "/rebalance?tolerance_bps=-1", "", http.StatusBadRequest},
+		{"Propose rebalance for unknown user", http.MethodGet, "/users/unknown-user/rebalance", "", http.StatusNotFound},
+		{"List portfolio assets", http.MethodGet, "/portfolios/portfolio-low-risk/assets", "", http.StatusOK},
+		{"List assets of unknown portfolio", http.MethodGet, "/portfolios/unknown/assets", "", http.StatusNotFound},
+		{"Set portfolio assets", http.MethodPut, "/portfolios/portfolio-low-risk/assets", `{"assets":[{"asset_id":5,"weight_bps":5000},{"asset_id":6,"weight_bps":5000}]}`, http.StatusOK},
+		{"Set portfolio assets not summing to 100%", http.MethodPut, "/portfolios/portfolio-low-risk/assets", `{"assets":[{"asset_id":5,"weight_bps":5000}]}`, http.StatusUnprocessableEntity},
+		{"Set portfolio assets without asset ID", http.MethodPut, "/portfolios/portfolio-low-risk/assets", `{"assets":[{"weight_bps":10000}]}`, http.StatusBadRequest},
+		{"Set unknown portfolio assets", http.MethodPut, "/portfolios/portfolio-low-risk/assets", `{"assets":[{"asset_id":9999,"weight_bps":10000}]}`, http.StatusNotFound},
+		{"Deposit malformed JSON", http.MethodPost, "/users/" + userReferenceID + "/deposits", `{"amounts":`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("❌ Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if rec.Header().Get(RequestIDHeader) == "" {
+				t.Errorf("❌ Expected a generated %s header", RequestIDHeader)
+			}
+			if rec.Code >= 400 {
+				var body ErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error.Code == "" {
+					t.Errorf("❌ Expected consistent error body, got %s", rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	router := NewRouter(&Handler{})
+
+	var tests = []struct {
+		name      string
+		requestID string
+		generated bool
+	}{
+		{"Test client request ID kept", "request-42", false},
+		{"Test missing request ID generated", "", true},
+		{"Test oversized request ID replaced", strings.Repeat("x", maxReferenceIDLength+1), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			req.Header.Set(RequestIDHeader, tt.requestID)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			requestID := rec.Header().Get(RequestIDHeader)
+			if requestID == "" || (requestID == tt.requestID) == tt.generated {
+				t.Errorf("❌ Expected request ID generated: %v, got %q", tt.generated, requestID)
+			} else {
+				t.Logf("✅ Request ID %s", requestID)
+			}
+		})
+	}
+}
+
+func TestTracePropagation(t *testing.T) {
+	recorder := tracingtest.New(t)
+	db, config := dbtest.New(t)
+	store := repositories.NewStore(db, config, nil)
+	router := NewRouter(NewHandler(services.NewService(store), store))
+
+	// Migrating and seeding the test database ran in traces of their own
+	recorder.Reset()
+
+	const traceID, parentSpanID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req := httptest.NewRequest(http.MethodPost, "/users/user-123/deposits", bytes.NewBufferString(`{"amounts":[100]}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("❌ Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	spans := tracingtest.Spans(recorder)
+	server := spans["POST /users/{userReferenceID}/deposits"]
+	if server == nil || server.Parent().SpanID().String() != parentSpanID || spans["services.ProcessDeposits"] == nil {
+		t.Fatalf("❌ Expected request span under the client's span, and service spans, got %d spans", len(spans))
+	}
+	for name, span := range spans {
+		if span.SpanContext().TraceID().String() != traceID {
+			t.Errorf("❌ Expected %s in trace %s, got %s", name, traceID, span.SpanContext().TraceID())
+		}
+	}
+	t.Logf("✅ %d spans in the client's trace", len(spans))
+}
+
+func TestInternalErrorHidden(t *testing.T) {
+	db, config := dbtest.New(t)
+	store := repositories.NewStore(db, config, nil)
+	router := NewRouter(NewHandler(services.NewService(store), store))
+
+	// Every query fails once the database is closed
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("DB failed: %v", err)
+	}
+	sqlDB.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/users/user-123/totals", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var body ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("❌ Expected error body, got %s", rec.Body.String())
+	}
+	if rec.Code != http.StatusInternalServerError || body.Error.Code != ErrCodeInternal || body.Error.Message != "internal error" {
+		t.Errorf("❌ Expected generic internal error, got %d: %s", rec.Code, rec.Body.String())
+	} else {
+		t.Logf("✅ Internal error hidden: %s", body.Error.Message)
+	}
+}
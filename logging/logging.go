@@ -0,0 +1,118 @@
+// Structured logging with slog: handlers from app config, IDs carried by context, and redaction of sensitive fields
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"portfolio-investment/configs"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Keys of the IDs added to every record logged with a context carrying them, or carrying a recorded span
+const (
+	RequestIDKey     = "request_id"
+	UserIDKey        = "user_id"
+	TransactionIDKey = "transaction_id"
+	TraceIDKey       = "trace_id"
+	SpanIDKey        = "span_id"
+)
+
+// Logged in place of a sensitive value
+const Redacted = "[REDACTED]"
+
+// Attributes whose key contains any of these (case-insensitive) are redacted
+var sensitiveKeys = []string{"password", "secret", "token", "authorization", "cookie", "dsn"}
+
+type contextKey string
+
+// Context keys, in the order their IDs are added to records
+var contextKeys = []string{RequestIDKey, UserIDKey, TransactionIDKey}
+
+// PUBLIC: Build logger writing to w, in the configured format and from the configured level
+func New(w io.Writer, config *configs.AppConfig) *slog.Logger {
+	options := &slog.HandlerOptions{Level: config.LogLevel, ReplaceAttr: redact}
+
+	var handler slog.Handler
+	switch config.LogFormat {
+	case configs.LogFormatJSON:
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		handler = slog.NewTextHandler(w, options)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+// PUBLIC: Log error with the default logger and exit, like log.Fatal
+func Fatal(message string, args ...any) {
+	slog.Error(message, args...)
+	os.Exit(1)
+}
+
+// PUBLIC: Context carrying the ID of the request being served
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return withID(ctx, RequestIDKey, requestID)
+}
+
+// PUBLIC: Context carrying the reference ID of the user being served
+func WithUserID(ctx context.Context, userReferenceID string) context.Context {
+	return withID(ctx, UserIDKey, userReferenceID)
+}
+
+// PUBLIC: Context carrying the reference ID of the transaction being processed
+func WithTransactionID(ctx context.Context, transactionReferenceID string) context.Context {
+	return withID(ctx, TransactionIDKey, transactionReferenceID)
+}
+
+// PUBLIC: Get ID of the request being served, if any
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(contextKey(RequestIDKey)).(string)
+	return requestID
+}
+
+// PRIVATE: Context carrying an ID, unless it is empty
+func withID(ctx context.Context, key string, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey(key), id)
+}
+
+// PRIVATE: Replace values of sensitive attributes, whatever the handler
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	for _, sensitiveKey := range sensitiveKeys {
+		if strings.Contains(key, sensitiveKey) {
+			return slog.String(attr.Key, Redacted)
+		}
+	}
+	return attr
+}
+
+// Adds the IDs carried by the context, and its span's trace and span IDs, to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	for _, key := range contextKeys {
+		if id, ok := ctx.Value(contextKey(key)).(string); ok {
+			record.AddAttrs(slog.String(key, id))
+		}
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(slog.String(TraceIDKey, spanContext.TraceID().String()), slog.String(SpanIDKey, spanContext.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"portfolio-investment/configs"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLogger(t *testing.T) {
+	ctx := WithTransactionID(WithUserID(WithRequestID(context.Background(), "request-1"), "user-123"), "payment-42")
+
+	var tests = []struct {
+		name     string
+		level    slog.Level
+		log      func(logger *slog.Logger)
+		expected map[string]any // Nil when nothing should be logged
+	}{
+		{"Test context IDs added", slog.LevelInfo, func(logger *slog.Logger) {
+			logger.InfoContext(ctx, "Deposit allocated", "amount", 100)
+		}, map[string]any{"msg": "Deposit allocated", "amount": 100.0,
+			RequestIDKey: "request-1", UserIDKey: "user-123", TransactionIDKey: "payment-42"}},
+		{"Test trace IDs added", slog.LevelInfo, func(logger *slog.Logger) {
+			logger.InfoContext(trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID: trace.TraceID{0x4b, 0xf9}, SpanID: trace.SpanID{0x00, 0xf0}, TraceFlags: trace.FlagsSampled,
+			})), "Deposit allocated")
+		}, map[string]any{"msg": "Deposit allocated",
+			TraceIDKey: "4bf90000000000000000000000000000", SpanIDKey: "00f0000000000000"}},
+		{"Test sensitive fields redacted", slog.LevelInfo, func(logger *slog.Logger) {
+			logger.Info("Connecting", "db_dsn", "postgres://app:hunter2@db/portfolio", "Password", "hunter2", "api_token", "t0k3n")
+		}, map[string]any{"msg": "Connecting", "db_dsn": Redacted, "Password": Redacted, "api_token": Redacted}},
+		{"Test sensitive fields redacted in groups", slog.LevelInfo, func(logger *slog.Logger) {
+			logger.WithGroup("request").Info("Headers", "authorization", "Bearer t0k3n")
+		}, map[string]any{"msg": "Headers", "request": map[string]any{"authorization": Redacted}}},
+		{"Test below level not logged", slog.LevelWarn, func(logger *slog.Logger) {
+			logger.InfoContext(ctx, "Deposit allocated")
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			tt.log(New(&buffer, &configs.AppConfig{LogFormat: configs.LogFormatJSON, LogLevel: tt.level}))
+
+			if tt.expected == nil {
+				if buffer.Len() > 0 {
+					t.Errorf("❌ Expected nothing logged, got %s", buffer.String())
+				}
+				return
+			}
+			var record map[string]any
+			if err := json.Unmarshal(buffer.Bytes(), &record); err != nil {
+				t.Fatalf("❌ Expected a JSON record, got %q: %v", buffer.String(), err)
+			}
+			for key, value := range tt.expected {
+				if actual, _ := json.Marshal(record[key]); string(actual) != mustMarshal(t, value) {
+					t.Errorf("❌ Expected %s to be %v, got %v", key, value, record[key])
+				}
+			}
+			if strings.Contains(buffer.String(), "hunter2") || strings.Contains(buffer.String(), "t0k3n") {
+				t.Errorf("❌ Expected no secrets logged, got %s", buffer.String())
+			} else {
+				t.Logf("✅ Logged %s", strings.TrimSpace(buffer.String()))
+			}
+		})
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := New(&buffer, &configs.AppConfig{LogFormat: configs.LogFormatText, LogLevel: slog.LevelInfo})
+	logger.InfoContext(WithRequestID(context.Background(), "request-1"), "Request served", "secret", "s3cr3t")
+
+	line := buffer.String()
+	if !strings.Contains(line, "request_id=request-1") || !strings.Contains(line, "secret="+Redacted) {
+		t.Errorf("❌ Expected text record with request ID and redacted secret, got %s", line)
+	} else {
+		t.Logf("✅ Logged %s", strings.TrimSpace(line))
+	}
+}
+
+func mustMarshal(t *testing.T, value any) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("Failed to marshal %v: %v", value, err)
+	}
+	return string(encoded)
+}
@@ -0,0 +1,183 @@
+// Prometheus metrics for deposit processing
+package metrics
+
+import (
+	"net/http"
+	"portfolio-investment/configs"
+	"portfolio-investment/money"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "portfolio"
+
+// Outcome label values
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+// Metrics of a single process, on their own registry
+// All methods are safe on a nil *Metrics, which records nothing
+type Metrics struct {
+	registry              *prometheus.Registry
+	processFundsCalls     *prometheus.CounterVec
+	transactionsCreated   *prometheus.CounterVec
+	transactionsProcessed *prometheus.CounterVec
+	allocationDuration    *prometheus.HistogramVec
+	allocatedAmount       *prometheus.CounterVec
+	dbRetries             prometheus.Counter
+	discrepancies         *prometheus.GaugeVec
+	repairs               *prometheus.CounterVec
+}
+
+// PUBLIC: Build metrics on a new registry, along with Go runtime and process metrics
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		processFundsCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "process_funds_calls_total",
+			Help:      "Calls to process a user's deposits, by outcome.",
+		}, []string{"outcome"}),
+		transactionsCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transactions_created_total",
+			Help:      "Transactions requested, by type and whether the reference ID was replayed instead of creating one.",
+		}, []string{"type", "replayed"}),
+		transactionsProcessed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transactions_processed_total",
+			Help:      "Transactions processed, by type and resulting status.",
+		}, []string{"type", "status"}),
+		allocationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "allocation_duration_seconds",
+			Help:      "Time to allocate a batch of deposits to plans, retries included, by strategy and outcome.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"strategy", "outcome"}),
+		allocatedAmount: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "allocated_amount_total",
+			Help:      "Amount allocated to plans (in major units), by portfolio reference ID.",
+		}, []string{"portfolio"}),
+		dbRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "db_transaction_retries_total",
+			Help:      "DB transactions retried after a conflict or transient error.",
+		}),
+		discrepancies: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "reconciliation_discrepancies",
+			Help:      "Discrepancies found by the last reconciliation of all users, by kind.",
+		}, []string{"kind"}),
+		repairs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "reconciliation_repairs_total",
+			Help:      "Discrepancies repaired by reconciliations, by kind.",
+		}, []string{"kind"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.processFundsCalls,
+		m.transactionsCreated,
+		m.transactionsProcessed,
+		m.allocationDuration,
+		m.allocatedAmount,
+		m.dbRetries,
+		m.discrepancies,
+		m.repairs,
+	)
+	return m
+}
+
+// PUBLIC: HTTP handler serving the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// PUBLIC: Registry the metrics are registered on, e.g. to gather them in tests
+func (m *Metrics) Registry() *prometheus.Registry {
+	if m == nil {
+		return nil
+	}
+	return m.registry
+}
+
+// PUBLIC: Record a call to process funds
+func (m *Metrics) ProcessFundsCalled(err error) {
+	if m == nil {
+		return
+	}
+	m.processFundsCalls.WithLabelValues(outcome(err)).Inc()
+}
+
+// PUBLIC: Record a transaction requested, created or replayed
+func (m *Metrics) TransactionCreated(transactionType configs.TransactionType, replayed bool) {
+	if m == nil {
+		return
+	}
+	m.transactionsCreated.WithLabelValues(string(transactionType), strconv.FormatBool(replayed)).Inc()
+}
+
+// PUBLIC: Record a transaction processed into a status
+func (m *Metrics) TransactionProcessed(transactionType configs.TransactionType, status configs.TransactionStatus) {
+	if m == nil {
+		return
+	}
+	m.transactionsProcessed.WithLabelValues(string(transactionType), string(status)).Inc()
+}
+
+// PUBLIC: Record how long allocating a batch of deposits took
+func (m *Metrics) AllocationObserved(strategy configs.AllocationStrategyType, elapsed time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.allocationDuration.WithLabelValues(string(strategy), outcome(err)).Observe(elapsed.Seconds())
+}
+
+// PUBLIC: Record amounts allocated per portfolio => { PortfolioReferenceID : Amount }
+func (m *Metrics) Allocated(amounts map[string]money.Money) {
+	if m == nil {
+		return
+	}
+	for portfolioReferenceID, amount := range amounts {
+		m.allocatedAmount.WithLabelValues(portfolioReferenceID).Add(amount.Float64())
+	}
+}
+
+// PUBLIC: Record DB transaction retries
+func (m *Metrics) Retried(retries int) {
+	if m == nil || retries <= 0 {
+		return
+	}
+	m.dbRetries.Add(float64(retries))
+}
+
+// PUBLIC: Record discrepancies of a kind found by a reconciliation, and how many of them were repaired
+// Only a reconciliation of all users sets the discrepancies found, so a single user's doesn't overwrite their count
+func (m *Metrics) Reconciled(kind string, found int, repaired int, allUsers bool) {
+	if m == nil {
+		return
+	}
+	if allUsers {
+		m.discrepancies.WithLabelValues(kind).Set(float64(found))
+	}
+	m.repairs.WithLabelValues(kind).Add(float64(repaired))
+}
+
+// PRIVATE: Outcome label of an error
+func outcome(err error) string {
+	if err != nil {
+		return OutcomeError
+	}
+	return OutcomeSuccess
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"portfolio-investment/configs"
+	"portfolio-investment/money"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	m.ProcessFundsCalled(nil)
+	m.ProcessFundsCalled(errors.New("failed"))
+	m.TransactionCreated(configs.TrxnTypeDeposit, false)
+	m.TransactionCreated(configs.TrxnTypeDeposit, true)
+	m.TransactionProcessed(configs.TrxnTypeDeposit, configs.TrxnStatusCompleted)
+	m.AllocationObserved(configs.AllocationStrategyWaterfall, 20*time.Millisecond, nil)
+	m.Allocated(map[string]money.Money{"portfolio-high-risk": money.Money(5025)})
+	m.Allocated(map[string]money.Money{"portfolio-high-risk": money.Money(1000)})
+	m.Retried(0)
+	m.Retried(2)
+	m.Reconciled("portfolio_fund", 3, 1, true)
+	m.Reconciled("portfolio_fund", 0, 1, false)
+
+	var tests = []struct {
+		name     string
+		actual   float64
+		expected float64
+	}{
+		{"Test successful calls counted", testutil.ToFloat64(m.processFundsCalls.WithLabelValues(OutcomeSuccess)), 1},
+		{"Test failed calls counted", testutil.ToFloat64(m.processFundsCalls.WithLabelValues(OutcomeError)), 1},
+		{"Test replayed transactions counted apart", testutil.ToFloat64(m.transactionsCreated.WithLabelValues(string(configs.TrxnTypeDeposit), "true")), 1},
+		{"Test processed transactions counted by status", testutil.ToFloat64(m.transactionsProcessed.WithLabelValues(string(configs.TrxnTypeDeposit), string(configs.TrxnStatusCompleted))), 1},
+		{"Test allocation latency observed", float64(testutil.CollectAndCount(m.allocationDuration)), 1},
+		{"Test amounts added per portfolio", testutil.ToFloat64(m.allocatedAmount.WithLabelValues("portfolio-high-risk")), 60.25},
+		{"Test retries added", testutil.ToFloat64(m.dbRetries), 2},
+		{"Test discrepancies of all users kept", testutil.ToFloat64(m.discrepancies.WithLabelValues("portfolio_fund")), 3},
+		{"Test repairs of every run added", testutil.ToFloat64(m.repairs.WithLabelValues("portfolio_fund")), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.actual != tt.expected {
+				t.Errorf("❌ Expected %v, got %v", tt.expected, tt.actual)
+			} else {
+				t.Logf("✅ Got %v", tt.actual)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.Retried(1)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "portfolio_db_transaction_retries_total 1") {
+		t.Errorf("❌ Expected retries exposed, got %d: %s", rec.Code, rec.Body.String())
+	} else {
+		t.Logf("✅ Metrics exposed")
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.ProcessFundsCalled(nil)
+	m.TransactionCreated(configs.TrxnTypeDeposit, false)
+	m.Allocated(map[string]money.Money{"portfolio-high-risk": money.Money(100)})
+	m.Retried(1)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("❌ Expected nil metrics to serve nothing, got %d", rec.Code)
+	} else {
+		t.Logf("✅ Nil metrics record nothing")
+	}
+}
@@ -0,0 +1,221 @@
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact monetary amount stored as integer minor units (cents)
+type Money int64
+
+const (
+	Zero Money = 0
+
+	// Number of minor units per major unit
+	MinorUnits int64 = 100
+	// Number of decimal places in the major unit representation
+	Scale int = 2
+)
+
+var ErrInvalidAmount = fmt.Errorf("invalid money amount")
+
+// PUBLIC: Build Money from a float, rounding half away from zero to the nearest minor unit
+func FromFloat(value float64) Money {
+	return Money(math.Round(value * float64(MinorUnits)))
+}
+
+// PUBLIC: Parse a decimal string (e.g. "100", "100.5", "-100.25") into Money
+// Strings with more than `Scale` decimal places or exponents are rejected
+func Parse(value string) (Money, error) {
+	s := strings.TrimSpace(value)
+	negative := false
+	if strings.HasPrefix(s, "-") {
+		negative = true
+		s = s[1:]
+	}
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+	if len(fraction) > Scale {
+		return 0, fmt.Errorf("%w: %q has more than %d decimal places", ErrInvalidAmount, value, Scale)
+	}
+	for _, r := range whole + fraction {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+		}
+	}
+
+	// Pad fraction to scale, then parse the whole value as minor units
+	fraction += strings.Repeat("0", Scale-len(fraction))
+	units, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q: %v", ErrInvalidAmount, value, err)
+	}
+	if negative {
+		units = -units
+	}
+	return Money(units), nil
+}
+
+// PUBLIC: Convert to float for display or ratio calculations only
+func (m Money) Float64() float64 {
+	return float64(m) / float64(MinorUnits)
+}
+
+// PUBLIC: Format as a decimal string with `Scale` decimal places
+func (m Money) String() string {
+	sign := ""
+	units := int64(m)
+	if units < 0 {
+		sign = "-"
+	}
+	whole := new(big.Int).Abs(big.NewInt(units))
+	fraction := new(big.Int)
+	whole.QuoRem(whole, big.NewInt(MinorUnits), fraction)
+	return fmt.Sprintf("%s%s.%0*d", sign, whole.String(), Scale, fraction.Int64())
+}
+
+// PUBLIC: Smaller of two amounts
+func Min(a, b Money) Money {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// PUBLIC: Sum of amounts
+func Sum(amounts ...Money) Money {
+	total := Zero
+	for _, amount := range amounts {
+		total += amount
+	}
+	return total
+}
+
+// PUBLIC: Split amount across weights using the largest remainder method
+// Shares always sum to exactly `m`. Negative weights are treated as zero.
+// If all weights are zero, the amount is split equally.
+func (m Money) Split(weights []Money) []Money {
+	shares := make([]Money, len(weights))
+	if len(weights) == 0 {
+		return shares
+	}
+
+	// Split the absolute value, restore the sign at the end
+	amount := m
+	if amount < 0 {
+		amount = -amount
+	}
+
+	normalized := make([]*big.Int, len(weights))
+	total := new(big.Int)
+	for i, weight := range weights {
+		if weight < 0 {
+			weight = 0
+		}
+		normalized[i] = big.NewInt(int64(weight))
+		total.Add(total, normalized[i])
+	}
+	if total.Sign() == 0 {
+		for i := range normalized {
+			normalized[i] = big.NewInt(1)
+		}
+		total = big.NewInt(int64(len(normalized)))
+	}
+
+	// Floor of each proportional share, tracking the remainders
+	type remainder struct {
+		index int
+		value *big.Int
+	}
+	remainders := make([]remainder, len(weights))
+	allocated := Zero
+	for i, weight := range normalized {
+		product := new(big.Int).Mul(big.NewInt(int64(amount)), weight)
+		quotient, rest := new(big.Int).QuoRem(product, total, new(big.Int))
+		shares[i] = Money(quotient.Int64())
+		allocated += shares[i]
+		remainders[i] = remainder{index: i, value: rest}
+	}
+
+	// Hand out leftover minor units to the largest remainders (earliest index wins ties)
+	sort.SliceStable(remainders, func(a, b int) bool {
+		return remainders[a].value.Cmp(remainders[b].value) > 0
+	})
+	for i := 0; allocated < amount; i++ {
+		shares[remainders[i].index]++
+		allocated++
+	}
+
+	if m < 0 {
+		for i := range shares {
+			shares[i] = -shares[i]
+		}
+	}
+	return shares
+}
+
+// PUBLIC: Split amount across balances by their size, taking at most their total
+// Largest remainder split never takes more from a balance than it holds
+func (m Money) SplitWithin(balances []Money) []Money {
+	total := Sum(balances...)
+	if total <= 0 {
+		return make([]Money, len(balances))
+	}
+	return Min(m, total).Split(balances)
+}
+
+// PUBLIC: Encode as a JSON number with `Scale` decimal places
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// PUBLIC: Decode from a JSON number or string without going through float64
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// PUBLIC: Store Money as integer minor units
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
+
+// PUBLIC: Read Money from integer minor units
+// Aggregates such as SUM come back as DECIMAL/NUMERIC on MySQL and Postgres, so whole numbers in other forms are accepted too
+func (m *Money) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*m = Zero
+	case int64:
+		*m = Money(v)
+	case float64:
+		if v != math.Trunc(v) {
+			return fmt.Errorf("%w: %v is not a whole number of minor units", ErrInvalidAmount, v)
+		}
+		*m = Money(v)
+	case []byte:
+		return m.Scan(string(v))
+	case string:
+		minorUnits, err := strconv.ParseInt(strings.TrimSuffix(v, ".0"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %q is not a whole number of minor units", ErrInvalidAmount, v)
+		}
+		*m = Money(minorUnits)
+	default:
+		return fmt.Errorf("%w: unsupported type %T", ErrInvalidAmount, value)
+	}
+	return nil
+}
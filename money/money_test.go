@@ -0,0 +1,163 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		input    string
+		expected Money
+		invalid  bool
+	}{
+		{"100", 10000, false},
+		{"100.5", 10050, false},
+		{"100.25", 10025, false},
+		{"-0.05", -5, false},
+		{".75", 75, false},
+		{"3000050025", 300005002500, false},
+		{"100.255", 0, true},
+		{"1e30", 0, true},
+		{"abc", 0, true},
+		{"", 0, true},
+		{"99999999999999999999", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := Parse(tt.input)
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidAmount) {
+					t.Errorf("❌ Expected invalid amount error for %q, got %v (%d)", tt.input, err, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("❌ Parse failed: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("❌ Expected %d, got %d", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	var tests = []struct {
+		input    Money
+		expected string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{10025, "100.25"},
+		{300005002500, "3000050025.00"},
+	}
+	for _, tt := range tests {
+		if result := tt.input.String(); result != tt.expected {
+			t.Errorf("❌ Expected %s, got %s", tt.expected, result)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	var tests = []struct {
+		name     string
+		amount   Money
+		weights  []Money
+		expected []Money
+	}{
+		{"Test even split", 1000, []Money{1, 1}, []Money{500, 500}},
+		{"Test thirds", 100, []Money{1, 1, 1}, []Money{34, 33, 33}},
+		{"Test weighted", 10060, []Money{50000, 1000000}, []Money{479, 9581}},
+		{"Test zero weight", 100, []Money{10000, 0}, []Money{100, 0}},
+		{"Test all zero weights", 101, []Money{0, 0}, []Money{51, 50}},
+		{"Test negative amount", -100, []Money{1, 1, 1}, []Money{-34, -33, -33}},
+		{"Test large amount", 300005002500, []Money{50000, 10000, 7}, []Money{249975004999, 49995001000, 34996501}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.amount.Split(tt.weights)
+			if Sum(result...) != tt.amount {
+				t.Errorf("❌ Expected shares to sum to %d, got %d", tt.amount, Sum(result...))
+			}
+			for i := range tt.expected {
+				if result[i] != tt.expected[i] {
+					t.Errorf("❌ Expected shares %v, got %v", tt.expected, result)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestSplitWithin(t *testing.T) {
+	var tests = []struct {
+		name     string
+		amount   Money
+		balances []Money
+		expected []Money
+	}{
+		{"Test within balances", 100, []Money{100, 100, 100}, []Money{34, 33, 33}},
+		{"Test whole balances", 3, []Money{1, 1, 1}, []Money{1, 1, 1}},
+		{"Test capped at total", 500, []Money{100, 50, 0}, []Money{100, 50, 0}},
+		{"Test empty balances", 100, []Money{0, 0}, []Money{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.amount.SplitWithin(tt.balances)
+			for i := range tt.expected {
+				if result[i] != tt.expected[i] || result[i] > tt.balances[i] {
+					t.Errorf("❌ Expected shares %v, got %v", tt.expected, result)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var payload struct {
+		Amounts []Money `json:"amounts"`
+	}
+	if err := json.Unmarshal([]byte(`{"amounts":[100.25,"0.10",7]}`), &payload); err != nil {
+		t.Fatalf("❌ Unmarshal failed: %v", err)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("❌ Marshal failed: %v", err)
+	}
+	if string(data) != `{"amounts":[100.25,0.10,7.00]}` {
+		t.Errorf("❌ Unexpected JSON: %s", data)
+	}
+}
+
+func TestScan(t *testing.T) {
+	var tests = []struct {
+		name     string
+		value    any
+		expected Money
+		valid    bool
+	}{
+		{"Test integer", int64(10025), 10025, true},
+		{"Test whole float", float64(1.070038e+06), 1070038, true},
+		{"Test decimal bytes", []byte("1070038"), 1070038, true},
+		{"Test numeric string", "-25", -25, true},
+		{"Test null", nil, Zero, true},
+		{"Test fractional float", 100.5, Zero, false},
+		{"Test fractional string", "100.5", Zero, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Money
+			err := m.Scan(tt.value)
+			if (err == nil) != tt.valid {
+				t.Fatalf("❌ Unexpected error for %v: %v", tt.value, err)
+			}
+			if tt.valid && m != tt.expected {
+				t.Errorf("❌ Expected %d, got %d", tt.expected, m)
+			}
+		})
+	}
+}
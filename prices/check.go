@@ -0,0 +1,82 @@
+package prices
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Daily move, up or down, beyond which a close is reported as an outlier
+const OutlierMove = 0.5
+
+// What an issue in a price series is about
+type IssueKind string
+
+const (
+	IssueGap       IssueKind = "gap"       // Weekday without a close between two closes
+	IssueOutlier   IssueKind = "outlier"   // Close moved more than OutlierMove from the previous close
+	IssueDuplicate IssueKind = "duplicate" // More than one close for a day; the last one is kept
+)
+
+// Suspicious point in an asset's price series, reported but not refused
+type Issue struct {
+	Kind   IssueKind
+	Asset  string
+	Date   time.Time
+	Detail string
+}
+
+// PUBLIC: Check each asset's series of quotes for gaps, outliers and duplicates
+// Quotes must name each asset the same way. An asset's series continues from its close in previous, if any (e.g. its
+// last stored price before its quotes), which is checked against but not reported on.
+// Only weekdays are expected to have a close, so weekends and holidays aren't told apart: a holiday is reported as a gap
+// Returns issues ordered by asset and date
+func Check(quotes []Quote, previous []Quote) []Issue {
+	series := make(map[string][]Quote)
+	for _, quote := range quotes {
+		series[quote.Asset] = append(series[quote.Asset], quote)
+	}
+	for _, quote := range previous {
+		if closes, exists := series[quote.Asset]; exists {
+			series[quote.Asset] = append([]Quote{quote}, closes...)
+		}
+	}
+	assets := make([]string, 0, len(series))
+	for asset := range series {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+
+	var issues []Issue
+	for _, asset := range assets {
+		closes := series[asset]
+		sort.SliceStable(closes, func(i, j int) bool { return closes[i].Date.Before(closes[j].Date) })
+
+		for i := 1; i < len(closes); i++ {
+			previous, current := closes[i-1], closes[i]
+			if current.Date.Equal(previous.Date) {
+				issues = append(issues, Issue{Kind: IssueDuplicate, Asset: asset, Date: current.Date,
+					Detail: fmt.Sprintf("closes %s and %s", previous.Price, current.Price)})
+				continue
+			}
+			for day := previous.Date.AddDate(0, 0, 1); day.Before(current.Date); day = day.AddDate(0, 0, 1) {
+				if day.Weekday() != time.Saturday && day.Weekday() != time.Sunday {
+					issues = append(issues, Issue{Kind: IssueGap, Asset: asset, Date: day, Detail: "no close"})
+				}
+			}
+			move := current.Price.Float64()/previous.Price.Float64() - 1
+			if math.Abs(move) > OutlierMove {
+				issues = append(issues, Issue{Kind: IssueOutlier, Asset: asset, Date: current.Date,
+					Detail: fmt.Sprintf("%+.1f%% from %s to %s", move*100, previous.Price, current.Price)})
+			}
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Asset != issues[j].Asset {
+			return issues[i].Asset < issues[j].Asset
+		}
+		return issues[i].Date.Before(issues[j].Date)
+	})
+	return issues
+}
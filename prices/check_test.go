@@ -0,0 +1,61 @@
+package prices
+
+import (
+	"portfolio-investment/money"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC) } // 2025-01-03 is a Friday
+	quote := func(d int, price float64) Quote {
+		return Quote{Asset: "BTC", Date: day(d), Price: money.FromFloat(price)}
+	}
+
+	var tests = []struct {
+		name     string
+		quotes   []Quote
+		previous []Quote
+		expected []Issue
+	}{
+		{"Test consecutive weekdays", []Quote{quote(2, 100), quote(3, 110)}, nil, nil},
+		{"Test weekend is no gap", []Quote{quote(3, 100), quote(6, 100)}, nil, nil},
+		{"Test missing weekdays", []Quote{quote(6, 100), quote(9, 100)}, nil, []Issue{
+			{Kind: IssueGap, Asset: "BTC", Date: day(7), Detail: "no close"},
+			{Kind: IssueGap, Asset: "BTC", Date: day(8), Detail: "no close"},
+		}},
+		{"Test out of order", []Quote{quote(3, 110), quote(2, 100)}, nil, nil},
+		{"Test move up over 50%", []Quote{quote(2, 100), quote(3, 150.01)}, nil, []Issue{
+			{Kind: IssueOutlier, Asset: "BTC", Date: day(3), Detail: "+50.0% from 100.00 to 150.01"},
+		}},
+		{"Test move down of 50%", []Quote{quote(2, 100), quote(3, 50)}, nil, nil},
+		{"Test move down over 50%", []Quote{quote(2, 100), quote(3, 40)}, nil, []Issue{
+			{Kind: IssueOutlier, Asset: "BTC", Date: day(3), Detail: "-60.0% from 100.00 to 40.00"},
+		}},
+		{"Test duplicate day", []Quote{quote(2, 100), quote(2, 101)}, nil, []Issue{
+			{Kind: IssueDuplicate, Asset: "BTC", Date: day(2), Detail: "closes 100.00 and 101.00"},
+		}},
+		{"Test continued from previous close", []Quote{quote(3, 100)}, []Quote{quote(2, 100)}, nil},
+		{"Test gap after previous close", []Quote{quote(7, 100)}, []Quote{quote(3, 100)}, []Issue{
+			{Kind: IssueGap, Asset: "BTC", Date: day(6), Detail: "no close"},
+		}},
+		{"Test move from previous close", []Quote{quote(3, 40)}, []Quote{quote(2, 100)}, []Issue{
+			{Kind: IssueOutlier, Asset: "BTC", Date: day(3), Detail: "-60.0% from 100.00 to 40.00"},
+		}},
+		{"Test previous close of another asset", []Quote{quote(3, 40)}, []Quote{{Asset: "ETH", Date: day(2), Price: 10}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := Check(tt.quotes, tt.previous)
+			if len(issues) != len(tt.expected) {
+				t.Fatalf("❌ Expected issues %+v, got %+v", tt.expected, issues)
+			}
+			for i, issue := range issues {
+				if issue != tt.expected[i] {
+					t.Errorf("❌ Expected %+v, got %+v", tt.expected[i], issue)
+				}
+			}
+			t.Logf("✅ Found %d issues", len(issues))
+		})
+	}
+}
@@ -0,0 +1,202 @@
+// Asset closing prices, as read from price files, and checks of their series
+package prices
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"portfolio-investment/money"
+	"strings"
+	"time"
+)
+
+// Layout of price dates in files
+const DateLayout = time.DateOnly
+
+// Formats price files are read in
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatJSON Format = "json"
+)
+
+var ErrInvalidFile = errors.New("invalid price file")
+
+// Closing price of one unit of an asset on a day
+type Quote struct {
+	Asset    string    // Asset name or ticker
+	Date     time.Time // Midnight UTC
+	Price    money.Money
+	Currency string // Empty if the file doesn't say
+}
+
+// Quote as written in JSON price files
+type jsonQuote struct {
+	Asset    string      `json:"asset"`
+	Date     string      `json:"date"`
+	Close    json.Number `json:"close"`
+	Currency string      `json:"currency"`
+}
+
+// PUBLIC: Day a time falls on, as midnight UTC
+func Day(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// PUBLIC: Parse a closing price, rounding half away from zero to the nearest minor unit
+// Feeds quote more decimal places than money keeps; the digits are rounded exactly, without going through float64
+func ParsePrice(value string) (money.Money, error) {
+	value = strings.TrimSpace(value)
+	whole, fraction, _ := strings.Cut(value, ".")
+	round := false
+	if len(fraction) > money.Scale {
+		for _, r := range fraction[money.Scale:] {
+			if r < '0' || r > '9' {
+				return 0, fmt.Errorf("%w: %q", money.ErrInvalidAmount, value)
+			}
+		}
+		round = fraction[money.Scale] >= '5'
+		fraction = fraction[:money.Scale]
+	}
+
+	price, err := money.Parse(whole + "." + fraction)
+	if err != nil {
+		return 0, err
+	}
+	if round {
+		price++
+	}
+	if price <= 0 {
+		return 0, fmt.Errorf("%w: %q must be positive", money.ErrInvalidAmount, value)
+	}
+	return price, nil
+}
+
+// PRIVATE: Build quote from the fields of a record, as given in the file
+func newQuote(asset string, date string, price string, currency string) (Quote, error) {
+	if strings.TrimSpace(asset) == "" {
+		return Quote{}, fmt.Errorf("asset is required")
+	}
+	day, err := time.Parse(DateLayout, strings.TrimSpace(date))
+	if err != nil {
+		return Quote{}, fmt.Errorf("invalid date %q", date)
+	}
+	parsed, err := ParsePrice(price)
+	if err != nil {
+		return Quote{}, fmt.Errorf("close must be a positive amount: %v", err)
+	}
+	return Quote{
+		Asset:    strings.TrimSpace(asset),
+		Date:     day,
+		Price:    parsed,
+		Currency: strings.ToUpper(strings.TrimSpace(currency)),
+	}, nil
+}
+
+// PUBLIC: Read quotes from CSV with a header naming its columns: `asset`, `date` (YYYY-MM-DD), `close` (or `price`)
+// and, optionally, `currency`, in any order
+func ReadCSV(r io.Reader) ([]Quote, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read header: %v", ErrInvalidFile, err)
+	}
+	columns := map[string]int{"currency": -1}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "price" {
+			name = "close"
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"asset", "date", "close"} {
+		if _, exists := columns[name]; !exists {
+			return nil, fmt.Errorf("%w: header must name asset, date and close columns, got %s", ErrInvalidFile, strings.Join(header, ","))
+		}
+	}
+
+	var quotes []Quote
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		currency := ""
+		if columns["currency"] >= 0 {
+			currency = record[columns["currency"]]
+		}
+		quote, err := newQuote(record[columns["asset"]], record[columns["date"]], record[columns["close"]], currency)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidFile, line, err)
+		}
+		quotes = append(quotes, quote)
+	}
+	return quotes, nil
+}
+
+// PUBLIC: Read quotes from a JSON array of `{"asset", "date", "close", "currency"}` objects
+// Closes may be numbers or strings; currency is optional
+func ReadJSON(r io.Reader) ([]Quote, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+
+	var records []jsonQuote
+	if err := decoder.Decode(&records); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	quotes := make([]Quote, 0, len(records))
+	for i, record := range records {
+		quote, err := newQuote(record.Asset, record.Date, record.Close.String(), record.Currency)
+		if err != nil {
+			return nil, fmt.Errorf("%w: quote %d: %v", ErrInvalidFile, i, err)
+		}
+		quotes = append(quotes, quote)
+	}
+	return quotes, nil
+}
+
+// PUBLIC: Read quotes in a format
+func Read(r io.Reader, format Format) ([]Quote, error) {
+	switch format {
+	case FormatCSV:
+		return ReadCSV(r)
+	case FormatJSON:
+		return ReadJSON(r)
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %q", ErrInvalidFile, format)
+	}
+}
+
+// PUBLIC: Read quotes from a file, in the format its extension names (.csv or .json)
+func ReadFile(path string) ([]Quote, error) {
+	format := Format(strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")))
+	if format != FormatCSV && format != FormatJSON {
+		return nil, fmt.Errorf("%w: %s is neither .csv nor .json", ErrInvalidFile, path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open price file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	quotes, err := Read(file, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price file %s: %w", path, err)
+	}
+	return quotes, nil
+}
@@ -0,0 +1,131 @@
+package prices
+
+import (
+	"errors"
+	"os"
+	"portfolio-investment/money"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCSV(t *testing.T) {
+	var tests = []struct {
+		name     string
+		csv      string
+		expected []Quote
+		err      error
+	}{
+		{"Test valid prices", "asset,date,price\nBitcoin,2025-01-02,100.00\nApple Inc., 2025-01-03, 243.5\n", []Quote{
+			{Asset: "Bitcoin", Date: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), Price: money.FromFloat(100.0)},
+			{Asset: "Apple Inc.", Date: time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC), Price: money.FromFloat(243.5)},
+		}, nil},
+		{"Test header only", "asset,date,price\n", nil, nil},
+		{"Test empty file", "", nil, ErrInvalidFile},
+		{"Test unknown header", "name,day,close\nBitcoin,2025-01-02,100.00\n", nil, ErrInvalidFile},
+		{"Test invalid date", "asset,date,price\nBitcoin,02/01/2025,100.00\n", nil, ErrInvalidFile},
+		{"Test zero price", "asset,date,price\nBitcoin,2025-01-02,0\n", nil, ErrInvalidFile},
+		{"Test close and currency columns in any order", "date,currency,close,asset\n2025-01-02,usd,100.005,BTC\n", []Quote{
+			{Asset: "BTC", Date: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), Price: money.FromFloat(100.01), Currency: "USD"},
+		}, nil},
+		{"Test missing close column", "asset,date,currency\nBitcoin,2025-01-02,USD\n", nil, ErrInvalidFile},
+		{"Test empty asset", "asset,date,price\n,2025-01-02,100.00\n", nil, ErrInvalidFile},
+		{"Test missing column", "asset,date,price\nBitcoin,2025-01-02\n", nil, ErrInvalidFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quotes, err := ReadCSV(strings.NewReader(tt.csv))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("❌ Expected error %v, got %v", tt.err, err)
+			}
+			if len(quotes) != len(tt.expected) {
+				t.Fatalf("❌ Expected %d quotes, got %+v", len(tt.expected), quotes)
+			}
+			for i, quote := range quotes {
+				if quote != tt.expected[i] {
+					t.Errorf("❌ Expected %+v, got %+v", tt.expected[i], quote)
+				}
+			}
+			t.Logf("✅ Read %d quotes", len(quotes))
+		})
+	}
+}
+
+func TestParsePrice(t *testing.T) {
+	var tests = []struct {
+		value    string
+		expected money.Money
+		valid    bool
+	}{
+		{"100", money.FromFloat(100.0), true},
+		{"243.85", money.FromFloat(243.85), true},
+		{"243.8549", money.FromFloat(243.85), true},
+		{"243.855", money.FromFloat(243.86), true},
+		{"0.009", money.FromFloat(0.01), true},
+		{"0.004", 0, false},
+		{"-1.00", 0, false},
+		{"1.00x", 0, false},
+		{"1e3", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			price, err := ParsePrice(tt.value)
+			if (err == nil) != tt.valid {
+				t.Fatalf("❌ Expected valid: %v, got error %v", tt.valid, err)
+			}
+			if price != tt.expected {
+				t.Errorf("❌ Expected %s, got %s", tt.expected, price)
+			} else {
+				t.Logf("✅ Parsed %q as %s", tt.value, price)
+			}
+		})
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	var tests = []struct {
+		name     string
+		json     string
+		expected int
+		err      error
+	}{
+		{"Test numbers and strings", `[{"asset":"BTC","date":"2025-01-02","close":100.5},{"asset":"ETH","date":"2025-01-02","close":"9.999"}]`, 2, nil},
+		{"Test empty array", `[]`, 0, nil},
+		{"Test unknown field", `[{"asset":"BTC","date":"2025-01-02","price":100}]`, 0, ErrInvalidFile},
+		{"Test invalid close", `[{"asset":"BTC","date":"2025-01-02","close":"high"}]`, 0, ErrInvalidFile},
+		{"Test not an array", `{"asset":"BTC"}`, 0, ErrInvalidFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quotes, err := ReadJSON(strings.NewReader(tt.json))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("❌ Expected error %v, got %v", tt.err, err)
+			}
+			if len(quotes) != tt.expected {
+				t.Errorf("❌ Expected %d quotes, got %+v", tt.expected, quotes)
+			} else {
+				t.Logf("✅ Read %d quotes", len(quotes))
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	for path, expected := range map[string]int{"testdata/prices.csv": 10, "testdata/prices.json": 4} {
+		quotes, err := ReadFile(path)
+		if err != nil {
+			t.Fatalf("❌ ReadFile failed: %v", err)
+		}
+		if len(quotes) != expected {
+			t.Errorf("❌ Expected %d quotes in %s, got %d", expected, path, len(quotes))
+		}
+	}
+	if _, err := ReadFile("testdata/prices.txt"); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("❌ Expected unsupported format error, got %v", err)
+	}
+	if _, err := ReadFile("testdata/missing.csv"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("❌ Expected missing file error, got %v", err)
+	} else {
+		t.Log("✅ Read test price file")
+	}
+}
@@ -0,0 +1,140 @@
+// Rebalancing of a portfolio's holdings towards its assets' target weights
+package rebalance
+
+import (
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+	"sort"
+)
+
+// Order sides
+type Side string
+
+const (
+	SideBuy  Side = "buy"
+	SideSell Side = "sell"
+)
+
+// Target weight of an asset, in basis points
+type Target struct {
+	AssetID uint
+	Weight  int
+}
+
+// Trade of an asset's value; amounts are always positive
+type Order struct {
+	AssetID uint
+	Side    Side
+	Amount  money.Money
+}
+
+// PUBLIC: Drift of each asset's value from its target weight, in basis points of the total value (positive when
+// overweight) => { AssetID : Drift }
+// Held assets without a target have a target of zero; nothing drifts when there is no value
+func Drift(targets []Target, values map[uint]money.Money) map[uint]int {
+	total := totalValue(values)
+	drifts := make(map[uint]int, len(targets)+len(values))
+	if total <= 0 {
+		return drifts
+	}
+	targetAmounts := targetAmounts(targets, total)
+	for _, assetID := range assetIDs(targets, values) {
+		drifts[assetID] = int((values[assetID] - targetAmounts[assetID]) * database.FullWeight / total)
+	}
+	return drifts
+}
+
+// PUBLIC: Orders that bring values back to target weights, once any asset drifts beyond the tolerance band
+// (in basis points, either way); within the band no order is proposed
+// Every asset is brought back exactly to its target, so sales pay for purchases. Orders list the targets' assets in
+// order, then held assets without a target, which are sold off
+func Orders(targets []Target, values map[uint]money.Money, tolerance int) []Order {
+	total := totalValue(values)
+	if total <= 0 {
+		return nil
+	}
+	drifted := false
+	for _, drift := range Drift(targets, values) {
+		drifted = drifted || drift > tolerance || -drift > tolerance
+	}
+	if !drifted {
+		return nil
+	}
+
+	targetAmounts := targetAmounts(targets, total)
+	var orders []Order
+	for _, assetID := range assetIDs(targets, values) {
+		switch difference := targetAmounts[assetID] - values[assetID]; {
+		case difference > 0:
+			orders = append(orders, Order{AssetID: assetID, Side: SideBuy, Amount: difference})
+		case difference < 0:
+			orders = append(orders, Order{AssetID: assetID, Side: SideSell, Amount: -difference})
+		}
+	}
+	return orders
+}
+
+// PUBLIC: Split new money across the targets' assets, in order, without selling anything
+// The amount goes to assets by how far each is below its target once the amount is added; if none is, by target weight
+func Direct(targets []Target, values map[uint]money.Money, amount money.Money) []money.Money {
+	if len(targets) == 0 {
+		return nil
+	}
+	after := totalValue(values) + amount
+	targetAmounts := targetAmounts(targets, after)
+
+	weights := make([]money.Money, len(targets))
+	deficits := make([]money.Money, len(targets))
+	underweight := false
+	for i, target := range targets {
+		weights[i] = money.Money(target.Weight)
+		if deficit := targetAmounts[target.AssetID] - values[target.AssetID]; deficit > 0 {
+			deficits[i] = deficit
+			underweight = true
+		}
+	}
+	if !underweight {
+		return amount.Split(weights)
+	}
+	return amount.Split(deficits)
+}
+
+// PRIVATE: Split a total across the targets' assets by weight => { AssetID : Amount }
+func targetAmounts(targets []Target, total money.Money) map[uint]money.Money {
+	weights := make([]money.Money, len(targets))
+	for i, target := range targets {
+		weights[i] = money.Money(target.Weight)
+	}
+	amounts := make(map[uint]money.Money, len(targets))
+	for i, amount := range total.Split(weights) {
+		amounts[targets[i].AssetID] += amount
+	}
+	return amounts
+}
+
+// PRIVATE: Sum of values
+func totalValue(values map[uint]money.Money) money.Money {
+	total := money.Zero
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+
+// PRIVATE: Targets' assets in order, then held assets without a target by ID
+func assetIDs(targets []Target, values map[uint]money.Money) []uint {
+	ids := make([]uint, 0, len(targets)+len(values))
+	targeted := make(map[uint]bool, len(targets))
+	for _, target := range targets {
+		ids = append(ids, target.AssetID)
+		targeted[target.AssetID] = true
+	}
+	var untargeted []uint
+	for assetID, value := range values {
+		if !targeted[assetID] && value != 0 {
+			untargeted = append(untargeted, assetID)
+		}
+	}
+	sort.Slice(untargeted, func(i, j int) bool { return untargeted[i] < untargeted[j] })
+	return append(ids, untargeted...)
+}
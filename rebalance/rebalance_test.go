@@ -0,0 +1,73 @@
+package rebalance
+
+import (
+	"portfolio-investment/money"
+	"reflect"
+	"testing"
+)
+
+func TestOrders(t *testing.T) {
+	targets := []Target{{1, 6000}, {2, 4000}}
+
+	var tests = []struct {
+		name      string
+		values    map[uint]money.Money
+		tolerance int
+		expected  []Order
+	}{
+		{"Test on target", map[uint]money.Money{1: 6000, 2: 4000}, 0, nil},
+		{"Test drift within band", map[uint]money.Money{1: 6400, 2: 3600}, 500, nil},
+		{"Test drift beyond band", map[uint]money.Money{1: 7000, 2: 3000}, 500,
+			[]Order{{1, SideSell, 1000}, {2, SideBuy, 1000}}},
+		{"Test underweight beyond band", map[uint]money.Money{1: 4000, 2: 6000}, 500,
+			[]Order{{1, SideBuy, 2000}, {2, SideSell, 2000}}},
+		{"Test asset without target sold off", map[uint]money.Money{1: 6000, 2: 2000, 3: 2000}, 500,
+			[]Order{{2, SideBuy, 2000}, {3, SideSell, 2000}}},
+		{"Test nothing held", map[uint]money.Money{}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orders := Orders(targets, tt.values, tt.tolerance)
+			if !reflect.DeepEqual(orders, tt.expected) {
+				t.Errorf("❌ Expected %v, got %v", tt.expected, orders)
+			} else {
+				t.Logf("✅ Orders %v", orders)
+			}
+		})
+	}
+}
+
+func TestDrift(t *testing.T) {
+	drifts := Drift([]Target{{1, 6000}, {2, 4000}}, map[uint]money.Money{1: 7000, 2: 3000})
+	if drifts[1] != 1000 || drifts[2] != -1000 {
+		t.Errorf("❌ Expected drifts of 1000 and -1000, got %v", drifts)
+	} else {
+		t.Logf("✅ Drifts %v", drifts)
+	}
+}
+
+func TestDirect(t *testing.T) {
+	targets := []Target{{1, 6000}, {2, 4000}}
+
+	var tests = []struct {
+		name     string
+		values   map[uint]money.Money
+		amount   money.Money
+		expected []money.Money
+	}{
+		{"Test nothing held splits by weight", map[uint]money.Money{}, 1000, []money.Money{600, 400}},
+		{"Test on target splits by weight", map[uint]money.Money{1: 6000, 2: 4000}, 1000, []money.Money{600, 400}},
+		{"Test only underweight asset bought", map[uint]money.Money{1: 7000, 2: 3000}, 1000, []money.Money{0, 1000}},
+		{"Test amount beyond gap split by deficit", map[uint]money.Money{1: 7000, 2: 3000}, 10000, []money.Money{5000, 5000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares := Direct(targets, tt.values, tt.amount)
+			if !reflect.DeepEqual(shares, tt.expected) {
+				t.Errorf("❌ Expected %v, got %v", tt.expected, shares)
+			} else {
+				t.Logf("✅ Shares %v", shares)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+	"portfolio-investment/rebalance"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidComposition = errors.New("invalid portfolio composition")
+
+// Target weight of an asset in a portfolio, in basis points
+type AssetWeight struct {
+	AssetID uint
+	Weight  int
+}
+
+// PRIVATE: Get portfolio's assets by target weight, in a stable order so splits are deterministic
+func getPortfolioAssets(tx *gorm.DB, portfolioID uint) ([]database.PortfolioAsset, error) {
+	var portfolioAssets []database.PortfolioAsset
+	err := tx.Preload("Asset").Where(&database.PortfolioAsset{PortfolioID: portfolioID}).Order("id").Find(&portfolioAssets).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assets of portfolio %d: %w", portfolioID, err)
+	}
+	return portfolioAssets, nil
+}
+
+// PRIVATE: Add amount and units (or subtract, if negative) to user portfolio's holding of an asset, opening it if needed,
+// and record the change as an entry of the transaction
+// Holdings are only ever written along with their user portfolio's fund, which serializes concurrent updates
+func updateHolding(
+	tx *gorm.DB,
+	userPortfolioID uint,
+	assetID uint,
+	transaction *database.Transaction,
+	amount money.Money,
+	units float64,
+) error {
+	var holding database.Holding
+	err := tx.Where(&database.Holding{UserPortfolioID: userPortfolioID, AssetID: assetID}).FirstOrCreate(&holding).Error
+	if err != nil {
+		return fmt.Errorf("failed to open holding (user portfolio: %d, asset: %d): %w", userPortfolioID, assetID, err)
+	}
+	err = tx.Model(&holding).Updates(map[string]any{
+		"amount_cents": gorm.Expr("amount_cents + ?", amount),
+		"units":        gorm.Expr("units + ?", units),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update holding (user portfolio: %d, asset: %d): %w", userPortfolioID, assetID, err)
+	}
+	entry := database.HoldingEntry{HoldingID: holding.ID, TransactionID: &transaction.ID, Amount: amount, Units: units}
+	if err := tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to record holding entry (holding: %d): %w", holding.ID, err)
+	}
+	return nil
+}
+
+// PRIVATE: Split an amount added to a user portfolio's fund across its portfolio's assets, buying units at each asset's
+// price on the day of the deposit; an asset with no price yet is held at cost, without units
+// By target weight, or, when directed, to the assets furthest below their target weights at market value
+// Without a composition, the amount stays in the fund only
+func creditHoldings(
+	l ledger,
+	userPortfolio *database.UserPortfolio,
+	transaction *database.Transaction,
+	amount money.Money,
+	day time.Time,
+	directed bool,
+) error {
+	portfolioAssets, err := l.getPortfolioAssets(userPortfolio.PortfolioID)
+	if err != nil {
+		return err
+	}
+	weights := make([]money.Money, len(portfolioAssets))
+	for i, portfolioAsset := range portfolioAssets {
+		weights[i] = money.Money(portfolioAsset.Weight)
+	}
+
+	shares := amount.Split(weights)
+	if directed {
+		values, err := holdingValues(l, userPortfolio.ID, day)
+		if err != nil {
+			return err
+		}
+		shares = rebalance.Direct(portfolioTargets(portfolioAssets), values, amount)
+	}
+	for i, share := range shares {
+		if share == 0 {
+			continue
+		}
+		assetID := portfolioAssets[i].AssetID
+		price, err := l.priceOn(assetID, day)
+		if err != nil {
+			return err
+		}
+		units := 0.0
+		if price > 0 {
+			units = share.Float64() / price.Float64()
+		}
+		if err := l.updateHolding(userPortfolio.ID, assetID, transaction, share, units); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PRIVATE: Target weights of portfolio's assets, in the same order
+func portfolioTargets(portfolioAssets []database.PortfolioAsset) []rebalance.Target {
+	targets := make([]rebalance.Target, len(portfolioAssets))
+	for i, portfolioAsset := range portfolioAssets {
+		targets[i] = rebalance.Target{AssetID: portfolioAsset.AssetID, Weight: portfolioAsset.Weight}
+	}
+	return targets
+}
+
+// PRIVATE: Split an amount taken from a user portfolio's fund across its holdings by current amount,
+// selling units in proportion to the cost taken
+// Funds deposited before holdings were tracked aren't held in any asset, so at most the holdings' total is debited
+func debitHoldings(
+	tx *gorm.DB,
+	userPortfolio *database.UserPortfolio,
+	transaction *database.Transaction,
+	amount money.Money,
+) error {
+	var holdings []database.Holding
+	err := tx.Where(&database.Holding{UserPortfolioID: userPortfolio.ID}).Order("id").Find(&holdings).Error
+	if err != nil {
+		return fmt.Errorf("failed to get holdings of user portfolio %d: %w", userPortfolio.ID, err)
+	}
+	amounts := make([]money.Money, len(holdings))
+	for i, holding := range holdings {
+		amounts[i] = holding.Amount
+	}
+
+	for i, share := range amount.SplitWithin(amounts) {
+		if share == 0 {
+			continue
+		}
+		holding := holdings[i]
+		units := holding.Units * float64(share) / float64(holding.Amount)
+		if err := updateHolding(tx, userPortfolio.ID, holding.AssetID, transaction, -share, -units); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PUBLIC: Get portfolio's assets with their target weights, by portfolio reference ID
+func (s *Store) GetPortfolioAssets(ctx *context.Context, portfolioReferenceID string) ([]database.PortfolioAsset, error) {
+	db := s.withContext(ctx)
+	portfolio, err := getPortfolio(db, portfolioReferenceID)
+	if err != nil {
+		return nil, err
+	}
+	return getPortfolioAssets(db, portfolio.ID)
+}
+
+// PUBLIC: Replace portfolio's composition; weights must be positive, once per asset, and sum to 100%
+// Existing holdings are left as they are: only later deposits follow the new weights
+func (s *Store) SetPortfolioAssets(
+	ctx *context.Context,
+	portfolioReferenceID string,
+	weights []AssetWeight,
+) ([]database.PortfolioAsset, error) {
+	if err := validateComposition(weights); err != nil {
+		return nil, err
+	}
+
+	var portfolioAssets []database.PortfolioAsset
+	err := s.withTransaction(ctx, func(tx *gorm.DB) error {
+		portfolio, err := getPortfolio(tx, portfolioReferenceID)
+		if err != nil {
+			return err
+		}
+
+		assetIDs := make([]uint, len(weights))
+		for i, weight := range weights {
+			assetIDs[i] = weight.AssetID
+		}
+		var count int64
+		if err := tx.Model(&database.Asset{}).Where("id IN ?", assetIDs).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to get assets: %w", err)
+		}
+		if int(count) != len(assetIDs) {
+			return fmt.Errorf("assets %v: %w", assetIDs, gorm.ErrRecordNotFound)
+		}
+
+		// Hard delete, so an asset can be added back under the unique index
+		err = tx.Unscoped().Where(&database.PortfolioAsset{PortfolioID: portfolio.ID}).Delete(&database.PortfolioAsset{}).Error
+		if err != nil {
+			return fmt.Errorf("failed to clear composition of portfolio %s: %w", portfolioReferenceID, err)
+		}
+		composition := make([]database.PortfolioAsset, len(weights))
+		for i, weight := range weights {
+			composition[i] = database.PortfolioAsset{PortfolioID: portfolio.ID, AssetID: weight.AssetID, Weight: weight.Weight}
+		}
+		if err := tx.Create(&composition).Error; err != nil {
+			return fmt.Errorf("failed to set composition of portfolio %s: %w", portfolioReferenceID, err)
+		}
+
+		portfolioAssets, err = getPortfolioAssets(tx, portfolio.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(*ctx, "Portfolio composition set", "portfolio", portfolioReferenceID, "assets", len(portfolioAssets))
+	return portfolioAssets, nil
+}
+
+// PRIVATE: Validate that composition weights are positive, once per asset, and sum to 100%
+func validateComposition(weights []AssetWeight) error {
+	if len(weights) == 0 {
+		return fmt.Errorf("%w: at least one asset is required", ErrInvalidComposition)
+	}
+	total := 0
+	seen := make(map[uint]bool, len(weights))
+	for _, weight := range weights {
+		if weight.Weight <= 0 {
+			return fmt.Errorf("%w: weight of asset %d must be positive", ErrInvalidComposition, weight.AssetID)
+		}
+		if seen[weight.AssetID] {
+			return fmt.Errorf("%w: asset %d given more than once", ErrInvalidComposition, weight.AssetID)
+		}
+		seen[weight.AssetID] = true
+		total += weight.Weight
+	}
+	if total != database.FullWeight {
+		return fmt.Errorf("%w: weights sum to %d basis points, not %d", ErrInvalidComposition, total, database.FullWeight)
+	}
+	return nil
+}
+
+// PUBLIC: Get user's holdings per portfolio and asset, by user reference ID
+func (s *Store) GetUserHoldings(ctx *context.Context, referenceID string) ([]database.Holding, error) {
+	user, err := s.GetUser(ctx, referenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var holdings []database.Holding
+	err = s.withContext(ctx).Preload("UserPortfolio.Portfolio").Preload("Asset").
+		Joins("JOIN user_portfolios ON user_portfolios.id = holdings.user_portfolio_id").
+		Where("user_portfolios.user_id = ?", user.ID).
+		Order("holdings.user_portfolio_id, holdings.asset_id").
+		Find(&holdings).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get holdings for user reference ID (%s): %w", referenceID, err)
+	}
+	return holdings, nil
+}
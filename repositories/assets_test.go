@@ -0,0 +1,135 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/database/dbtest"
+	"portfolio-investment/money"
+	"portfolio-investment/strategies"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestHoldings(t *testing.T) {
+	const userReferenceID = "user-holdings"
+	highRisk := configs.DefaultPortfolioHighRisk
+	ctx := context.Background()
+	db, config := dbtest.New(t)
+	store := NewStore(db, config, nil)
+
+	// Seeded high risk portfolio: Bitcoin 70%, Ethereum 30%
+	if _, err := store.CreateUser(&ctx, userReferenceID); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	plan, err := store.CreateUserDepositPlan(&ctx, userReferenceID, highRisk, configs.PlanTypeMonthly, money.FromFloat(1000.0))
+	if err != nil {
+		t.Fatalf("CreateUserDepositPlan failed: %v", err)
+	}
+	deposits, err := store.CreateDepositTransactions(&ctx, userReferenceID, NewTransactionRequests([]money.Money{money.FromFloat(100.01)}))
+	if err != nil {
+		t.Fatalf("CreateDepositTransactions failed: %v", err)
+	}
+	if _, err := store.DepositFunds(&ctx, deposits, []database.UserDepositPlan{*plan}, strategies.Waterfall{}); err != nil {
+		t.Fatalf("DepositFunds failed: %v", err)
+	}
+	deposited := holdingsByAsset(t, store, &ctx, userReferenceID)
+
+	withdrawals, err := store.CreateWithdrawalTransactions(&ctx, userReferenceID, []money.Money{money.FromFloat(50.0)})
+	if err != nil {
+		t.Fatalf("CreateWithdrawalTransactions failed: %v", err)
+	}
+	if _, err := store.WithdrawFunds(&ctx, withdrawals, ""); err != nil {
+		t.Fatalf("WithdrawFunds failed: %v", err)
+	}
+	withdrawn := holdingsByAsset(t, store, &ctx, userReferenceID)
+
+	var tests = []struct {
+		name     string
+		actual   money.Money
+		expected money.Money
+	}{
+		{"Test deposit split by weight", deposited["Bitcoin"], money.FromFloat(70.01)},
+		{"Test deposit split remainder", deposited["Ethereum"], money.FromFloat(30.0)},
+		{"Test withdrawal pro-rata by holding", withdrawn["Bitcoin"], money.FromFloat(35.01)},
+		{"Test withdrawal pro-rata remainder", withdrawn["Ethereum"], money.FromFloat(15.0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.actual != tt.expected {
+				t.Errorf("❌ Expected %s, got %s", tt.expected, tt.actual)
+			} else {
+				t.Logf("✅ Holding is %s", tt.actual)
+			}
+		})
+	}
+}
+
+func TestSetPortfolioAssets(t *testing.T) {
+	ctx := context.Background()
+	db, config := dbtest.New(t)
+	store := NewStore(db, config, nil)
+	highRisk := configs.DefaultPortfolioHighRisk
+
+	var assets []database.Asset
+	db.Order("id").Find(&assets)
+	first, second := assets[0].ID, assets[1].ID
+
+	var tests = []struct {
+		name     string
+		weights  []AssetWeight
+		expected error
+	}{
+		{"Test valid composition", []AssetWeight{{first, 2500}, {second, 7500}}, nil},
+		{"Test single asset", []AssetWeight{{second, database.FullWeight}}, nil},
+		{"Test empty composition", nil, ErrInvalidComposition},
+		{"Test weights under 100%", []AssetWeight{{first, 2500}, {second, 7000}}, ErrInvalidComposition},
+		{"Test zero weight", []AssetWeight{{first, 0}, {second, database.FullWeight}}, ErrInvalidComposition},
+		{"Test duplicate asset", []AssetWeight{{first, 5000}, {first, 5000}}, ErrInvalidComposition},
+		{"Test unknown asset", []AssetWeight{{first, 5000}, {9999, 5000}}, gorm.ErrRecordNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portfolioAssets, err := store.SetPortfolioAssets(&ctx, highRisk, tt.weights)
+			if tt.expected != nil {
+				if !errors.Is(err, tt.expected) {
+					t.Fatalf("❌ Expected %v, got %v", tt.expected, err)
+				}
+				t.Logf("✅ Rejected: %v", err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("❌ SetPortfolioAssets failed: %v", err)
+			}
+			stored, err := store.GetPortfolioAssets(&ctx, highRisk)
+			if err != nil {
+				t.Fatalf("GetPortfolioAssets failed: %v", err)
+			}
+			if len(portfolioAssets) != len(tt.weights) || len(stored) != len(tt.weights) {
+				t.Fatalf("❌ Expected %d assets, got %d set and %d stored", len(tt.weights), len(portfolioAssets), len(stored))
+			}
+			for i, weight := range tt.weights {
+				if stored[i].AssetID != weight.AssetID || stored[i].Weight != weight.Weight {
+					t.Errorf("❌ Expected asset %d at %d, got asset %d at %d", weight.AssetID, weight.Weight, stored[i].AssetID, stored[i].Weight)
+				}
+			}
+			t.Logf("✅ Composition of %d assets set", len(stored))
+		})
+	}
+}
+
+// PRIVATE: Get user's holdings => { AssetName : Amount }
+func holdingsByAsset(t *testing.T, store *Store, ctx *context.Context, userReferenceID string) map[string]money.Money {
+	t.Helper()
+	holdings, err := store.GetUserHoldings(ctx, userReferenceID)
+	if err != nil {
+		t.Fatalf("GetUserHoldings failed: %v", err)
+	}
+	amounts := make(map[string]money.Money, len(holdings))
+	for _, holding := range holdings {
+		amounts[holding.Asset.Name] += holding.Amount
+	}
+	return amounts
+}
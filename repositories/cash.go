@@ -0,0 +1,131 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/logging"
+	"portfolio-investment/money"
+	"portfolio-investment/strategies"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PRIVATE: Get user's cash record, creating it on first use
+func getUserCash(tx *gorm.DB, userID uint) (*database.UserCash, error) {
+	var userCash database.UserCash
+	err := tx.Where(&database.UserCash{UserID: userID}).FirstOrCreate(&userCash).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user cash (user: %d): %w", userID, err)
+	}
+	return &userCash, nil
+}
+
+// PRIVATE: Credit (or debit, if negative) user's cash and record the entry against the transaction
+// Compare-and-swap on the version read with the cash record, like portfolio funds
+func creditCash(
+	tx *gorm.DB,
+	userCash *database.UserCash,
+	transaction *database.Transaction,
+	amount money.Money,
+) error {
+	entry := database.CashEntry{
+		TransactionID: transaction.ID,
+		UserCashID:    userCash.ID,
+		Amount:        amount,
+	}
+	err := tx.Create(&entry).Error
+	if err != nil {
+		return fmt.Errorf("failed to create cash entry: %w", err)
+	}
+
+	result := tx.Model(&database.UserCash{}).
+		Where("id = ? AND version = ?", userCash.ID, userCash.Version).
+		Updates(map[string]any{
+			"balance_cents": gorm.Expr("balance_cents + ?", amount),
+			"version":       gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update user cash: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user cash %d changed since read: %w", userCash.ID, database.ErrConflict)
+	}
+	userCash.Balance += amount
+	userCash.Version++
+	return nil
+}
+
+// PUBLIC: Get user's unallocated cash balance by reference ID
+func (s *Store) GetUserCash(ctx *context.Context, referenceID string) (money.Money, error) {
+	user, err := s.GetUser(ctx, referenceID)
+	if err != nil {
+		return 0, err
+	}
+
+	var userCash database.UserCash
+	err = s.withContext(ctx).Where(&database.UserCash{UserID: user.ID}).Limit(1).Find(&userCash).Error
+	if err != nil {
+		return 0, err
+	}
+	return userCash.Balance, nil
+}
+
+// PUBLIC: Sweep user's cash into deposit plans using the given allocation strategy
+// Whatever the strategy leaves unallocated stays as cash
+func (s *Store) SweepCash(
+	ctx *context.Context,
+	userReferenceID string,
+	strategy strategies.AllocationStrategy,
+) (map[string]money.Money, error) {
+	user, err := s.GetUser(ctx, userReferenceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user for reference ID (%s): %w", userReferenceID, err)
+	}
+	plans, err := s.GetUserDepositPlans(ctx, userReferenceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deposit plans for user reference ID (%s): %w", userReferenceID, err)
+	}
+
+	deposits := make(map[string]money.Money)
+	if len(plans) == 0 {
+		return deposits, nil
+	}
+
+	err = s.withRetry(ctx, func(tx *gorm.DB) error {
+		userCash, err := getUserCash(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if userCash.Balance <= 0 {
+			return nil
+		}
+
+		// Move the whole balance out of cash under a sweep transaction, then allocate it like a deposit
+		transaction := database.Transaction{
+			ReferenceID: uuid.New().String(),
+			User:        *user,
+			Type:        configs.TrxnTypeCashSweep,
+			Amount:      userCash.Balance,
+			Status:      configs.TrxnStatusPending,
+		}
+		err = tx.Create(&transaction).Error
+		if err != nil {
+			return fmt.Errorf("failed to create cash sweep transaction: %w", err)
+		}
+		err = creditCash(tx, userCash, &transaction, -transaction.Amount)
+		if err != nil {
+			return err
+		}
+
+		slog.InfoContext(logging.WithTransactionID(tx.Statement.Context, transaction.ReferenceID),
+			"Sweeping cash into plans", "amount", transaction.Amount)
+		deposits, _, err = depositTransaction(dbLedger{tx}, &transaction, plans, strategy, s.config.RebalanceOnDeposit)
+		return err
+	})
+
+	return deposits, err
+}
@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+	"portfolio-investment/strategies"
+)
+
+// PRIVATE: Explain how a transaction's amount was allocated: one decision per strategy allocation, in order,
+// and a final 'remainder' decision for any amount left to be credited to cash
+// Deposits the allocations were recorded in are given per plan => { PlanID : DepositID }
+func allocationDecisions(
+	transaction *database.Transaction,
+	strategyType configs.AllocationStrategyType,
+	allocations []strategies.Allocation,
+	balances strategies.Balances,
+	depositIDs map[uint]uint,
+) []database.AllocationDecision {
+
+	decisions := make([]database.AllocationDecision, 0, len(allocations)+1)
+	remaining := transaction.Amount
+	for _, allocation := range allocations {
+		plan := allocation.Plan
+		depositID, planID, portfolioID := depositIDs[plan.ID], plan.ID, plan.PortfolioID
+		decisions = append(decisions, database.AllocationDecision{
+			TransactionID:   transaction.ID,
+			Sequence:        len(decisions) + 1,
+			Strategy:        strategyType,
+			Step:            string(allocation.Step),
+			DepositID:       &depositID,
+			PlanID:          &planID,
+			PortfolioID:     &portfolioID,
+			PlanType:        plan.Type,
+			PlanAmount:      plan.Amount,
+			PlanContributed: balances.Contributions[plan.ID],
+			PortfolioFund:   balances.Funds[plan.PortfolioID],
+			Weight:          allocation.Weight,
+			TotalWeight:     allocation.TotalWeight,
+			Ratio:           allocation.Ratio(),
+			Amount:          allocation.Amount,
+			RemainingBefore: remaining,
+			RemainingAfter:  remaining - allocation.Amount,
+		})
+		remaining -= allocation.Amount
+	}
+
+	if remaining > 0 {
+		decisions = append(decisions, database.AllocationDecision{
+			TransactionID:   transaction.ID,
+			Sequence:        len(decisions) + 1,
+			Strategy:        strategyType,
+			Step:            string(strategies.StepRemainder),
+			Amount:          remaining,
+			RemainingBefore: remaining,
+			RemainingAfter:  money.Zero,
+		})
+	}
+	return decisions
+}
+
+// PUBLIC: Get every allocation decision made for a deposit transaction by reference ID, in the order they were made
+// Portfolio is loaded for decisions that allocated to a plan
+func (s *Store) GetAllocationDecisions(ctx *context.Context, referenceID string) ([]database.AllocationDecision, error) {
+	transaction, err := s.GetTransaction(ctx, referenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var decisions []database.AllocationDecision
+	err = s.withContext(ctx).Preload("Portfolio").
+		Where(&database.AllocationDecision{TransactionID: transaction.ID}).
+		Order("sequence").
+		Find(&decisions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get allocation decisions for transaction (%s): %w", referenceID, err)
+	}
+	return decisions, nil
+}
@@ -3,91 +3,171 @@ package repositories
 import (
 	"context"
 	"fmt"
-	"math"
+	"log/slog"
 	"portfolio-investment/configs"
 	"portfolio-investment/database"
-
-	"github.com/google/uuid"
+	"portfolio-investment/logging"
+	"portfolio-investment/metrics"
+	"portfolio-investment/money"
+	"portfolio-investment/prices"
+	"portfolio-investment/strategies"
+	"portfolio-investment/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/gorm"
 )
 
-// PRIVATE: Get current fund for user's portfolio
-func getFund(
+// PRIVATE: Get user's portfolio with its current fund and version
+func getUserPortfolio(
 	tx *gorm.DB,
 	userID uint,
 	portfolioID uint,
-) (float64, error) {
+) (*database.UserPortfolio, error) {
 	var userPortfolio database.UserPortfolio
 	err := tx.Where(&database.UserPortfolio{
 		UserID:      userID,
 		PortfolioID: portfolioID,
 	}).First(&userPortfolio).Error
 	if err != nil {
-		return 0, fmt.Errorf("failed to get user portfolio (user: %d, portfolio: %d): %w", userID, portfolioID, err)
+		return nil, fmt.Errorf("failed to get user portfolio (user: %d, portfolio: %d): %w", userID, portfolioID, err)
 	}
-	return userPortfolio.Fund, nil
+	return &userPortfolio, nil
 }
 
-// PRIVATE: Allocate funds to each plan based on the plan amounts
-// Returns allocated funds per portfolio => { PortfolioReferenceID : Allocated Fund }
-func allocateFunds(
-	tx *gorm.DB,
+// PRIVATE: Add amount (or subtract, if negative) to user portfolio's fund
+// Compare-and-swap on the version read with the portfolio: if another transaction updated the fund since,
+// nothing is written and database.ErrConflict is returned, so the caller retries with fresh funds
+func updateFund(tx *gorm.DB, userPortfolio *database.UserPortfolio, amount money.Money) error {
+	result := tx.Model(&database.UserPortfolio{}).
+		Where("id = ? AND version = ?", userPortfolio.ID, userPortfolio.Version).
+		Updates(map[string]any{
+			"fund_cents": gorm.Expr("fund_cents + ?", amount),
+			"version":    gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update user portfolio funds: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user portfolio %d changed since read: %w", userPortfolio.ID, database.ErrConflict)
+	}
+	userPortfolio.Fund += amount
+	userPortfolio.Version++
+	return nil
+}
+
+// PRIVATE: Get contributions per recurring plan since the start of each plan's current period
+func getPeriodContributions(
+	l ledger,
 	plans []database.UserDepositPlan,
-	transaction *database.Transaction,
-	fund float64,
-) (map[string]float64, error) {
+	now time.Time,
+) (strategies.Contributions, error) {
+	contributions := make(strategies.Contributions)
+	for _, plan := range plans {
+		periodStart, recurring := strategies.PeriodStart(plan.Type, now)
+		if !recurring {
+			continue
+		}
 
-	remainder := fund
-	total := 0.0
-	results := make(map[string]float64)
+		contributed, err := l.sumDeposits(plan.ID, periodStart)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get period contributions (plan: %d): %w", plan.ID, err)
+		}
+		contributions[plan.ID] = contributed
+	}
+	return contributions, nil
+}
 
-	// Calculate total planned amount
-	// Use this to calculate the ratio for allocation
-	for _, plan := range plans {
-		total += plan.Amount
+// PRIVATE: Let the strategy split amount across plans, against their current funds and period contributions
+// Nothing is written. Without plans, nothing is allocated.
+// Returns the allocations, the balances they were decided against, and every plan portfolio as read
+// => { PortfolioReferenceID : UserPortfolio }, so fund updates can detect concurrent changes
+func planAllocations(
+	l ledger,
+	plans []database.UserDepositPlan,
+	strategy strategies.AllocationStrategy,
+	amount money.Money,
+) ([]strategies.Allocation, strategies.Balances, map[string]*database.UserPortfolio, error) {
+	userPortfolios := make(map[string]*database.UserPortfolio)
+	if len(plans) == 0 {
+		return nil, strategies.Balances{}, userPortfolios, nil
 	}
 
-	for i, plan := range plans {
-		allocatedAmount := 0.0
+	// Get current funds for every plan portfolio, and contributions for the current period
+	funds := make(strategies.Funds)
+	for _, plan := range plans {
+		if _, exists := funds[plan.PortfolioID]; exists {
+			continue
+		}
+		userPortfolio, err := l.getUserPortfolio(plan.UserID, plan.PortfolioID)
+		if err != nil {
+			return nil, strategies.Balances{}, nil, err
+		}
+		userPortfolios[plan.Portfolio.ReferenceID] = userPortfolio
+		funds[plan.PortfolioID] = userPortfolio.Fund
+	}
+	contributions, err := getPeriodContributions(l, plans, database.Now())
+	if err != nil {
+		return nil, strategies.Balances{}, nil, err
+	}
+	balances := strategies.Balances{Funds: funds, Contributions: contributions}
 
-		// Calculate ration to use for allocation
-		ratio := plan.Amount / total
+	allocations, err := strategy.Allocate(plans, balances, amount)
+	if err != nil {
+		return nil, strategies.Balances{}, nil, err
+	}
+	return allocations, balances, userPortfolios, nil
+}
 
-		// Last portfolio gets the remaining amount
-		if i == len(plans)-1 {
-			allocatedAmount = remainder
-		} else {
-			allocatedAmount = fund * ratio
+// PRIVATE: Record strategy allocations as deposits, one per plan, along with every allocation decision
+// Returns allocated funds per portfolio => { PortfolioReferenceID : Allocated Fund }
+func allocateFunds(
+	l ledger,
+	transaction *database.Transaction,
+	strategyType configs.AllocationStrategyType,
+	allocations []strategies.Allocation,
+	balances strategies.Balances,
+) (_ map[string]money.Money, err error) {
+	ctx := l.context()
+	spanCtx, span := tracing.Start(&ctx, "repositories.allocateFunds",
+		attribute.String(logging.TransactionIDKey, transaction.ReferenceID), attribute.Int("allocations", len(allocations)))
+	defer func() { tracing.End(span, err) }()
+	l = l.withContext(*spanCtx)
+
+	results := make(map[string]money.Money)
+
+	// A plan may be allocated to by several steps; keep a single deposit per plan
+	var plans []database.UserDepositPlan
+	planTotals := make(map[uint]money.Money)
+	for _, allocation := range allocations {
+		if _, exists := planTotals[allocation.Plan.ID]; !exists {
+			plans = append(plans, allocation.Plan)
 		}
+		planTotals[allocation.Plan.ID] += allocation.Amount
+	}
 
+	depositIDs := make(map[uint]uint)
+	for _, plan := range plans {
 		// Create  deposit
 		deposit := database.Deposit{
-			Transaction: *transaction,
-			Plan:        plan,
-			Amount:      allocatedAmount,
+			TransactionID: transaction.ID,
+			PlanID:        plan.ID,
+			Amount:        planTotals[plan.ID],
 		}
-		err := tx.Create(&deposit).Error
+		err := l.createDeposit(&deposit)
 		if err != nil {
 			return nil, err
 		}
+		depositIDs[plan.ID] = deposit.ID
 
 		// Update allocated funds
-		if _, exists := results[plan.Portfolio.ReferenceID]; !exists {
-			results[plan.Portfolio.ReferenceID] = 0
-		}
 		results[plan.Portfolio.ReferenceID] += deposit.Amount
+	}
 
-		// Deduct allocated amount from allocation pool
-		remainder -= deposit.Amount
-		if remainder < 0 {
-			remainder = 0
-		}
-
-		fmt.Printf("\t\t- Allocated %f to '%s' deposit plan. Ratio: %.4f, Plan: %.2f, Total: %.2f, Remainder: %.2f\n",
-			deposit.Amount, plan.Portfolio.ReferenceID, ratio, plan.Amount, results[plan.Portfolio.ReferenceID], remainder)
-
-		if remainder <= 0 {
-			break
+	decisions := allocationDecisions(transaction, strategyType, allocations, balances, depositIDs)
+	if len(decisions) > 0 {
+		if err := l.createDecisions(decisions); err != nil {
+			return nil, fmt.Errorf("failed to record allocation decisions: %w", err)
 		}
 	}
 
@@ -95,202 +175,241 @@ func allocateFunds(
 }
 
 // PUBLIC: Create transaction records for deposits
-func CreateDepositTransactions(
+// A request with the reference ID of an existing transaction is a replay: the existing transaction is returned
+// (marked `Replayed`) instead of creating a new one. Reusing a reference ID for a different user, type or amount
+// is refused with ErrIdempotencyConflict.
+func (s *Store) CreateDepositTransactions(
 	ctx *context.Context,
 	userReferenceID string,
-	amounts []float64,
-) ([]database.Transaction, error) {
-	db := database.WithContext(ctx)
+	requests []TransactionRequest,
+) (_ []database.Transaction, err error) {
+	ctx, span := tracing.Start(ctx, "repositories.CreateDepositTransactions",
+		attribute.String(logging.UserIDKey, userReferenceID), attribute.Int("requests", len(requests)))
+	defer func() { tracing.End(span, err) }()
 
-	user, err := GetUser(ctx, userReferenceID)
+	user, err := s.GetUser(ctx, userReferenceID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user for reference ID (%s): %w", userReferenceID, err)
 	}
+	return createDepositTransactions(s.unitOfWork(ctx), s.metrics, user, requests)
+}
 
-	transactions := make([]database.Transaction, 0, len(amounts))
-	for _, amount := range amounts {
-		trxnReferenceID := uuid.New().String()
-		transaction := database.Transaction{
-			ReferenceID: trxnReferenceID,
-			User:        *user,
-			Type:        configs.TrxnTypeDeposit,
-			Amount:      amount,
-			Processed:   false,
-		}
-		transactions = append(transactions, transaction)
-	}
-	err = db.Create(&transactions).Error
+// PRIVATE: Create deposit transactions for user's requests, recording metrics
+func createDepositTransactions(
+	work unitOfWork,
+	metrics *metrics.Metrics,
+	user *database.User,
+	requests []TransactionRequest,
+) ([]database.Transaction, error) {
+	transactions, err := createTransactions(work, user, configs.TrxnTypeDeposit, requests)
 	if err != nil {
 		return nil, fmt.Errorf(
-			"failed to create transaction for user reference ID (%s) and amounts (%v): %w",
-			userReferenceID, amounts, err,
+			"failed to create transaction for user reference ID (%s) and requests (%v): %w",
+			user.ReferenceID, requests, err,
 		)
 	}
 
+	for _, transaction := range transactions {
+		metrics.TransactionCreated(transaction.Type, transaction.Replayed)
+	}
 	return transactions, nil
 }
 
-// PUBLIC: Deposit funds fairly to user's deposit plan portfolios
-func DepositFunds(
-	ctx *context.Context,
-	transactions []database.Transaction,
+// PRIVATE: Allocate a single pending transaction to plans using the strategy
+// Any amount the strategy leaves unallocated (or everything, if there are no plans) is credited to the user's cash,
+// and the transaction ends up 'partially-allocated' instead of 'completed'
+// Each portfolio's share is credited to its assets by target weight, or directed to underweight assets if rebalancing
+// on deposit
+// Returns updated funds per portfolio => { PortfolioReferenceID : Fund },
+// and allocated amount per portfolio => { PortfolioReferenceID : Allocated Fund }
+func depositTransaction(
+	l ledger,
+	transaction *database.Transaction,
 	plans []database.UserDepositPlan,
-) (map[string]float64, error) {
+	strategy strategies.AllocationStrategy,
+	rebalanceOnDeposit bool,
+) (map[string]money.Money, map[string]money.Money, error) {
 
-	deposits := make(map[string]float64)
+	deposits := make(map[string]money.Money)
 
-	// Use a transaction to ensure atomicity
-	// Calculate total amount to be allocated
-	// Iterate over plans and allocate funds based on the plan amounts
-	err := database.WithTransaction(ctx, func(tx *gorm.DB) error {
+	err := transitionTransaction(l, transaction, configs.TrxnStatusProcessing, "")
+	if err != nil {
+		return nil, nil, err
+	}
 
-		for _, transaction := range transactions {
+	allocations, balances, userPortfolios, err := planAllocations(l, plans, strategy, transaction.Amount)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to allocate funds for user %s: %w", transaction.User.ReferenceID, err)
+	}
 
-			// Strategy:
-			// 1. First allocate funds to 'one-time' plan portfolios till planned amount is met
-			// 2. Then allocate funds to 'monthly' plan portfolios till planned amount is met
-			// 3. If both 'one-time' & 'monthly' planned amount are met, distribute funds equally to both
-
-			// Track all plan portfolios
-			portfolios := make(map[string]database.Portfolio)
-
-			// Separate plans into one-time and monthly
-			var oneTimePlans []database.UserDepositPlan
-			var monthlyPlans []database.UserDepositPlan
-			for _, plan := range plans {
-				portfolios[plan.Portfolio.ReferenceID] = plan.Portfolio
-				switch plan.Type {
-				case configs.PlanTypeOnceTime:
-					oneTimePlans = append(oneTimePlans, plan)
-				case configs.PlanTypeMonthly:
-					monthlyPlans = append(monthlyPlans, plan)
-				}
-			}
-			if len(monthlyPlans) == 0 && len(oneTimePlans) == 0 {
-				return fmt.Errorf("no deposit plans found for user %s", transaction.User.ReferenceID)
-			}
+	results, err := allocateFunds(l, transaction, strategy.Type(), allocations, balances)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to deposit to plans: %w", err)
+	}
 
-			// Get total current funds and total planned amounts for one-time and monthly plans
-			totalOneTimeFund, totalOneTimePlanAmount := 0.0, 0.0
-			totalMonthlyFund, totalMonthlyPlanAmount := 0.0, 0.0
-
-			// Calculate total funds and planned amounts for both types
-			if len(oneTimePlans) > 0 {
-				for _, plan := range oneTimePlans {
-					totalOneTimePlanAmount += plan.Amount
-					fund, err := getFund(tx, plan.User.ID, plan.Portfolio.ID)
-					if err != nil {
-						return err
-					}
-					totalOneTimeFund += fund
-				}
-			}
-			if len(monthlyPlans) > 0 {
-				for _, plan := range monthlyPlans {
-					totalMonthlyPlanAmount += plan.Amount
-					fund, err := getFund(tx, plan.User.ID, plan.Portfolio.ID)
-					if err != nil {
-						return err
-					}
-					totalMonthlyFund += fund
-				}
-			}
+	// Update user portfolio funds, and their assets' holdings at prices on the transaction's date
+	day := prices.Day(transaction.CreatedAt)
+	allocated := money.Zero
+	for portfolioReferenceID, funds := range results {
+		userPortfolio := userPortfolios[portfolioReferenceID]
+		err := l.updateFund(userPortfolio, funds)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := creditHoldings(l, userPortfolio, transaction, funds, day, rebalanceOnDeposit); err != nil {
+			return nil, nil, err
+		}
+		deposits[portfolioReferenceID] = userPortfolio.Fund
+		allocated += funds
+	}
 
-			// Begin allocation
-			remainingFund := transaction.Amount
-			results := make(map[string]float64)
-
-			// Step 1: Allocate to 'one-time' plans
-			remainingOneTimeAllocation := totalOneTimePlanAmount - totalOneTimeFund
-			oneTimeAllocation := math.Min(remainingFund, remainingOneTimeAllocation)
-
-			if oneTimeAllocation > 0 {
-				fmt.Printf("\t- Depositing %.2f to one-time plans for user %s\n", oneTimeAllocation, transaction.User.ReferenceID)
-				oneTimeResult, err := allocateFunds(tx, oneTimePlans, &transaction, oneTimeAllocation)
-				if err != nil {
-					return fmt.Errorf("failed to deposit to one-time plans: %w", err)
-				}
-				for portfolioReferenceID, funds := range oneTimeResult {
-					results[portfolioReferenceID] += funds
-				}
-				remainingFund -= oneTimeAllocation
-			}
+	// Keep every unallocated cent as cash
+	status := configs.TrxnStatusCompleted
+	reason := ""
+	if unallocated := transaction.Amount - allocated; unallocated > 0 {
+		userCash, err := l.getUserCash(transaction.User.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := l.creditCash(userCash, transaction, unallocated); err != nil {
+			return nil, nil, err
+		}
+		status = configs.TrxnStatusPartiallyAllocated
+		reason = fmt.Sprintf("%s unallocated credited to cash", unallocated)
+	}
 
-			// Step 2: Allocate to 'monthly' plans
-			remainingMonthlyAllocation := totalMonthlyPlanAmount - totalMonthlyFund
-			monthlyAllocation := math.Min(remainingFund, remainingMonthlyAllocation)
-
-			if monthlyAllocation > 0 {
-				fmt.Printf("\t- Depositing %.2f to monthly plans for user %s\n", monthlyAllocation, transaction.User.ReferenceID)
-				monthlyResult, err := allocateFunds(tx, monthlyPlans, &transaction, monthlyAllocation)
-				if err != nil {
-					return fmt.Errorf("failed to deposit to monthly plans: %w", err)
-				}
-				for portfolioReferenceID, funds := range monthlyResult {
-					results[portfolioReferenceID] += funds
-				}
-				remainingFund -= monthlyAllocation
-			}
+	err = transitionTransaction(l, transaction, status, reason)
+	if err != nil {
+		return nil, nil, err
+	}
+	slog.InfoContext(logging.WithTransactionID(l.context(), transaction.ReferenceID), "Deposit allocated",
+		"amount", transaction.Amount, "strategy", strategy.Type(), "status", status, "allocations", results)
+	return deposits, results, nil
+}
 
-			// Step 3: Split remaining fund equally if both are fully funded
-			if remainingFund > 0 && remainingOneTimeAllocation <= 0 && remainingMonthlyAllocation <= 0 {
-				splitFund := remainingFund / 2
-
-				if len(oneTimePlans) > 0 {
-					fmt.Printf("\t- Equally splitting: Depositing %.2f of %.2f to one-time plans for user %s\n",
-						splitFund, remainingFund, transaction.User.ReferenceID)
-					oneTimeResult, err := allocateFunds(tx, oneTimePlans, &transaction, splitFund)
-					if err != nil {
-						return fmt.Errorf("failed to deposit to one-time plans in split: %w", err)
-					}
-					for portfolioReferenceID, funds := range oneTimeResult {
-						results[portfolioReferenceID] += funds
-					}
-				}
-
-				if len(monthlyPlans) > 0 {
-					leftOverFund := remainingFund - splitFund
-					fmt.Printf("\t- Equally splitting: Depositing %.2f of %.2f to monthly plans for user %s\n",
-						leftOverFund, remainingFund, transaction.User.ReferenceID)
-					monthlyResult, err := allocateFunds(tx, monthlyPlans, &transaction, leftOverFund)
-					if err != nil {
-						return fmt.Errorf("failed to deposit to monthly plans in split: %w", err)
-					}
-					for portfolioReferenceID, funds := range monthlyResult {
-						results[portfolioReferenceID] += funds
-					}
-				}
-			}
+// PUBLIC: Deposit funds to user's deposit plan portfolios using the given allocation strategy
+// Transactions are processed atomically; if any fails, all are rolled back and marked 'failed'
+// On a concurrent update of the same funds, the whole batch is rolled back and allocated again
+func (s *Store) DepositFunds(
+	ctx *context.Context,
+	transactions []database.Transaction,
+	plans []database.UserDepositPlan,
+	strategy strategies.AllocationStrategy,
+) (_ map[string]money.Money, err error) {
+	ctx, span := tracing.Start(ctx, "repositories.DepositFunds",
+		attribute.String("strategy", string(strategy.Type())), attribute.Int("transactions", len(transactions)))
+	defer func() { tracing.End(span, err) }()
 
-			// Update user portfolio funds
-			for portfolioReferenceID, funds := range results {
-				var userPortfolio database.UserPortfolio
-				err := tx.Where(&database.UserPortfolio{
-					UserID:      transaction.User.ID,
-					PortfolioID: portfolios[portfolioReferenceID].ID,
-				}).First(&userPortfolio).Error
-				if err != nil {
-					return fmt.Errorf("failed to get user portfolio for reference ID (%s): %w", portfolioReferenceID, err)
-				}
-				userPortfolio.Fund += funds
-				err = tx.Save(&userPortfolio).Error
-				if err != nil {
-					return fmt.Errorf("failed to update user portfolio funds: %w", err)
-				}
-				deposits[portfolioReferenceID] = userPortfolio.Fund
-			}
+	return depositFunds(s.unitOfWork(ctx), s.metrics, transactions, plans, strategy, s.config.RebalanceOnDeposit)
+}
+
+// PRIVATE: Deposit transactions to plans in a single unit of work, recording metrics
+// If any fails, all are rolled back and marked 'failed'
+// Returns updated funds per portfolio => { PortfolioReferenceID : Fund }
+func depositFunds(
+	work unitOfWork,
+	metrics *metrics.Metrics,
+	transactions []database.Transaction,
+	plans []database.UserDepositPlan,
+	strategy strategies.AllocationStrategy,
+	rebalanceOnDeposit bool,
+) (map[string]money.Money, error) {
+	deposits := make(map[string]money.Money)
+	allocated := make(map[string]money.Money)
+	var statuses []configs.TransactionStatus
+
+	// Read current funds, let the strategy decide the split, then record deposits
+	start := time.Now()
+	err := work(func(l ledger) error {
+		clear(deposits)
+		clear(allocated)
+		statuses = statuses[:0]
+
+		for _, transaction := range transactions {
 
-			// Mark transaction as processed
-			transaction.Processed = true
-			err := tx.Save(&transaction).Error
+			results, amounts, err := depositTransaction(l, &transaction, plans, strategy, rebalanceOnDeposit)
 			if err != nil {
-				return fmt.Errorf("failed to update transaction status: %w", err)
+				return err
 			}
+			for portfolioReferenceID, fund := range results {
+				deposits[portfolioReferenceID] = fund
+			}
+			for portfolioReferenceID, amount := range amounts {
+				allocated[portfolioReferenceID] += amount
+			}
+			statuses = append(statuses, transaction.Status)
 
 		}
 
 		return nil
 	})
+	metrics.AllocationObserved(strategy.Type(), time.Since(start), err)
+	if err != nil {
+		for _, transaction := range transactions {
+			metrics.TransactionProcessed(transaction.Type, configs.TrxnStatusFailed)
+		}
+		return nil, failTransactions(work, transactions, err)
+	}
+
+	// Only committed deposits are recorded
+	for i, transaction := range transactions {
+		metrics.TransactionProcessed(transaction.Type, statuses[i])
+	}
+	metrics.Allocated(allocated)
+	return deposits, nil
+}
+
+// PUBLIC: Get how amount would be allocated to the plans by the strategy, exactly as DepositFunds would,
+// without persisting anything. Unallocated amount would be credited to cash.
+func (s *Store) PreviewDeposit(
+	ctx *context.Context,
+	plans []database.UserDepositPlan,
+	strategy strategies.AllocationStrategy,
+	amount money.Money,
+) ([]strategies.Allocation, error) {
+	var allocations []strategies.Allocation
+
+	// Read funds and contributions in a single DB transaction, for a consistent view
+	err := s.withTransaction(ctx, func(tx *gorm.DB) error {
+		var err error
+		allocations, _, _, err = planAllocations(dbLedger{tx}, plans, strategy, amount)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview deposit of %s: %w", amount, err)
+	}
+	return allocations, nil
+}
+
+// PUBLIC: Get what a deposit transaction was allocated, by reference ID
+// Returns allocated amount per portfolio => { PortfolioReferenceID : Allocated Fund }, and the amount credited to cash
+func (s *Store) GetTransactionAllocations(
+	ctx *context.Context,
+	referenceID string,
+) (map[string]money.Money, money.Money, error) {
+	transaction, err := s.GetTransaction(ctx, referenceID)
+	if err != nil {
+		return nil, 0, err
+	}
+	db := s.withContext(ctx)
 
-	return deposits, err
+	var deposits []database.Deposit
+	err = db.Preload("Plan.Portfolio").Where(&database.Deposit{TransactionID: transaction.ID}).Find(&deposits).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get deposits for transaction (%s): %w", referenceID, err)
+	}
+	allocations := make(map[string]money.Money)
+	for _, deposit := range deposits {
+		allocations[deposit.Plan.Portfolio.ReferenceID] += deposit.Amount
+	}
+
+	var cash money.Money
+	err = db.Model(&database.CashEntry{}).
+		Select("COALESCE(SUM(amount_cents), 0)").
+		Where("transaction_id = ?", transaction.ID).
+		Scan(&cash).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get cash entries for transaction (%s): %w", referenceID, err)
+	}
+	return allocations, cash, nil
 }
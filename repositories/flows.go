@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+	"portfolio-investment/prices"
+	"sort"
+	"time"
+)
+
+// Money moved into or out of a user portfolio
+type CashFlow struct {
+	PortfolioReferenceID string
+	CreatedAt            time.Time
+	Amount               money.Money // Positive deposits, negative withdrawals
+}
+
+// PUBLIC: Get user's deposits to and withdrawals from portfolios from the start of one day to the end of another,
+// in the order they were made
+func (s *Store) GetCashFlows(ctx *context.Context, userReferenceID string, from time.Time, to time.Time) ([]CashFlow, error) {
+	user, err := s.GetUser(ctx, userReferenceID)
+	if err != nil {
+		return nil, err
+	}
+	db := s.withContext(ctx)
+	start := prices.Day(from)
+	end := prices.Day(to).AddDate(0, 0, 1)
+
+	var deposits []CashFlow
+	err = db.Model(&database.Deposit{}).
+		Select("portfolios.reference_id AS portfolio_reference_id, deposits.created_at, deposits.amount_cents AS amount").
+		Joins("JOIN user_deposit_plans ON user_deposit_plans.id = deposits.plan_id").
+		Joins("JOIN portfolios ON portfolios.id = user_deposit_plans.portfolio_id").
+		Where("user_deposit_plans.user_id = ? AND deposits.created_at >= ? AND deposits.created_at < ?", user.ID, start, end).
+		Scan(&deposits).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deposits of user %s: %w", userReferenceID, err)
+	}
+
+	var withdrawals []CashFlow
+	err = db.Model(&database.Withdrawal{}).
+		Select("portfolios.reference_id AS portfolio_reference_id, withdrawals.created_at, -withdrawals.amount_cents AS amount").
+		Joins("JOIN user_portfolios ON user_portfolios.id = withdrawals.user_portfolio_id").
+		Joins("JOIN portfolios ON portfolios.id = user_portfolios.portfolio_id").
+		Where("user_portfolios.user_id = ? AND withdrawals.created_at >= ? AND withdrawals.created_at < ?", user.ID, start, end).
+		Scan(&withdrawals).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get withdrawals of user %s: %w", userReferenceID, err)
+	}
+
+	flows := append(deposits, withdrawals...)
+	sort.SliceStable(flows, func(i, j int) bool { return flows[i].CreatedAt.Before(flows[j].CreatedAt) })
+	return flows, nil
+}
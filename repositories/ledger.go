@@ -0,0 +1,184 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Reads and writes the deposit pipeline makes within a single unit of work
+// The pipeline (transactions, allocations, deposits, holdings and cash) is shared by both repositories; only these
+// differ: dbLedger works on a DB transaction for Store, and memoryLedger on a copy of the state for MemoryRepository
+type ledger interface {
+	context() context.Context
+	withContext(ctx context.Context) ledger
+
+	// Transaction by reference ID with its user, or nil if there is none
+	findTransaction(referenceID string) (*database.Transaction, error)
+	createTransaction(transaction *database.Transaction) error
+	// Compare-and-swap on the transaction's status; false if it is no longer the stored status
+	updateTransactionStatus(
+		transaction *database.Transaction,
+		to configs.TransactionStatus,
+		failureReason string,
+		attempted bool,
+	) (bool, error)
+	createTransition(transition *database.TransactionTransition) error
+
+	getUserPortfolio(userID uint, portfolioID uint) (*database.UserPortfolio, error)
+	updateFund(userPortfolio *database.UserPortfolio, amount money.Money) error
+	// Sum of plan's deposits created since a time
+	sumDeposits(planID uint, since time.Time) (money.Money, error)
+	createDeposit(deposit *database.Deposit) error
+	createDecisions(decisions []database.AllocationDecision) error
+	getUserCash(userID uint) (*database.UserCash, error)
+	creditCash(userCash *database.UserCash, transaction *database.Transaction, amount money.Money) error
+
+	getPortfolioAssets(portfolioID uint) ([]database.PortfolioAsset, error)
+	getHoldings(userPortfolioID uint) ([]database.Holding, error)
+	// Holding's entries, oldest first
+	getHoldingEntries(holdingID uint) ([]database.HoldingEntry, error)
+	updateHolding(
+		userPortfolioID uint,
+		assetID uint,
+		transaction *database.Transaction,
+		amount money.Money,
+		units float64,
+	) error
+	priceOn(assetID uint, day time.Time) (money.Money, error)
+}
+
+// Unit of work: runs handler on a ledger whose writes are kept only if handler succeeds
+type unitOfWork func(handler func(l ledger) error) error
+
+// Ledger on a DB transaction
+type dbLedger struct {
+	tx *gorm.DB
+}
+
+var (
+	_ ledger = dbLedger{}
+	_ ledger = memoryLedger{}
+)
+
+// PRIVATE: Unit of work in a DB transaction, retried as a whole on conflict
+func (s *Store) unitOfWork(ctx *context.Context) unitOfWork {
+	return func(handler func(l ledger) error) error {
+		return s.withRetry(ctx, func(tx *gorm.DB) error {
+			return handler(dbLedger{tx})
+		})
+	}
+}
+
+func (l dbLedger) context() context.Context {
+	return l.tx.Statement.Context
+}
+
+func (l dbLedger) withContext(ctx context.Context) ledger {
+	return dbLedger{l.tx.WithContext(ctx)}
+}
+
+func (l dbLedger) findTransaction(referenceID string) (*database.Transaction, error) {
+	var transactions []database.Transaction
+	err := l.tx.Preload("User").Where(&database.Transaction{ReferenceID: referenceID}).Limit(1).Find(&transactions).Error
+	if err != nil || len(transactions) == 0 {
+		return nil, err
+	}
+	return &transactions[0], nil
+}
+
+func (l dbLedger) createTransaction(transaction *database.Transaction) error {
+	return l.tx.Create(transaction).Error
+}
+
+func (l dbLedger) updateTransactionStatus(
+	transaction *database.Transaction,
+	to configs.TransactionStatus,
+	failureReason string,
+	attempted bool,
+) (bool, error) {
+	updates := map[string]any{"status": to, "failure_reason": failureReason}
+	if attempted {
+		updates["attempts"] = gorm.Expr("attempts + 1")
+	}
+	result := l.tx.Model(&database.Transaction{}).
+		Where("id = ? AND status = ?", transaction.ID, transaction.Status).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (l dbLedger) createTransition(transition *database.TransactionTransition) error {
+	return l.tx.Create(transition).Error
+}
+
+func (l dbLedger) getUserPortfolio(userID uint, portfolioID uint) (*database.UserPortfolio, error) {
+	return getUserPortfolio(l.tx, userID, portfolioID)
+}
+
+func (l dbLedger) updateFund(userPortfolio *database.UserPortfolio, amount money.Money) error {
+	return updateFund(l.tx, userPortfolio, amount)
+}
+
+func (l dbLedger) sumDeposits(planID uint, since time.Time) (money.Money, error) {
+	var sum money.Money
+	err := l.tx.Model(&database.Deposit{}).
+		Select("COALESCE(SUM(amount_cents), 0)").
+		Where("plan_id = ? AND created_at >= ?", planID, since).
+		Scan(&sum).Error
+	return sum, err
+}
+
+func (l dbLedger) createDeposit(deposit *database.Deposit) error {
+	return l.tx.Create(deposit).Error
+}
+
+func (l dbLedger) createDecisions(decisions []database.AllocationDecision) error {
+	return l.tx.Create(&decisions).Error
+}
+
+func (l dbLedger) getUserCash(userID uint) (*database.UserCash, error) {
+	return getUserCash(l.tx, userID)
+}
+
+func (l dbLedger) creditCash(userCash *database.UserCash, transaction *database.Transaction, amount money.Money) error {
+	return creditCash(l.tx, userCash, transaction, amount)
+}
+
+func (l dbLedger) getPortfolioAssets(portfolioID uint) ([]database.PortfolioAsset, error) {
+	return getPortfolioAssets(l.tx, portfolioID)
+}
+
+func (l dbLedger) getHoldings(userPortfolioID uint) ([]database.Holding, error) {
+	var holdings []database.Holding
+	if err := l.tx.Where(&database.Holding{UserPortfolioID: userPortfolioID}).Order("id").Find(&holdings).Error; err != nil {
+		return nil, fmt.Errorf("failed to get holdings of user portfolio %d: %w", userPortfolioID, err)
+	}
+	return holdings, nil
+}
+
+func (l dbLedger) getHoldingEntries(holdingID uint) ([]database.HoldingEntry, error) {
+	var entries []database.HoldingEntry
+	if err := l.tx.Where(&database.HoldingEntry{HoldingID: holdingID}).Order("id").Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to get entries of holding %d: %w", holdingID, err)
+	}
+	return entries, nil
+}
+
+func (l dbLedger) updateHolding(
+	userPortfolioID uint,
+	assetID uint,
+	transaction *database.Transaction,
+	amount money.Money,
+	units float64,
+) error {
+	return updateHolding(l.tx, userPortfolioID, assetID, transaction, amount, units)
+}
+
+func (l dbLedger) priceOn(assetID uint, day time.Time) (money.Money, error) {
+	return priceOn(l.tx, assetID, day)
+}
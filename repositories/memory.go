@@ -0,0 +1,783 @@
+package repositories
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/metrics"
+	"portfolio-investment/money"
+	"portfolio-investment/prices"
+	"portfolio-investment/strategies"
+	"slices"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Repository kept in memory, with the semantics of Store: unique reference IDs, all-or-nothing writes,
+// and referenced records must exist. For unit tests of services and strategies without a database.
+// Safe for concurrent use; calls are serialized, so there are never conflicts to retry.
+// Deposits run through the same pipeline as Store's, on a memoryLedger instead of a DB transaction.
+type MemoryRepository struct {
+	mu      sync.Mutex
+	state   memoryState
+	config  *configs.AppConfig
+	metrics *metrics.Metrics
+}
+
+// Records with their association IDs only; associations are filled in on the copies returned
+type memoryState struct {
+	lastID          uint
+	portfolios      []database.Portfolio
+	users           []database.User
+	userPortfolios  []database.UserPortfolio
+	userCash        []database.UserCash
+	plans           []database.UserDepositPlan
+	transactions    []database.Transaction
+	transitions     []database.TransactionTransition
+	deposits        []database.Deposit
+	cashEntries     []database.CashEntry
+	decisions       []database.AllocationDecision
+	assets          []database.Asset
+	portfolioAssets []database.PortfolioAsset
+	holdings        []database.Holding
+	holdingEntries  []database.HoldingEntry
+	assetPrices     []database.AssetPrice
+}
+
+// Ledger on a copy of the in-memory state
+type memoryLedger struct {
+	ctx   context.Context
+	state *memoryState
+}
+
+// PUBLIC: Build an empty in-memory repository, with deposit settings from config, recording metrics (nil records none)
+func NewMemoryRepository(config *configs.AppConfig, metrics *metrics.Metrics) *MemoryRepository {
+	return &MemoryRepository{config: config, metrics: metrics}
+}
+
+// PUBLIC: Metrics recorded by the repository, if any
+func (m *MemoryRepository) Metrics() *metrics.Metrics {
+	return m.metrics
+}
+
+// PRIVATE: Read the state
+func (m *MemoryRepository) view(ctx *context.Context, handler func(state *memoryState) error) error {
+	if err := (*ctx).Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return handler(&m.state)
+}
+
+// PRIVATE: Write to a copy of the state, which replaces the state only if handler succeeds
+func (m *MemoryRepository) transaction(ctx *context.Context, handler func(state *memoryState) error) error {
+	if err := (*ctx).Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state := m.state.clone()
+	if err := handler(&state); err != nil {
+		return err
+	}
+	m.state = state
+	return nil
+}
+
+// PRIVATE: Unit of work on a copy of the state, which replaces the state only if handler succeeds
+func (m *MemoryRepository) unitOfWork(ctx *context.Context) unitOfWork {
+	return func(handler func(l ledger) error) error {
+		return m.transaction(ctx, func(state *memoryState) error {
+			return handler(memoryLedger{*ctx, state})
+		})
+	}
+}
+
+// PRIVATE: Copy of the state; records are values, so writes to the copy leave the original untouched
+func (s *memoryState) clone() memoryState {
+	return memoryState{
+		lastID:          s.lastID,
+		portfolios:      slices.Clone(s.portfolios),
+		users:           slices.Clone(s.users),
+		userPortfolios:  slices.Clone(s.userPortfolios),
+		userCash:        slices.Clone(s.userCash),
+		plans:           slices.Clone(s.plans),
+		transactions:    slices.Clone(s.transactions),
+		transitions:     slices.Clone(s.transitions),
+		deposits:        slices.Clone(s.deposits),
+		cashEntries:     slices.Clone(s.cashEntries),
+		decisions:       slices.Clone(s.decisions),
+		assets:          slices.Clone(s.assets),
+		portfolioAssets: slices.Clone(s.portfolioAssets),
+		holdings:        slices.Clone(s.holdings),
+		holdingEntries:  slices.Clone(s.holdingEntries),
+		assetPrices:     slices.Clone(s.assetPrices),
+	}
+}
+
+// PRIVATE: Model of a new record, with the next ID
+func (s *memoryState) newModel() gorm.Model {
+	s.lastID++
+	now := database.Now()
+	return gorm.Model{ID: s.lastID, CreatedAt: now, UpdatedAt: now}
+}
+
+// PRIVATE: Index of the first record matching, or -1
+func find[T any](records []T, match func(record *T) bool) int {
+	return slices.IndexFunc(records, func(record T) bool { return match(&record) })
+}
+
+// PRIVATE: Check that a record referenced by ID exists, like a foreign key
+func checkReference[T any](records []T, id uint, getID func(record *T) uint, name string) error {
+	if find(records, func(record *T) bool { return getID(record) == id }) < 0 {
+		return fmt.Errorf("%w: %s %d does not exist", gorm.ErrForeignKeyViolated, name, id)
+	}
+	return nil
+}
+
+// PRIVATE: Get user record by reference ID
+func (s *memoryState) getUser(referenceID string) (*database.User, error) {
+	i := find(s.users, func(user *database.User) bool { return user.ReferenceID == referenceID })
+	if i < 0 {
+		return nil, fmt.Errorf("user (%s): %w", referenceID, gorm.ErrRecordNotFound)
+	}
+	user := s.users[i]
+	return &user, nil
+}
+
+// PRIVATE: Get user record by ID, which must exist
+func (s *memoryState) getUserByID(id uint) database.User {
+	return s.users[find(s.users, func(user *database.User) bool { return user.ID == id })]
+}
+
+// PRIVATE: Get portfolio record by reference ID
+func (s *memoryState) getPortfolio(referenceID string) (*database.Portfolio, error) {
+	i := find(s.portfolios, func(portfolio *database.Portfolio) bool { return portfolio.ReferenceID == referenceID })
+	if i < 0 {
+		return nil, fmt.Errorf("failed to get portfolio for reference ID (%s): %w", referenceID, gorm.ErrRecordNotFound)
+	}
+	portfolio := s.portfolios[i]
+	return &portfolio, nil
+}
+
+// PRIVATE: Get portfolio record by ID, which must exist
+func (s *memoryState) getPortfolioByID(id uint) database.Portfolio {
+	return s.portfolios[find(s.portfolios, func(portfolio *database.Portfolio) bool { return portfolio.ID == id })]
+}
+
+// PRIVATE: Get deposit plan by ID, which must exist, with its user and portfolio
+func (s *memoryState) getPlanByID(id uint) database.UserDepositPlan {
+	plan := s.plans[find(s.plans, func(plan *database.UserDepositPlan) bool { return plan.ID == id })]
+	plan.User = s.getUserByID(plan.UserID)
+	plan.Portfolio = s.getPortfolioByID(plan.PortfolioID)
+	return plan
+}
+
+// PRIVATE: Get transaction record by reference ID, with its user
+func (s *memoryState) getTransaction(referenceID string) (*database.Transaction, error) {
+	i := find(s.transactions, func(transaction *database.Transaction) bool {
+		return transaction.ReferenceID == referenceID
+	})
+	if i < 0 {
+		return nil, fmt.Errorf("transaction (%s): %w", referenceID, gorm.ErrRecordNotFound)
+	}
+	transaction := s.transactions[i]
+	transaction.User = s.getUserByID(transaction.UserID)
+	return &transaction, nil
+}
+
+// PUBLIC: Create portfolio record with a unique reference ID
+func (m *MemoryRepository) CreatePortfolio(ctx *context.Context, referenceID string, name string) (*database.Portfolio, error) {
+	var portfolio database.Portfolio
+	err := m.transaction(ctx, func(state *memoryState) error {
+		if _, err := state.getPortfolio(referenceID); err == nil {
+			return fmt.Errorf("%w: portfolio reference ID (%s)", gorm.ErrDuplicatedKey, referenceID)
+		}
+		portfolio = database.Portfolio{Model: state.newModel(), ReferenceID: referenceID, Name: name}
+		state.portfolios = append(state.portfolios, portfolio)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &portfolio, nil
+}
+
+// PUBLIC: Create user record with a unique reference ID
+func (m *MemoryRepository) CreateUser(ctx *context.Context, referenceID string) (*database.User, error) {
+	var user database.User
+	err := m.transaction(ctx, func(state *memoryState) error {
+		if _, err := state.getUser(referenceID); err == nil {
+			return fmt.Errorf("%w: user reference ID (%s)", gorm.ErrDuplicatedKey, referenceID)
+		}
+		user = database.User{Model: state.newModel(), ReferenceID: referenceID}
+		state.users = append(state.users, user)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user for reference ID (%s): %w", referenceID, err)
+	}
+	return &user, nil
+}
+
+// PUBLIC: Get user's record by reference ID
+func (m *MemoryRepository) GetUser(ctx *context.Context, referenceID string) (*database.User, error) {
+	var user *database.User
+	err := m.view(ctx, func(state *memoryState) (err error) {
+		user, err = state.getUser(referenceID)
+		return err
+	})
+	return user, err
+}
+
+// PUBLIC: Get user's portfolios by reference ID
+func (m *MemoryRepository) GetUserPortfolios(ctx *context.Context, referenceID string) ([]database.UserPortfolio, error) {
+	var userPortfolios []database.UserPortfolio
+	err := m.view(ctx, func(state *memoryState) error {
+		user, err := state.getUser(referenceID)
+		if err != nil {
+			return err
+		}
+		for _, userPortfolio := range state.userPortfolios {
+			if userPortfolio.UserID == user.ID {
+				userPortfolio.User = *user
+				userPortfolio.Portfolio = state.getPortfolioByID(userPortfolio.PortfolioID)
+				userPortfolios = append(userPortfolios, userPortfolio)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return userPortfolios, nil
+}
+
+// PUBLIC: Get user's deposit plan record(s) by reference ID
+func (m *MemoryRepository) GetUserDepositPlans(ctx *context.Context, referenceID string) ([]database.UserDepositPlan, error) {
+	var plans []database.UserDepositPlan
+	err := m.view(ctx, func(state *memoryState) error {
+		user, err := state.getUser(referenceID)
+		if err != nil {
+			return err
+		}
+		for _, plan := range state.plans {
+			if plan.UserID == user.ID {
+				plans = append(plans, state.getPlanByID(plan.ID))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// PUBLIC: Create a deposit plan for user's portfolio, opening the user portfolio if needed
+func (m *MemoryRepository) CreateUserDepositPlan(
+	ctx *context.Context,
+	userReferenceID string,
+	portfolioReferenceID string,
+	planType configs.PlanType,
+	amount money.Money,
+) (*database.UserDepositPlan, error) {
+	var plan database.UserDepositPlan
+	err := m.transaction(ctx, func(state *memoryState) error {
+		user, err := state.getUser(userReferenceID)
+		if err != nil {
+			return fmt.Errorf("failed to get user for reference ID (%s): %w", userReferenceID, err)
+		}
+		portfolio, err := state.getPortfolio(portfolioReferenceID)
+		if err != nil {
+			return err
+		}
+
+		exists := find(state.plans, func(plan *database.UserDepositPlan) bool {
+			return plan.UserID == user.ID && plan.PortfolioID == portfolio.ID && plan.Type == planType
+		}) >= 0
+		if exists {
+			return fmt.Errorf("%w: %s plan for portfolio %s", ErrPlanExists, planType, portfolioReferenceID)
+		}
+
+		// Plans allocate into user portfolios, so make sure one exists
+		opened := find(state.userPortfolios, func(userPortfolio *database.UserPortfolio) bool {
+			return userPortfolio.UserID == user.ID && userPortfolio.PortfolioID == portfolio.ID
+		}) >= 0
+		if !opened {
+			state.userPortfolios = append(state.userPortfolios, database.UserPortfolio{
+				Model:       state.newModel(),
+				UserID:      user.ID,
+				PortfolioID: portfolio.ID,
+			})
+		}
+
+		plan = database.UserDepositPlan{
+			Model:       state.newModel(),
+			Type:        planType,
+			UserID:      user.ID,
+			PortfolioID: portfolio.ID,
+			Amount:      amount,
+		}
+		state.plans = append(state.plans, plan)
+		plan.User = *user
+		plan.Portfolio = *portfolio
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// PUBLIC: Create transaction records for deposits, with the idempotency rules of Store.CreateDepositTransactions
+func (m *MemoryRepository) CreateDepositTransactions(
+	ctx *context.Context,
+	userReferenceID string,
+	requests []TransactionRequest,
+) ([]database.Transaction, error) {
+	user, err := m.GetUser(ctx, userReferenceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user for reference ID (%s): %w", userReferenceID, err)
+	}
+	return createDepositTransactions(m.unitOfWork(ctx), m.metrics, user, requests)
+}
+
+// PUBLIC: Deposit funds to user's deposit plan portfolios using the given allocation strategy
+// Transactions are processed atomically; if any fails, all are rolled back and marked 'failed'
+func (m *MemoryRepository) DepositFunds(
+	ctx *context.Context,
+	transactions []database.Transaction,
+	plans []database.UserDepositPlan,
+	strategy strategies.AllocationStrategy,
+) (map[string]money.Money, error) {
+	return depositFunds(m.unitOfWork(ctx), m.metrics, transactions, plans, strategy, m.config.RebalanceOnDeposit)
+}
+
+// PUBLIC: Get transaction record by reference ID
+func (m *MemoryRepository) GetTransaction(ctx *context.Context, referenceID string) (*database.Transaction, error) {
+	var transaction *database.Transaction
+	err := m.view(ctx, func(state *memoryState) (err error) {
+		transaction, err = state.getTransaction(referenceID)
+		return err
+	})
+	return transaction, err
+}
+
+// PUBLIC: Get how amount would be allocated to the plans by the strategy, without persisting anything
+func (m *MemoryRepository) PreviewDeposit(
+	ctx *context.Context,
+	plans []database.UserDepositPlan,
+	strategy strategies.AllocationStrategy,
+	amount money.Money,
+) ([]strategies.Allocation, error) {
+	var allocations []strategies.Allocation
+	err := m.view(ctx, func(state *memoryState) (err error) {
+		allocations, _, _, err = planAllocations(memoryLedger{*ctx, state}, plans, strategy, amount)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview deposit of %s: %w", amount, err)
+	}
+	return allocations, nil
+}
+
+// PUBLIC: Get what a deposit transaction was allocated, by reference ID
+// Returns allocated amount per portfolio => { PortfolioReferenceID : Allocated Fund }, and the amount credited to cash
+func (m *MemoryRepository) GetTransactionAllocations(
+	ctx *context.Context,
+	referenceID string,
+) (map[string]money.Money, money.Money, error) {
+	allocations := make(map[string]money.Money)
+	cash := money.Zero
+	err := m.view(ctx, func(state *memoryState) error {
+		transaction, err := state.getTransaction(referenceID)
+		if err != nil {
+			return err
+		}
+		for _, deposit := range state.deposits {
+			if deposit.TransactionID == transaction.ID {
+				plan := state.getPlanByID(deposit.PlanID)
+				allocations[plan.Portfolio.ReferenceID] += deposit.Amount
+			}
+		}
+		for _, entry := range state.cashEntries {
+			if entry.TransactionID == transaction.ID {
+				cash += entry.Amount
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return allocations, cash, nil
+}
+
+// PUBLIC: Get every allocation decision made for a deposit transaction by reference ID, in the order they were made
+func (m *MemoryRepository) GetAllocationDecisions(ctx *context.Context, referenceID string) ([]database.AllocationDecision, error) {
+	var decisions []database.AllocationDecision
+	err := m.view(ctx, func(state *memoryState) error {
+		transaction, err := state.getTransaction(referenceID)
+		if err != nil {
+			return err
+		}
+		for _, decision := range state.decisions {
+			if decision.TransactionID != transaction.ID {
+				continue
+			}
+			if decision.PortfolioID != nil {
+				portfolio := state.getPortfolioByID(*decision.PortfolioID)
+				decision.Portfolio = &portfolio
+			}
+			decisions = append(decisions, decision)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return decisions, nil
+}
+
+// PUBLIC: Create asset record, quoted in USD like the column default
+func (m *MemoryRepository) CreateAsset(ctx *context.Context, name string, class string, ticker string) (*database.Asset, error) {
+	var asset database.Asset
+	err := m.transaction(ctx, func(state *memoryState) error {
+		asset = database.Asset{Model: state.newModel(), Name: name, Class: class, Ticker: ticker, Currency: "USD"}
+		state.assets = append(state.assets, asset)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// PUBLIC: Replace portfolio's composition, with the rules of Store.SetPortfolioAssets
+func (m *MemoryRepository) SetPortfolioAssets(
+	ctx *context.Context,
+	portfolioReferenceID string,
+	weights []AssetWeight,
+) ([]database.PortfolioAsset, error) {
+	if err := validateComposition(weights); err != nil {
+		return nil, err
+	}
+
+	var portfolioAssets []database.PortfolioAsset
+	err := m.transaction(ctx, func(state *memoryState) error {
+		portfolio, err := state.getPortfolio(portfolioReferenceID)
+		if err != nil {
+			return err
+		}
+		for _, weight := range weights {
+			if find(state.assets, func(asset *database.Asset) bool { return asset.ID == weight.AssetID }) < 0 {
+				return fmt.Errorf("assets %d: %w", weight.AssetID, gorm.ErrRecordNotFound)
+			}
+		}
+
+		state.portfolioAssets = slices.DeleteFunc(state.portfolioAssets, func(portfolioAsset database.PortfolioAsset) bool {
+			return portfolioAsset.PortfolioID == portfolio.ID
+		})
+		for _, weight := range weights {
+			state.portfolioAssets = append(state.portfolioAssets, database.PortfolioAsset{
+				Model:       state.newModel(),
+				PortfolioID: portfolio.ID,
+				AssetID:     weight.AssetID,
+				Weight:      weight.Weight,
+			})
+		}
+		portfolioAssets, err = memoryLedger{*ctx, state}.getPortfolioAssets(portfolio.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return portfolioAssets, nil
+}
+
+// PUBLIC: Save quotes as asset prices, with the rules of Store.SaveAssetPrices
+// Returns the number of prices saved
+func (m *MemoryRepository) SaveAssetPrices(ctx *context.Context, quotes []prices.Quote) (int, error) {
+	var assetPrices []database.AssetPrice
+	err := m.transaction(ctx, func(state *memoryState) error {
+		resolved, err := resolveQuotes(state.assets, quotes)
+		if err != nil {
+			return err
+		}
+		assetPrices = resolved
+		for _, assetPrice := range assetPrices {
+			i := find(state.assetPrices, func(stored *database.AssetPrice) bool {
+				return stored.AssetID == assetPrice.AssetID && stored.Date.Equal(assetPrice.Date)
+			})
+			if i >= 0 {
+				state.assetPrices[i].Price = assetPrice.Price
+				state.assetPrices[i].UpdatedAt = database.Now()
+				continue
+			}
+			assetPrice.Model = state.newModel()
+			state.assetPrices = append(state.assetPrices, assetPrice)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to save %d asset prices: %w", len(quotes), err)
+	}
+	return len(assetPrices), nil
+}
+
+// PUBLIC: Get user's holdings per portfolio and asset, by user reference ID
+func (m *MemoryRepository) GetUserHoldings(ctx *context.Context, referenceID string) ([]database.Holding, error) {
+	var holdings []database.Holding
+	err := m.view(ctx, func(state *memoryState) error {
+		user, err := state.getUser(referenceID)
+		if err != nil {
+			return err
+		}
+		for _, holding := range state.holdings {
+			userPortfolio := state.userPortfolios[find(state.userPortfolios, func(userPortfolio *database.UserPortfolio) bool {
+				return userPortfolio.ID == holding.UserPortfolioID
+			})]
+			if userPortfolio.UserID != user.ID {
+				continue
+			}
+			userPortfolio.Portfolio = state.getPortfolioByID(userPortfolio.PortfolioID)
+			holding.UserPortfolio = userPortfolio
+			holding.Asset = state.getAssetByID(holding.AssetID)
+			holdings = append(holdings, holding)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(holdings, func(a, b database.Holding) int {
+		return cmp.Or(cmp.Compare(a.UserPortfolioID, b.UserPortfolioID), cmp.Compare(a.AssetID, b.AssetID))
+	})
+	return holdings, nil
+}
+
+// PRIVATE: Get asset record by ID, which must exist
+func (s *memoryState) getAssetByID(id uint) database.Asset {
+	return s.assets[find(s.assets, func(asset *database.Asset) bool { return asset.ID == id })]
+}
+
+func (l memoryLedger) context() context.Context {
+	return l.ctx
+}
+
+func (l memoryLedger) withContext(ctx context.Context) ledger {
+	return memoryLedger{ctx, l.state}
+}
+
+func (l memoryLedger) findTransaction(referenceID string) (*database.Transaction, error) {
+	transaction, err := l.state.getTransaction(referenceID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return transaction, err
+}
+
+func (l memoryLedger) createTransaction(transaction *database.Transaction) error {
+	s := l.state
+	if err := checkReference(s.users, transaction.UserID, func(user *database.User) uint { return user.ID }, "user"); err != nil {
+		return err
+	}
+	if _, err := s.getTransaction(transaction.ReferenceID); err == nil {
+		return fmt.Errorf("%w: transaction reference ID (%s)", gorm.ErrDuplicatedKey, transaction.ReferenceID)
+	}
+	transaction.Model = s.newModel()
+	stored := *transaction
+	stored.User = database.User{}
+	s.transactions = append(s.transactions, stored)
+	return nil
+}
+
+func (l memoryLedger) updateTransactionStatus(
+	transaction *database.Transaction,
+	to configs.TransactionStatus,
+	failureReason string,
+	attempted bool,
+) (bool, error) {
+	s := l.state
+	i := find(s.transactions, func(stored *database.Transaction) bool { return stored.ID == transaction.ID })
+	if i < 0 || s.transactions[i].Status != transaction.Status {
+		return false, nil
+	}
+	stored := &s.transactions[i]
+	stored.Status = to
+	stored.FailureReason = failureReason
+	if attempted {
+		stored.Attempts++
+	}
+	stored.UpdatedAt = database.Now()
+	return true, nil
+}
+
+func (l memoryLedger) createTransition(transition *database.TransactionTransition) error {
+	transition.Model = l.state.newModel()
+	l.state.transitions = append(l.state.transitions, *transition)
+	return nil
+}
+
+func (l memoryLedger) getUserPortfolio(userID uint, portfolioID uint) (*database.UserPortfolio, error) {
+	i := find(l.state.userPortfolios, func(userPortfolio *database.UserPortfolio) bool {
+		return userPortfolio.UserID == userID && userPortfolio.PortfolioID == portfolioID
+	})
+	if i < 0 {
+		return nil, fmt.Errorf("failed to get user portfolio (user: %d, portfolio: %d): %w",
+			userID, portfolioID, gorm.ErrRecordNotFound)
+	}
+	userPortfolio := l.state.userPortfolios[i]
+	return &userPortfolio, nil
+}
+
+func (l memoryLedger) updateFund(userPortfolio *database.UserPortfolio, amount money.Money) error {
+	i := find(l.state.userPortfolios, func(stored *database.UserPortfolio) bool {
+		return stored.ID == userPortfolio.ID && stored.Version == userPortfolio.Version
+	})
+	if i < 0 {
+		return fmt.Errorf("user portfolio %d changed since read: %w", userPortfolio.ID, database.ErrConflict)
+	}
+	stored := &l.state.userPortfolios[i]
+	stored.Fund += amount
+	stored.Version++
+	userPortfolio.Fund, userPortfolio.Version = stored.Fund, stored.Version
+	return nil
+}
+
+func (l memoryLedger) sumDeposits(planID uint, since time.Time) (money.Money, error) {
+	sum := money.Zero
+	for _, deposit := range l.state.deposits {
+		if deposit.PlanID == planID && !deposit.CreatedAt.Before(since) {
+			sum += deposit.Amount
+		}
+	}
+	return sum, nil
+}
+
+func (l memoryLedger) createDeposit(deposit *database.Deposit) error {
+	s := l.state
+	err := checkReference(s.plans, deposit.PlanID, func(plan *database.UserDepositPlan) uint { return plan.ID }, "deposit plan")
+	if err != nil {
+		return err
+	}
+	deposit.Model = s.newModel()
+	s.deposits = append(s.deposits, *deposit)
+	return nil
+}
+
+func (l memoryLedger) createDecisions(decisions []database.AllocationDecision) error {
+	for _, decision := range decisions {
+		decision.Model = l.state.newModel()
+		l.state.decisions = append(l.state.decisions, decision)
+	}
+	return nil
+}
+
+func (l memoryLedger) getUserCash(userID uint) (*database.UserCash, error) {
+	s := l.state
+	i := find(s.userCash, func(userCash *database.UserCash) bool { return userCash.UserID == userID })
+	if i < 0 {
+		s.userCash = append(s.userCash, database.UserCash{Model: s.newModel(), UserID: userID})
+		i = len(s.userCash) - 1
+	}
+	userCash := s.userCash[i]
+	return &userCash, nil
+}
+
+func (l memoryLedger) creditCash(userCash *database.UserCash, transaction *database.Transaction, amount money.Money) error {
+	s := l.state
+	i := find(s.userCash, func(stored *database.UserCash) bool {
+		return stored.ID == userCash.ID && stored.Version == userCash.Version
+	})
+	if i < 0 {
+		return fmt.Errorf("user cash %d changed since read: %w", userCash.ID, database.ErrConflict)
+	}
+	s.cashEntries = append(s.cashEntries, database.CashEntry{
+		Model:         s.newModel(),
+		TransactionID: transaction.ID,
+		UserCashID:    userCash.ID,
+		Amount:        amount,
+	})
+	stored := &s.userCash[i]
+	stored.Balance += amount
+	stored.Version++
+	userCash.Balance, userCash.Version = stored.Balance, stored.Version
+	return nil
+}
+
+func (l memoryLedger) getPortfolioAssets(portfolioID uint) ([]database.PortfolioAsset, error) {
+	var portfolioAssets []database.PortfolioAsset
+	for _, portfolioAsset := range l.state.portfolioAssets {
+		if portfolioAsset.PortfolioID == portfolioID {
+			portfolioAsset.Asset = l.state.getAssetByID(portfolioAsset.AssetID)
+			portfolioAssets = append(portfolioAssets, portfolioAsset)
+		}
+	}
+	return portfolioAssets, nil
+}
+
+func (l memoryLedger) getHoldings(userPortfolioID uint) ([]database.Holding, error) {
+	var holdings []database.Holding
+	for _, holding := range l.state.holdings {
+		if holding.UserPortfolioID == userPortfolioID {
+			holdings = append(holdings, holding)
+		}
+	}
+	return holdings, nil
+}
+
+func (l memoryLedger) getHoldingEntries(holdingID uint) ([]database.HoldingEntry, error) {
+	var entries []database.HoldingEntry
+	for _, entry := range l.state.holdingEntries {
+		if entry.HoldingID == holdingID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (l memoryLedger) updateHolding(
+	userPortfolioID uint,
+	assetID uint,
+	transaction *database.Transaction,
+	amount money.Money,
+	units float64,
+) error {
+	s := l.state
+	i := find(s.holdings, func(holding *database.Holding) bool {
+		return holding.UserPortfolioID == userPortfolioID && holding.AssetID == assetID
+	})
+	if i < 0 {
+		s.holdings = append(s.holdings, database.Holding{Model: s.newModel(), UserPortfolioID: userPortfolioID, AssetID: assetID})
+		i = len(s.holdings) - 1
+	}
+	holding := &s.holdings[i]
+	holding.Amount += amount
+	holding.Units += units
+	s.holdingEntries = append(s.holdingEntries, database.HoldingEntry{
+		Model:         s.newModel(),
+		HoldingID:     holding.ID,
+		TransactionID: &transaction.ID,
+		Amount:        amount,
+		Units:         units,
+	})
+	return nil
+}
+
+func (l memoryLedger) priceOn(assetID uint, day time.Time) (money.Money, error) {
+	price, latest := money.Zero, time.Time{}
+	for _, assetPrice := range l.state.assetPrices {
+		if assetPrice.AssetID == assetID && !assetPrice.Date.After(prices.Day(day)) && assetPrice.Date.After(latest) {
+			price, latest = assetPrice.Price, assetPrice.Date
+		}
+	}
+	return price, nil
+}
@@ -0,0 +1,119 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+
+	"gorm.io/gorm"
+)
+
+var ErrPlanExists = errors.New("deposit plan already exists")
+
+// PRIVATE: Get portfolio record by reference ID
+func getPortfolio(tx *gorm.DB, referenceID string) (*database.Portfolio, error) {
+	var portfolio database.Portfolio
+	err := tx.Where(&database.Portfolio{ReferenceID: referenceID}).First(&portfolio).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get portfolio for reference ID (%s): %w", referenceID, err)
+	}
+	return &portfolio, nil
+}
+
+// PUBLIC: Create a deposit plan for user's portfolio, opening the user portfolio if needed
+func (s *Store) CreateUserDepositPlan(
+	ctx *context.Context,
+	userReferenceID string,
+	portfolioReferenceID string,
+	planType configs.PlanType,
+	amount money.Money,
+) (*database.UserDepositPlan, error) {
+	user, err := s.GetUser(ctx, userReferenceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user for reference ID (%s): %w", userReferenceID, err)
+	}
+
+	var plan database.UserDepositPlan
+	err = s.withTransaction(ctx, func(tx *gorm.DB) error {
+		portfolio, err := getPortfolio(tx, portfolioReferenceID)
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		err = tx.Model(&database.UserDepositPlan{}).Where(&database.UserDepositPlan{
+			UserID:      user.ID,
+			PortfolioID: portfolio.ID,
+			Type:        planType,
+		}).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: %s plan for portfolio %s", ErrPlanExists, planType, portfolioReferenceID)
+		}
+
+		// Plans allocate into user portfolios, so make sure one exists
+		var userPortfolio database.UserPortfolio
+		err = tx.Where(&database.UserPortfolio{UserID: user.ID, PortfolioID: portfolio.ID}).FirstOrCreate(&userPortfolio).Error
+		if err != nil {
+			return fmt.Errorf("failed to open user portfolio for reference ID (%s): %w", portfolioReferenceID, err)
+		}
+
+		plan = database.UserDepositPlan{
+			User:      *user,
+			Type:      planType,
+			Portfolio: *portfolio,
+			Amount:    amount,
+		}
+		return tx.Create(&plan).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// PUBLIC: Update the planned amount of user's deposit plan
+// Returns the updated plan and its previous amount
+func (s *Store) UpdateUserDepositPlanAmount(
+	ctx *context.Context,
+	userReferenceID string,
+	portfolioReferenceID string,
+	planType configs.PlanType,
+	amount money.Money,
+) (*database.UserDepositPlan, money.Money, error) {
+	user, err := s.GetUser(ctx, userReferenceID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get user for reference ID (%s): %w", userReferenceID, err)
+	}
+
+	var plan database.UserDepositPlan
+	var previous money.Money
+	err = s.withTransaction(ctx, func(tx *gorm.DB) error {
+		portfolio, err := getPortfolio(tx, portfolioReferenceID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Preload("User").Preload("Portfolio").Where(&database.UserDepositPlan{
+			UserID:      user.ID,
+			PortfolioID: portfolio.ID,
+			Type:        planType,
+		}).First(&plan).Error
+		if err != nil {
+			return fmt.Errorf("failed to get %s plan for portfolio %s: %w", planType, portfolioReferenceID, err)
+		}
+
+		previous = plan.Amount
+		plan.Amount = amount
+		return tx.Model(&plan).Update("amount_cents", amount).Error
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return &plan, previous, nil
+}
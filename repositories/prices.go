@@ -0,0 +1,379 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+	"portfolio-investment/prices"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	priceBatchSize    = 500 // Prices per insert statement
+	maxReportedQuotes = 20  // Invalid quotes told apart in an error
+)
+
+var ErrInvalidQuotes = errors.New("invalid quotes")
+
+// Sum of holding entries per holding
+type holdingTotal struct {
+	HoldingID uint
+	Amount    money.Money
+	Units     float64
+}
+
+// PRIVATE: Get asset's latest price on or before the day, or zero if it has none yet
+func priceOn(tx *gorm.DB, assetID uint, day time.Time) (money.Money, error) {
+	var assetPrices []database.AssetPrice
+	err := tx.Where("asset_id = ? AND date <= ?", assetID, prices.Day(day)).Order("date DESC").Limit(1).Find(&assetPrices).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to get price of asset %d on %s: %w", assetID, day.Format(prices.DateLayout), err)
+	}
+	if len(assetPrices) == 0 {
+		return 0, nil
+	}
+	return assetPrices[0].Price, nil
+}
+
+// PUBLIC: Save quotes as asset prices, replacing any price of the same asset and day, so saving again changes nothing
+// Assets are matched by name or ticker, and a quote's currency, if any, must be the asset's. If any quote is invalid,
+// nothing is saved and every invalid quote is reported (up to maxReportedQuotes). Of several quotes for the same asset
+// and day, the last is saved. Prices are written in batches of priceBatchSize, in a single DB transaction.
+// Returns the number of prices saved
+func (s *Store) SaveAssetPrices(ctx *context.Context, quotes []prices.Quote) (int, error) {
+	if len(quotes) == 0 {
+		return 0, nil
+	}
+
+	var assetPrices []database.AssetPrice
+	err := s.withTransaction(ctx, func(tx *gorm.DB) error {
+		var assets []database.Asset
+		if err := tx.Find(&assets).Error; err != nil {
+			return fmt.Errorf("failed to get assets: %w", err)
+		}
+		resolved, err := resolveQuotes(assets, quotes)
+		if err != nil {
+			return err
+		}
+		assetPrices = resolved
+
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "asset_id"}, {Name: "date"}},
+			DoUpdates: clause.AssignmentColumns([]string{"price_cents", "updated_at"}),
+		}).CreateInBatches(&assetPrices, priceBatchSize).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to save %d asset prices: %w", len(quotes), err)
+	}
+	return len(assetPrices), nil
+}
+
+// PRIVATE: Resolve quotes to prices of the assets they name, one per asset and day
+// Of several quotes for the same asset and day, the last is kept
+func resolveQuotes(assets []database.Asset, quotes []prices.Quote) ([]database.AssetPrice, error) {
+	quoted, err := resolveAssets(assets, quotes)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		assetID uint
+		day     time.Time
+	}
+	indexes := make(map[key]int, len(quotes))
+	assetPrices := make([]database.AssetPrice, 0, len(quotes))
+	for i, quote := range quotes {
+		assetPrice := database.AssetPrice{AssetID: quoted[i].ID, Date: prices.Day(quote.Date), Price: quote.Price}
+		k := key{assetPrice.AssetID, assetPrice.Date}
+		if index, exists := indexes[k]; exists {
+			assetPrices[index] = assetPrice
+			continue
+		}
+		indexes[k] = len(assetPrices)
+		assetPrices = append(assetPrices, assetPrice)
+	}
+	return assetPrices, nil
+}
+
+// PRIVATE: Resolve each quote to the asset it names, by name or ticker, in the same order
+// A quote's currency, if any, must be the asset's. If any quote is invalid, every invalid quote is reported
+// (up to maxReportedQuotes).
+func resolveAssets(assets []database.Asset, quotes []prices.Quote) ([]*database.Asset, error) {
+	byName := make(map[string]*database.Asset, len(assets))
+	byTicker := make(map[string][]*database.Asset, len(assets))
+	for i := range assets {
+		byName[assets[i].Name] = &assets[i]
+		if assets[i].Ticker != "" {
+			byTicker[assets[i].Ticker] = append(byTicker[assets[i].Ticker], &assets[i])
+		}
+	}
+
+	quoted := make([]*database.Asset, len(quotes))
+	var problems []string
+	for i, quote := range quotes {
+		asset, exists := byName[quote.Asset]
+		if !exists && len(byTicker[quote.Asset]) == 1 {
+			asset, exists = byTicker[quote.Asset][0], true
+		}
+		switch {
+		case !exists && len(byTicker[quote.Asset]) > 1:
+			problems = append(problems, fmt.Sprintf("quote %d: ticker %q names several assets", i, quote.Asset))
+			continue
+		case !exists:
+			problems = append(problems, fmt.Sprintf("quote %d: unknown asset %q", i, quote.Asset))
+			continue
+		case quote.Currency != "" && quote.Currency != asset.Currency:
+			problems = append(problems, fmt.Sprintf("quote %d: %s is priced in %s, not %s",
+				i, quote.Asset, asset.Currency, quote.Currency))
+			continue
+		}
+		quoted[i] = asset
+	}
+	if len(problems) > 0 {
+		reported := problems[:min(len(problems), maxReportedQuotes)]
+		return nil, fmt.Errorf("%w: %d of %d quotes: %s", ErrInvalidQuotes, len(problems), len(quotes), strings.Join(reported, "; "))
+	}
+	return quoted, nil
+}
+
+// PUBLIC: Check quotes for gaps, outliers and duplicates, per asset as SaveAssetPrices would save them
+// Quotes are resolved to assets first, so quotes naming an asset by name and by ticker make up one series, reported
+// under the asset's name; each series continues from the asset's last stored price before its quotes.
+// Invalid quotes are refused as by SaveAssetPrices.
+func (s *Store) CheckAssetPrices(ctx *context.Context, quotes []prices.Quote) ([]prices.Issue, error) {
+	if len(quotes) == 0 {
+		return nil, nil
+	}
+
+	var issues []prices.Issue
+	err := s.withTransaction(ctx, func(tx *gorm.DB) error {
+		var assets []database.Asset
+		if err := tx.Find(&assets).Error; err != nil {
+			return fmt.Errorf("failed to get assets: %w", err)
+		}
+		quoted, err := resolveAssets(assets, quotes)
+		if err != nil {
+			return err
+		}
+
+		// Name each series by its asset, from its earliest quote
+		named := make([]prices.Quote, len(quotes))
+		first := make(map[*database.Asset]time.Time)
+		for i, quote := range quotes {
+			quote.Asset, quote.Date = quoted[i].Name, prices.Day(quote.Date)
+			named[i] = quote
+			if earliest, exists := first[quoted[i]]; !exists || quote.Date.Before(earliest) {
+				first[quoted[i]] = quote.Date
+			}
+		}
+
+		var previous []prices.Quote
+		for asset, earliest := range first {
+			var assetPrices []database.AssetPrice
+			err := tx.Where("asset_id = ? AND date < ?", asset.ID, prices.Day(earliest)).
+				Order("date DESC").Limit(1).Find(&assetPrices).Error
+			if err != nil {
+				return fmt.Errorf("failed to get last price of asset %d: %w", asset.ID, err)
+			}
+			if len(assetPrices) > 0 {
+				last := assetPrices[0]
+				previous = append(previous, prices.Quote{Asset: asset.Name, Date: prices.Day(last.Date), Price: last.Price})
+			}
+		}
+		issues = prices.Check(named, previous)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %d asset prices: %w", len(quotes), err)
+	}
+	return issues, nil
+}
+
+// PUBLIC: Get market value of user's portfolios at the close of a day => { PortfolioReferenceID : Value }
+// Each holding is valued at its units times the asset's latest price on or before the day; holdings without units
+// or price, and funds not held in any asset, are valued at cost. Deposits, withdrawals and holding entries made after
+// the day are taken back out of current funds and holdings.
+func (s *Store) GetPortfolioMarketValues(
+	ctx *context.Context,
+	userReferenceID string,
+	day time.Time,
+) (map[string]money.Money, error) {
+	userPortfolios, err := s.GetUserPortfolios(ctx, userReferenceID)
+	if err != nil {
+		return nil, err
+	}
+	end := prices.Day(day).AddDate(0, 0, 1)
+
+	values := make(map[string]money.Money, len(userPortfolios))
+	err = s.withTransaction(ctx, func(tx *gorm.DB) error {
+		for _, userPortfolio := range userPortfolios {
+			value, err := portfolioMarketValue(tx, &userPortfolio, day, end)
+			if err != nil {
+				return err
+			}
+			values[userPortfolio.Portfolio.ReferenceID] = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to value portfolios of user %s on %s: %w",
+			userReferenceID, day.Format(prices.DateLayout), err)
+	}
+	return values, nil
+}
+
+// PUBLIC: Get market value of one of user's portfolios at the close of a day, valued as by GetPortfolioMarketValues
+func (s *Store) GetPortfolioMarketValue(
+	ctx *context.Context,
+	userReferenceID string,
+	portfolioReferenceID string,
+	day time.Time,
+) (money.Money, error) {
+	userPortfolios, err := s.GetUserPortfolios(ctx, userReferenceID)
+	if err != nil {
+		return 0, err
+	}
+	i := slices.IndexFunc(userPortfolios, func(userPortfolio database.UserPortfolio) bool {
+		return userPortfolio.Portfolio.ReferenceID == portfolioReferenceID
+	})
+	if i < 0 {
+		return 0, fmt.Errorf("user %s has no portfolio %s: %w", userReferenceID, portfolioReferenceID, gorm.ErrRecordNotFound)
+	}
+
+	var value money.Money
+	err = s.withTransaction(ctx, func(tx *gorm.DB) error {
+		value, err = portfolioMarketValue(tx, &userPortfolios[i], day, prices.Day(day).AddDate(0, 0, 1))
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to value portfolio %s of user %s on %s: %w",
+			portfolioReferenceID, userReferenceID, day.Format(prices.DateLayout), err)
+	}
+	return value, nil
+}
+
+// PRIVATE: Get market value of a user portfolio at the close of a day, from its fund and holdings as of before end
+func portfolioMarketValue(tx *gorm.DB, userPortfolio *database.UserPortfolio, day time.Time, end time.Time) (money.Money, error) {
+	// Fund as of the day: current fund, less deposits since, plus withdrawals since
+	var deposited, withdrawn money.Money
+	err := tx.Model(&database.Deposit{}).
+		Select("COALESCE(SUM(deposits.amount_cents), 0)").
+		Joins("JOIN user_deposit_plans ON user_deposit_plans.id = deposits.plan_id").
+		Where("user_deposit_plans.user_id = ? AND user_deposit_plans.portfolio_id = ? AND deposits.created_at >= ?",
+			userPortfolio.UserID, userPortfolio.PortfolioID, end).
+		Scan(&deposited).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum deposits since %s: %w", end, err)
+	}
+	err = tx.Model(&database.Withdrawal{}).
+		Select("COALESCE(SUM(amount_cents), 0)").
+		Where("user_portfolio_id = ? AND created_at >= ?", userPortfolio.ID, end).
+		Scan(&withdrawn).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum withdrawals since %s: %w", end, err)
+	}
+	unheld := userPortfolio.Fund - deposited + withdrawn
+
+	// Holdings as of the day: current holdings, less entries since
+	var holdings []database.Holding
+	if err := tx.Where(&database.Holding{UserPortfolioID: userPortfolio.ID}).Find(&holdings).Error; err != nil {
+		return 0, fmt.Errorf("failed to get holdings of user portfolio %d: %w", userPortfolio.ID, err)
+	}
+	var since []holdingTotal
+	err = tx.Model(&database.HoldingEntry{}).
+		Select("holding_entries.holding_id, SUM(holding_entries.amount_cents) AS amount, SUM(holding_entries.units) AS units").
+		Joins("JOIN holdings ON holdings.id = holding_entries.holding_id").
+		Where("holdings.user_portfolio_id = ? AND holding_entries.created_at >= ?", userPortfolio.ID, end).
+		Group("holding_entries.holding_id").
+		Scan(&since).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum holding entries since %s: %w", end, err)
+	}
+	changes := make(map[uint]holdingTotal, len(since))
+	for _, total := range since {
+		changes[total.HoldingID] = total
+	}
+
+	value := money.Zero
+	for _, holding := range holdings {
+		amount := holding.Amount - changes[holding.ID].Amount
+		units := holding.Units - changes[holding.ID].Units
+		unheld -= amount
+
+		entries, err := dbLedger{tx}.getHoldingEntries(holding.ID)
+		if err != nil {
+			return 0, err
+		}
+		entries = slices.DeleteFunc(entries, func(entry database.HoldingEntry) bool { return !entry.CreatedAt.Before(end) })
+		holdingValue, err := valueHolding(dbLedger{tx}, holding.AssetID, amount, units, unpricedCost(entries), day)
+		if err != nil {
+			return 0, err
+		}
+		value += holdingValue
+	}
+	return value + unheld, nil
+}
+
+// PRIVATE: Value a holding's units at the asset's latest price on or before the day, plus the cost it holds without
+// units; without units or price, all of it at cost
+func valueHolding(
+	l ledger,
+	assetID uint,
+	amount money.Money,
+	units float64,
+	unpriced money.Money,
+	day time.Time,
+) (money.Money, error) {
+	price, err := l.priceOn(assetID, day)
+	if err != nil {
+		return 0, err
+	}
+	if units > 0 && price > 0 {
+		return money.FromFloat(units*price.Float64()) + money.Min(unpriced, amount), nil
+	}
+	return amount, nil
+}
+
+// PRIVATE: Cost a holding holds without units, from its entries (oldest first)
+// Credits without units (balances from before holdings were tracked, or bought before the asset had a price) are held
+// at cost; debits sell from that cost in proportion, as they do from units
+func unpricedCost(entries []database.HoldingEntry) money.Money {
+	cost, unpriced := money.Zero, money.Zero
+	for _, entry := range entries {
+		if entry.Amount > 0 && entry.Units == 0 {
+			unpriced += entry.Amount
+		} else if entry.Amount < 0 && cost > 0 {
+			unpriced -= money.FromFloat(unpriced.Float64() * float64(-entry.Amount) / float64(cost))
+		}
+		cost += entry.Amount
+	}
+	return max(unpriced, 0)
+}
+
+// PRIVATE: Get current holdings of a user portfolio valued on a day => { AssetID : Value }
+func holdingValues(l ledger, userPortfolioID uint, day time.Time) (map[uint]money.Money, error) {
+	holdings, err := l.getHoldings(userPortfolioID)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[uint]money.Money, len(holdings))
+	for _, holding := range holdings {
+		entries, err := l.getHoldingEntries(holding.ID)
+		if err != nil {
+			return nil, err
+		}
+		value, err := valueHolding(l, holding.AssetID, holding.Amount, holding.Units, unpricedCost(entries), day)
+		if err != nil {
+			return nil, err
+		}
+		values[holding.AssetID] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,273 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/database/dbtest"
+	"portfolio-investment/money"
+	"portfolio-investment/prices"
+	"portfolio-investment/strategies"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMarketValue(t *testing.T) {
+	const userReferenceID = "user-market-value"
+	highRisk := configs.DefaultPortfolioHighRisk
+	ctx := context.Background()
+	db, config := dbtest.New(t)
+	store := NewStore(db, config, nil)
+
+	// Last test prices: Bitcoin 120.00, Ethereum 12.50
+	quotes, err := prices.ReadFile("../prices/testdata/prices.csv")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if _, err := store.SaveAssetPrices(&ctx, quotes); err != nil {
+		t.Fatalf("SaveAssetPrices failed: %v", err)
+	}
+
+	// 100.00 split 70/30 buys Bitcoin and Ethereum at their last prices
+	if _, err := store.CreateUser(&ctx, userReferenceID); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	plan, err := store.CreateUserDepositPlan(&ctx, userReferenceID, highRisk, configs.PlanTypeMonthly, money.FromFloat(1000.0))
+	if err != nil {
+		t.Fatalf("CreateUserDepositPlan failed: %v", err)
+	}
+	deposits, err := store.CreateDepositTransactions(&ctx, userReferenceID, NewTransactionRequests([]money.Money{money.FromFloat(100.0)}))
+	if err != nil {
+		t.Fatalf("CreateDepositTransactions failed: %v", err)
+	}
+	if _, err := store.DepositFunds(&ctx, deposits, []database.UserDepositPlan{*plan}, strategies.Waterfall{}); err != nil {
+		t.Fatalf("DepositFunds failed: %v", err)
+	}
+
+	// Bitcoin doubles and Ethereum halves tomorrow; saving twice replaces the prices
+	today := prices.Day(time.Now())
+	tomorrow := today.AddDate(0, 0, 1)
+	for range 2 {
+		_, err = store.SaveAssetPrices(&ctx, []prices.Quote{
+			{Asset: "Bitcoin", Date: tomorrow, Price: money.FromFloat(240.0)},
+			{Asset: "Ethereum", Date: tomorrow, Price: money.FromFloat(6.25)},
+		})
+		if err != nil {
+			t.Fatalf("SaveAssetPrices failed: %v", err)
+		}
+	}
+
+	var tests = []struct {
+		name     string
+		day      time.Time
+		expected money.Money
+	}{
+		{"Test value before deposits", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), 0},
+		{"Test value at purchase prices", today, money.FromFloat(100.0)},
+		{"Test value at later prices", tomorrow, money.FromFloat(155.0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := store.GetPortfolioMarketValues(&ctx, userReferenceID, tt.day)
+			if err != nil {
+				t.Fatalf("❌ GetPortfolioMarketValues failed: %v", err)
+			}
+			if values[highRisk] != tt.expected {
+				t.Errorf("❌ Expected %s on %s, got %s", tt.expected, tt.day.Format(prices.DateLayout), values[highRisk])
+			} else {
+				t.Logf("✅ Worth %s on %s", values[highRisk], tt.day.Format(prices.DateLayout))
+			}
+		})
+	}
+
+	var count int64
+	db.Model(&database.AssetPrice{}).Where("date = ?", tomorrow).Count(&count)
+	if count != 2 {
+		t.Errorf("❌ Expected 2 prices tomorrow, got %d", count)
+	}
+	_, err = store.SaveAssetPrices(&ctx, []prices.Quote{{Asset: "Dogecoin", Date: today, Price: money.FromFloat(1.0)}})
+	if !errors.Is(err, ErrInvalidQuotes) {
+		t.Errorf("❌ Expected unknown asset to be refused, got %v", err)
+	}
+}
+
+func TestMarketValueHeldAtCost(t *testing.T) {
+	const userReferenceID = "user-market-value-at-cost"
+	highRisk := configs.DefaultPortfolioHighRisk
+	ctx := context.Background()
+	db, config := dbtest.New(t)
+	store := NewStore(db, config, nil)
+
+	if _, err := store.CreateUser(&ctx, userReferenceID); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	plan, err := store.CreateUserDepositPlan(&ctx, userReferenceID, highRisk, configs.PlanTypeMonthly, money.FromFloat(1000.0))
+	if err != nil {
+		t.Fatalf("CreateUserDepositPlan failed: %v", err)
+	}
+	deposit := func(amount float64) {
+		deposits, err := store.CreateDepositTransactions(&ctx, userReferenceID, NewTransactionRequests([]money.Money{money.FromFloat(amount)}))
+		if err != nil {
+			t.Fatalf("CreateDepositTransactions failed: %v", err)
+		}
+		if _, err := store.DepositFunds(&ctx, deposits, []database.UserDepositPlan{*plan}, strategies.Waterfall{}); err != nil {
+			t.Fatalf("DepositFunds failed: %v", err)
+		}
+	}
+
+	// 50.00 deposited before any price is held at cost, like balances from before holdings were tracked
+	deposit(50.0)
+
+	// Then 100.00 split 70/30 buys Bitcoin at 120.00 and Ethereum at 12.50, and Bitcoin doubles and Ethereum halves
+	quotes, err := prices.ReadFile("../prices/testdata/prices.csv")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if _, err := store.SaveAssetPrices(&ctx, quotes); err != nil {
+		t.Fatalf("SaveAssetPrices failed: %v", err)
+	}
+	deposit(100.0)
+	today := prices.Day(time.Now())
+	tomorrow := today.AddDate(0, 0, 1)
+	_, err = store.SaveAssetPrices(&ctx, []prices.Quote{
+		{Asset: "Bitcoin", Date: tomorrow, Price: money.FromFloat(240.0)},
+		{Asset: "Ethereum", Date: tomorrow, Price: money.FromFloat(6.25)},
+	})
+	if err != nil {
+		t.Fatalf("SaveAssetPrices failed: %v", err)
+	}
+
+	// Units at market plus the cost held without units
+	var tests = []struct {
+		name     string
+		day      time.Time
+		expected money.Money
+	}{
+		{"Test value at purchase prices", today, money.FromFloat(150.0)},
+		{"Test value at later prices", tomorrow, money.FromFloat(140.0 + 35.0 + 15.0 + 15.0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := store.GetPortfolioMarketValues(&ctx, userReferenceID, tt.day)
+			if err != nil {
+				t.Fatalf("❌ GetPortfolioMarketValues failed: %v", err)
+			}
+			if values[highRisk] != tt.expected {
+				t.Errorf("❌ Expected %s on %s, got %s", tt.expected, tt.day.Format(prices.DateLayout), values[highRisk])
+			} else {
+				t.Logf("✅ Worth %s on %s", values[highRisk], tt.day.Format(prices.DateLayout))
+			}
+		})
+	}
+}
+
+func TestSaveAssetPrices(t *testing.T) {
+	ctx := context.Background()
+	db, config := dbtest.New(t)
+	store := NewStore(db, config, nil)
+
+	// Three years of weekday closes, more than a batch
+	var multiYear []prices.Quote
+	for day := time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC); day.Year() < 2025; day = day.AddDate(0, 0, 1) {
+		if day.Weekday() != time.Saturday && day.Weekday() != time.Sunday {
+			multiYear = append(multiYear, prices.Quote{Asset: "AAPL", Date: day, Price: money.FromFloat(150.0), Currency: "USD"})
+		}
+	}
+	fromJSON, err := prices.ReadFile("../prices/testdata/prices.json")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	var tests = []struct {
+		name   string
+		quotes []prices.Quote
+		saved  int
+		err    error
+	}{
+		{"Test multi-year file in batches", multiYear, len(multiYear), nil},
+		{"Test import again is idempotent", multiYear, len(multiYear), nil},
+		{"Test tickers, names and currencies", fromJSON, 4, nil},
+		{"Test same day twice saves the last", []prices.Quote{
+			{Asset: "ETH", Date: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), Price: money.FromFloat(10.0)},
+			{Asset: "Ethereum", Date: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), Price: money.FromFloat(11.0)},
+		}, 1, nil},
+		{"Test unknown asset", []prices.Quote{{Asset: "DOGE", Date: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), Price: 1}}, 0, ErrInvalidQuotes},
+		{"Test other currency", []prices.Quote{{Asset: "BTC", Date: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), Price: 1, Currency: "EUR"}}, 0, ErrInvalidQuotes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved, err := store.SaveAssetPrices(&ctx, tt.quotes)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("❌ Expected error %v, got %v", tt.err, err)
+			}
+			if saved != tt.saved {
+				t.Errorf("❌ Expected %d prices saved, got %d", tt.saved, saved)
+			} else {
+				t.Logf("✅ Saved %d prices", saved)
+			}
+		})
+	}
+
+	var count int64
+	db.Model(&database.AssetPrice{}).Count(&count)
+	if expected := int64(len(multiYear) + 4 + 1); count != expected {
+		t.Errorf("❌ Expected %d prices stored, got %d", expected, count)
+	}
+	var ethereum database.AssetPrice
+	db.Joins("Asset").Where("Asset.name = ?", "Ethereum").First(&ethereum)
+	if ethereum.Price != money.FromFloat(11.0) {
+		t.Errorf("❌ Expected last Ethereum close 11.00, got %s", ethereum.Price)
+	}
+}
+
+func TestCheckAssetPrices(t *testing.T) {
+	ctx := context.Background()
+	db, config := dbtest.New(t)
+	store := NewStore(db, config, nil)
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC) } // 2025-01-03 is a Friday
+
+	// Bitcoin was last imported on Thursday
+	if _, err := store.SaveAssetPrices(&ctx, []prices.Quote{{Asset: "BTC", Date: day(2), Price: money.FromFloat(100.0)}}); err != nil {
+		t.Fatalf("SaveAssetPrices failed: %v", err)
+	}
+
+	var tests = []struct {
+		name     string
+		quotes   []prices.Quote
+		expected []prices.Issue
+		err      error
+	}{
+		{"Test continued from last stored price", []prices.Quote{
+			{Asset: "BTC", Date: day(6), Price: money.FromFloat(40.0)},
+		}, []prices.Issue{
+			{Kind: prices.IssueGap, Asset: "Bitcoin", Date: day(3), Detail: "no close"},
+			{Kind: prices.IssueOutlier, Asset: "Bitcoin", Date: day(6), Detail: "-60.0% from 100.00 to 40.00"},
+		}, nil},
+		{"Test name and ticker make one series", []prices.Quote{
+			{Asset: "Bitcoin", Date: day(3), Price: money.FromFloat(100.0)},
+			{Asset: "BTC", Date: day(6), Price: money.FromFloat(101.0)},
+			{Asset: "Bitcoin", Date: day(6), Price: money.FromFloat(102.0)},
+		}, []prices.Issue{
+			{Kind: prices.IssueDuplicate, Asset: "Bitcoin", Date: day(6), Detail: "closes 101.00 and 102.00"},
+		}, nil},
+		{"Test asset without stored prices", []prices.Quote{
+			{Asset: "ETH", Date: day(6), Price: money.FromFloat(10.0)},
+		}, nil, nil},
+		{"Test unknown asset", []prices.Quote{{Asset: "DOGE", Date: day(6), Price: 1}}, nil, ErrInvalidQuotes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, err := store.CheckAssetPrices(&ctx, tt.quotes)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("❌ Expected error %v, got %v", tt.err, err)
+			}
+			if !reflect.DeepEqual(issues, tt.expected) {
+				t.Errorf("❌ Expected issues %+v, got %+v", tt.expected, issues)
+			} else {
+				t.Logf("✅ Found %d issues", len(issues))
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"portfolio-investment/money"
+	"portfolio-investment/prices"
+	"portfolio-investment/rebalance"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Trades proposed to bring a user portfolio's holdings back to its assets' target weights
+type RebalanceProposal struct {
+	PortfolioReferenceID string
+	Value                money.Money       // Market value of the holdings
+	Drift                map[uint]int      // => { AssetID : Drift from target weight, in basis points }
+	Orders               []rebalance.Order // None while every asset is within the tolerance band
+}
+
+// PUBLIC: Propose trades restoring target weights of user's portfolios, valuing holdings at today's prices
+// Tolerance is the drift from target weight, in basis points, within which a portfolio is left as it is; negative to
+// use the configured tolerance. Portfolios without a composition are skipped. Nothing is traded.
+func (s *Store) ProposeRebalance(ctx *context.Context, userReferenceID string, tolerance int) ([]RebalanceProposal, error) {
+	if tolerance < 0 {
+		tolerance = s.config.RebalanceTolerance
+	}
+	userPortfolios, err := s.GetUserPortfolios(ctx, userReferenceID)
+	if err != nil {
+		return nil, err
+	}
+	today := prices.Day(time.Now())
+
+	var proposals []RebalanceProposal
+	err = s.withTransaction(ctx, func(tx *gorm.DB) error {
+		proposals = proposals[:0]
+		for _, userPortfolio := range userPortfolios {
+			portfolioAssets, err := getPortfolioAssets(tx, userPortfolio.PortfolioID)
+			if err != nil {
+				return err
+			}
+			if len(portfolioAssets) == 0 {
+				continue
+			}
+			values, err := holdingValues(dbLedger{tx}, userPortfolio.ID, today)
+			if err != nil {
+				return err
+			}
+
+			targets := portfolioTargets(portfolioAssets)
+			value := money.Zero
+			for _, holdingValue := range values {
+				value += holdingValue
+			}
+			proposals = append(proposals, RebalanceProposal{
+				PortfolioReferenceID: userPortfolio.Portfolio.ReferenceID,
+				Value:                value,
+				Drift:                rebalance.Drift(targets, values),
+				Orders:               rebalance.Orders(targets, values, tolerance),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to rebalance portfolios of user %s: %w", userReferenceID, err)
+	}
+	return proposals, nil
+}
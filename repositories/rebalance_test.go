@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"context"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/database/dbtest"
+	"portfolio-investment/money"
+	"portfolio-investment/prices"
+	"portfolio-investment/rebalance"
+	"portfolio-investment/strategies"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProposeRebalance(t *testing.T) {
+	const userReferenceID = "user-rebalance"
+	highRisk := configs.DefaultPortfolioHighRisk
+	ctx := context.Background()
+	db, config := dbtest.New(t)
+	config.RebalanceOnDeposit = true
+	store := NewStore(db, config, nil)
+
+	var bitcoin, ethereum database.Asset
+	if err := db.Where(&database.Asset{Name: "Bitcoin"}).First(&bitcoin).Error; err != nil {
+		t.Fatalf("Failed to get Bitcoin: %v", err)
+	}
+	if err := db.Where(&database.Asset{Name: "Ethereum"}).First(&ethereum).Error; err != nil {
+		t.Fatalf("Failed to get Ethereum: %v", err)
+	}
+	today := prices.Day(time.Now())
+	savePrices := func(bitcoinPrice float64) {
+		t.Helper()
+		_, err := store.SaveAssetPrices(&ctx, []prices.Quote{
+			{Asset: "Bitcoin", Date: today, Price: money.FromFloat(bitcoinPrice)},
+			{Asset: "Ethereum", Date: today, Price: money.FromFloat(12.5)},
+		})
+		if err != nil {
+			t.Fatalf("SaveAssetPrices failed: %v", err)
+		}
+	}
+	deposit := func(amount float64) {
+		t.Helper()
+		deposits, err := store.CreateDepositTransactions(&ctx, userReferenceID, NewTransactionRequests([]money.Money{money.FromFloat(amount)}))
+		if err != nil {
+			t.Fatalf("CreateDepositTransactions failed: %v", err)
+		}
+		plans, err := store.GetUserDepositPlans(&ctx, userReferenceID)
+		if err != nil {
+			t.Fatalf("GetUserDepositPlans failed: %v", err)
+		}
+		if _, err := store.DepositFunds(&ctx, deposits, plans, strategies.Waterfall{}); err != nil {
+			t.Fatalf("DepositFunds failed: %v", err)
+		}
+	}
+
+	// Seeded high risk portfolio: Bitcoin 70%, Ethereum 30%; with nothing held yet, the first deposit splits by weight
+	if _, err := store.CreateUser(&ctx, userReferenceID); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if _, err := store.CreateUserDepositPlan(&ctx, userReferenceID, highRisk, configs.PlanTypeMonthly, money.FromFloat(1000.0)); err != nil {
+		t.Fatalf("CreateUserDepositPlan failed: %v", err)
+	}
+	savePrices(120.0)
+	deposit(100.0)
+
+	// Bitcoin doubles: 140.00 in Bitcoin and 30.00 in Ethereum, against targets of 119.00 and 51.00
+	savePrices(240.0)
+	drifted := []rebalance.Order{
+		{AssetID: bitcoin.ID, Side: rebalance.SideSell, Amount: money.FromFloat(21.0)},
+		{AssetID: ethereum.ID, Side: rebalance.SideBuy, Amount: money.FromFloat(21.0)},
+	}
+
+	var tests = []struct {
+		name      string
+		tolerance int
+		expected  []rebalance.Order
+	}{
+		{"Test drift beyond tolerance", 500, drifted},
+		{"Test drift within tolerance", 2000, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proposals, err := store.ProposeRebalance(&ctx, userReferenceID, tt.tolerance)
+			if err != nil {
+				t.Fatalf("❌ ProposeRebalance failed: %v", err)
+			}
+			if len(proposals) != 1 || proposals[0].Value != money.FromFloat(170.0) {
+				t.Fatalf("❌ Expected one portfolio worth 170.00, got %+v", proposals)
+			}
+			if !reflect.DeepEqual(proposals[0].Orders, tt.expected) {
+				t.Errorf("❌ Expected %v, got %v", tt.expected, proposals[0].Orders)
+			} else {
+				t.Logf("✅ Orders %v at drift %v", proposals[0].Orders, proposals[0].Drift)
+			}
+		})
+	}
+
+	// Directed deposit tops up the underweight Ethereum only, without selling Bitcoin
+	deposit(10.0)
+	holdings := holdingsByAsset(t, store, &ctx, userReferenceID)
+	if holdings["Bitcoin"] != money.FromFloat(70.0) || holdings["Ethereum"] != money.FromFloat(40.0) {
+		t.Errorf("❌ Expected 70.00 Bitcoin and 40.00 Ethereum at cost, got %v", holdings)
+	} else {
+		t.Logf("✅ Deposit directed to Ethereum: %v", holdings)
+	}
+}
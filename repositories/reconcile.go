@@ -0,0 +1,285 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/logging"
+	"portfolio-investment/money"
+
+	"gorm.io/gorm"
+)
+
+// What a discrepancy is about
+type DiscrepancyKind string
+
+const (
+	DiscrepancyPortfolioFund     DiscrepancyKind = "portfolio-fund"     // User portfolio fund differs from its deposits less its withdrawals
+	DiscrepancyCashBalance       DiscrepancyKind = "cash-balance"       // User cash balance differs from its cash entries
+	DiscrepancyTransactionAmount DiscrepancyKind = "transaction-amount" // Processed transaction's records don't sum to its amount
+)
+
+// A recorded amount that differs from the amount recomputed from history
+type Discrepancy struct {
+	Kind                   DiscrepancyKind
+	UserReferenceID        string
+	PortfolioReferenceID   string // Portfolio fund discrepancies only
+	TransactionReferenceID string // Transaction amount discrepancies only
+	Recorded               money.Money
+	Expected               money.Money
+	Repaired               bool // Recorded amount was set to the expected one
+}
+
+// PUBLIC: Amount the recorded amount is off by
+func (d Discrepancy) Difference() money.Money {
+	return d.Recorded - d.Expected
+}
+
+// Outcome of a reconciliation run
+type ReconciliationReport struct {
+	UserPortfolios int // User portfolios checked
+	UserCash       int // User cash records checked
+	Transactions   int // Processed transactions checked
+	Discrepancies  []Discrepancy
+}
+
+// Sum of amounts per record ID
+type recordTotal struct {
+	ID    uint
+	Total money.Money
+}
+
+// Sum of deposits per user and portfolio
+type portfolioTotal struct {
+	UserID      uint
+	PortfolioID uint
+	Total       money.Money
+}
+
+// PRIVATE: Sum amount column of table per key column, for rows matching the optional condition
+func sumBy(tx *gorm.DB, model any, key string, condition string) (map[uint]money.Money, error) {
+	var totals []recordTotal
+	query := tx.Model(model).Select(key + " AS id, SUM(amount_cents) AS total").Group(key)
+	if condition != "" {
+		query = query.Where(condition)
+	}
+	if err := query.Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	sums := make(map[uint]money.Money, len(totals))
+	for _, total := range totals {
+		sums[total.ID] = total.Total
+	}
+	return sums, nil
+}
+
+// PUBLIC: Recompute user portfolio funds and cash balances from deposit, withdrawal and cash entry history,
+// and check each processed transaction's records sum to its amount, for one user (or all, if empty)
+// With repair, funds and balances that differ are set to the recomputed amounts; transaction amounts are only reported
+func (s *Store) Reconcile(ctx *context.Context, userReferenceID string, repair bool) (*ReconciliationReport, error) {
+	var userID uint
+	if userReferenceID != "" {
+		user, err := s.GetUser(ctx, userReferenceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user for reference ID (%s): %w", userReferenceID, err)
+		}
+		userID = user.ID
+	}
+
+	var report *ReconciliationReport
+	err := s.withRetry(ctx, func(tx *gorm.DB) error {
+		report = &ReconciliationReport{}
+		if err := reconcileFunds(tx, userID, repair, report); err != nil {
+			return err
+		}
+		if err := reconcileCash(tx, userID, repair, report); err != nil {
+			return err
+		}
+		return reconcileTransactions(tx, userID, report)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile: %w", err)
+	}
+
+	// Logged and recorded once committed, not on every retry
+	found := make(map[DiscrepancyKind]int)
+	repaired := make(map[DiscrepancyKind]int)
+	for _, discrepancy := range report.Discrepancies {
+		logDiscrepancy(*ctx, discrepancy)
+		found[discrepancy.Kind]++
+		if discrepancy.Repaired {
+			repaired[discrepancy.Kind]++
+		}
+	}
+	for _, kind := range []DiscrepancyKind{DiscrepancyPortfolioFund, DiscrepancyCashBalance, DiscrepancyTransactionAmount} {
+		s.metrics.Reconciled(string(kind), found[kind], repaired[kind], userReferenceID == "")
+	}
+	return report, nil
+}
+
+// PRIVATE: Check user portfolio funds against deposits less withdrawals
+func reconcileFunds(tx *gorm.DB, userID uint, repair bool, report *ReconciliationReport) error {
+	var userPortfolios []database.UserPortfolio
+	query := tx.Preload("User").Preload("Portfolio").Order("id")
+	if userID != 0 {
+		query = query.Where(&database.UserPortfolio{UserID: userID})
+	}
+	if err := query.Find(&userPortfolios).Error; err != nil {
+		return fmt.Errorf("failed to get user portfolios: %w", err)
+	}
+
+	// Deposits are made to plans, so they are summed per plan's user and portfolio
+	var deposits []portfolioTotal
+	err := tx.Model(&database.Deposit{}).
+		Select("user_deposit_plans.user_id, user_deposit_plans.portfolio_id, SUM(deposits.amount_cents) AS total").
+		Joins("JOIN user_deposit_plans ON user_deposit_plans.id = deposits.plan_id").
+		Group("user_deposit_plans.user_id, user_deposit_plans.portfolio_id").
+		Scan(&deposits).Error
+	if err != nil {
+		return fmt.Errorf("failed to sum deposits: %w", err)
+	}
+	deposited := make(map[[2]uint]money.Money, len(deposits))
+	for _, deposit := range deposits {
+		deposited[[2]uint{deposit.UserID, deposit.PortfolioID}] = deposit.Total
+	}
+	withdrawn, err := sumBy(tx, &database.Withdrawal{}, "user_portfolio_id", "")
+	if err != nil {
+		return fmt.Errorf("failed to sum withdrawals: %w", err)
+	}
+
+	for i := range userPortfolios {
+		userPortfolio := &userPortfolios[i]
+		report.UserPortfolios++
+
+		expected := deposited[[2]uint{userPortfolio.UserID, userPortfolio.PortfolioID}] - withdrawn[userPortfolio.ID]
+		if userPortfolio.Fund == expected {
+			continue
+		}
+		discrepancy := Discrepancy{
+			Kind:                 DiscrepancyPortfolioFund,
+			UserReferenceID:      userPortfolio.User.ReferenceID,
+			PortfolioReferenceID: userPortfolio.Portfolio.ReferenceID,
+			Recorded:             userPortfolio.Fund,
+			Expected:             expected,
+		}
+		if repair {
+			if err := updateFund(tx, userPortfolio, expected-userPortfolio.Fund); err != nil {
+				return err
+			}
+			discrepancy.Repaired = true
+		}
+		report.Discrepancies = append(report.Discrepancies, discrepancy)
+	}
+	return nil
+}
+
+// PRIVATE: Check user cash balances against cash entries
+func reconcileCash(tx *gorm.DB, userID uint, repair bool, report *ReconciliationReport) error {
+	var userCashes []database.UserCash
+	query := tx.Preload("User").Order("id")
+	if userID != 0 {
+		query = query.Where(&database.UserCash{UserID: userID})
+	}
+	if err := query.Find(&userCashes).Error; err != nil {
+		return fmt.Errorf("failed to get user cash: %w", err)
+	}
+	entries, err := sumBy(tx, &database.CashEntry{}, "user_cash_id", "")
+	if err != nil {
+		return fmt.Errorf("failed to sum cash entries: %w", err)
+	}
+
+	for _, userCash := range userCashes {
+		report.UserCash++
+
+		expected := entries[userCash.ID]
+		if userCash.Balance == expected {
+			continue
+		}
+		discrepancy := Discrepancy{
+			Kind:            DiscrepancyCashBalance,
+			UserReferenceID: userCash.User.ReferenceID,
+			Recorded:        userCash.Balance,
+			Expected:        expected,
+		}
+		if repair {
+			// Compare-and-swap like any balance update, without recording an entry: entries are the history repaired to
+			result := tx.Model(&database.UserCash{}).
+				Where("id = ? AND version = ?", userCash.ID, userCash.Version).
+				Updates(map[string]any{"balance_cents": expected, "version": gorm.Expr("version + 1")})
+			if result.Error != nil {
+				return fmt.Errorf("failed to repair user cash: %w", result.Error)
+			}
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("user cash %d changed since read: %w", userCash.ID, database.ErrConflict)
+			}
+			discrepancy.Repaired = true
+		}
+		report.Discrepancies = append(report.Discrepancies, discrepancy)
+	}
+	return nil
+}
+
+// PRIVATE: Check each processed transaction's records sum to its amount
+// A deposit (or cash sweep) is split between deposits to plans and a cash credit for any remainder;
+// a withdrawal is split between withdrawals from portfolios
+func reconcileTransactions(tx *gorm.DB, userID uint, report *ReconciliationReport) error {
+	var transactions []database.Transaction
+	query := tx.Preload("User").Order("id").Where("status IN ?", []configs.TransactionStatus{
+		configs.TrxnStatusCompleted, configs.TrxnStatusPartiallyAllocated,
+	})
+	if userID != 0 {
+		query = query.Where(&database.Transaction{UserID: userID})
+	}
+	if err := query.Find(&transactions).Error; err != nil {
+		return fmt.Errorf("failed to get processed transactions: %w", err)
+	}
+
+	deposited, err := sumBy(tx, &database.Deposit{}, "transaction_id", "")
+	if err != nil {
+		return fmt.Errorf("failed to sum deposits: %w", err)
+	}
+	// A sweep also debits the cash it moves; only credits are remainders
+	credited, err := sumBy(tx, &database.CashEntry{}, "transaction_id", "amount_cents > 0")
+	if err != nil {
+		return fmt.Errorf("failed to sum cash entries: %w", err)
+	}
+	withdrawn, err := sumBy(tx, &database.Withdrawal{}, "transaction_id", "")
+	if err != nil {
+		return fmt.Errorf("failed to sum withdrawals: %w", err)
+	}
+
+	for _, transaction := range transactions {
+		report.Transactions++
+
+		var recorded money.Money
+		switch transaction.Type {
+		case configs.TrxnTypeDeposit, configs.TrxnTypeCashSweep:
+			recorded = deposited[transaction.ID] + credited[transaction.ID]
+		case configs.TrxnTypeWithdrawal:
+			recorded = withdrawn[transaction.ID]
+		default:
+			continue
+		}
+		if recorded == transaction.Amount {
+			continue
+		}
+		discrepancy := Discrepancy{
+			Kind:                   DiscrepancyTransactionAmount,
+			UserReferenceID:        transaction.User.ReferenceID,
+			TransactionReferenceID: transaction.ReferenceID,
+			Recorded:               recorded,
+			Expected:               transaction.Amount,
+		}
+		report.Discrepancies = append(report.Discrepancies, discrepancy)
+	}
+	return nil
+}
+
+// PRIVATE: Log a discrepancy found, and whether it was repaired
+func logDiscrepancy(ctx context.Context, discrepancy Discrepancy) {
+	ctx = logging.WithTransactionID(logging.WithUserID(ctx, discrepancy.UserReferenceID), discrepancy.TransactionReferenceID)
+	slog.WarnContext(ctx, "Reconciliation discrepancy", "kind", discrepancy.Kind, "portfolio", discrepancy.PortfolioReferenceID,
+		"recorded", discrepancy.Recorded, "expected", discrepancy.Expected, "repaired", discrepancy.Repaired)
+}
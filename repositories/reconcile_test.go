@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"context"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/database/dbtest"
+	"portfolio-investment/money"
+	"portfolio-investment/strategies"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	const userReferenceID = "user-reconcile"
+	highRisk := configs.DefaultPortfolioHighRisk
+
+	// User with 100.00 deposited to a plan and 50.00 credited to cash, then 30.00 withdrawn
+	setup := func(t *testing.T, ctx *context.Context) (*Store, database.Transaction) {
+		db, config := dbtest.New(t)
+		store := NewStore(db, config, nil)
+		if _, err := store.CreateUser(ctx, userReferenceID); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+		plan, err := store.CreateUserDepositPlan(ctx, userReferenceID, highRisk, configs.PlanTypeMonthly, money.FromFloat(100.0))
+		if err != nil {
+			t.Fatalf("CreateUserDepositPlan failed: %v", err)
+		}
+		deposits, err := store.CreateDepositTransactions(ctx, userReferenceID, NewTransactionRequests([]money.Money{money.FromFloat(150.0)}))
+		if err != nil {
+			t.Fatalf("CreateDepositTransactions failed: %v", err)
+		}
+		if _, err := store.DepositFunds(ctx, deposits, []database.UserDepositPlan{*plan}, strategies.Waterfall{}); err != nil {
+			t.Fatalf("DepositFunds failed: %v", err)
+		}
+		withdrawals, err := store.CreateWithdrawalTransactions(ctx, userReferenceID, []money.Money{money.FromFloat(30.0)})
+		if err != nil {
+			t.Fatalf("CreateWithdrawalTransactions failed: %v", err)
+		}
+		if _, err := store.WithdrawFunds(ctx, withdrawals, highRisk); err != nil {
+			t.Fatalf("WithdrawFunds failed: %v", err)
+		}
+		return store, deposits[0]
+	}
+
+	var tests = []struct {
+		name     string
+		tamper   func(t *testing.T, store *Store, deposit database.Transaction)
+		expected []Discrepancy // Found without repairing
+		left     int           // Discrepancies left after repairing
+	}{
+		{"Test consistent history", func(t *testing.T, store *Store, deposit database.Transaction) {}, nil, 0},
+		{"Test fund and cash drift repaired", func(t *testing.T, store *Store, deposit database.Transaction) {
+			store.DB().Model(&database.UserPortfolio{}).Where("fund_cents > 0").Update("fund_cents", money.FromFloat(80.0))
+			store.DB().Model(&database.UserCash{}).Where("balance_cents > 0").Update("balance_cents", money.FromFloat(40.0))
+		}, []Discrepancy{
+			{Kind: DiscrepancyPortfolioFund, UserReferenceID: userReferenceID, PortfolioReferenceID: highRisk,
+				Recorded: money.FromFloat(80.0), Expected: money.FromFloat(70.0)},
+			{Kind: DiscrepancyCashBalance, UserReferenceID: userReferenceID,
+				Recorded: money.FromFloat(40.0), Expected: money.FromFloat(50.0)},
+		}, 0},
+		{"Test transaction amount only reported", func(t *testing.T, store *Store, deposit database.Transaction) {
+			store.DB().Model(&database.Transaction{}).Where("id = ?", deposit.ID).Update("amount_cents", money.FromFloat(160.0))
+		}, []Discrepancy{
+			{Kind: DiscrepancyTransactionAmount, UserReferenceID: userReferenceID, // Transaction reference ID set once created
+				Recorded: money.FromFloat(150.0), Expected: money.FromFloat(160.0)},
+		}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store, deposit := setup(t, &ctx)
+			tt.tamper(t, store, deposit)
+			for i := range tt.expected {
+				if tt.expected[i].Kind == DiscrepancyTransactionAmount {
+					tt.expected[i].TransactionReferenceID = deposit.ReferenceID
+				}
+			}
+
+			report, err := store.Reconcile(&ctx, "", false)
+			if err != nil {
+				t.Fatalf("Reconcile failed: %v", err)
+			}
+			if report.UserPortfolios == 0 || report.UserCash != 1 || report.Transactions != 2 {
+				t.Errorf("❌ Expected user portfolios, 1 user cash and 2 transactions checked, got %+v", report)
+			}
+			if len(report.Discrepancies) != len(tt.expected) {
+				t.Fatalf("❌ Expected discrepancies %+v, got %+v", tt.expected, report.Discrepancies)
+			}
+			for i, discrepancy := range report.Discrepancies {
+				if discrepancy != tt.expected[i] {
+					t.Errorf("❌ Expected discrepancy %+v, got %+v", tt.expected[i], discrepancy)
+				}
+			}
+
+			// Repairing leaves only what can't be repaired
+			if _, err := store.Reconcile(&ctx, userReferenceID, true); err != nil {
+				t.Fatalf("Reconcile with repair failed: %v", err)
+			}
+			report, err = store.Reconcile(&ctx, userReferenceID, false)
+			if err != nil {
+				t.Fatalf("Reconcile failed: %v", err)
+			}
+			if len(report.Discrepancies) != tt.left {
+				t.Errorf("❌ Expected %d discrepancies left after repair, got %+v", tt.left, report.Discrepancies)
+			} else {
+				t.Logf("✅ Found %d discrepancies, %d left after repair", len(tt.expected), tt.left)
+			}
+		})
+	}
+}
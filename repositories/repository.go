@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"context"
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+	"portfolio-investment/strategies"
+)
+
+// Users with their portfolios and deposit plans
+type UserRepository interface {
+	GetUser(ctx *context.Context, referenceID string) (*database.User, error)
+	GetUserPortfolios(ctx *context.Context, referenceID string) ([]database.UserPortfolio, error)
+	GetUserDepositPlans(ctx *context.Context, referenceID string) ([]database.UserDepositPlan, error)
+}
+
+// Deposit transactions and what they were allocated
+type DepositRepository interface {
+	CreateDepositTransactions(
+		ctx *context.Context,
+		userReferenceID string,
+		requests []TransactionRequest,
+	) ([]database.Transaction, error)
+	DepositFunds(
+		ctx *context.Context,
+		transactions []database.Transaction,
+		plans []database.UserDepositPlan,
+		strategy strategies.AllocationStrategy,
+	) (map[string]money.Money, error)
+	PreviewDeposit(
+		ctx *context.Context,
+		plans []database.UserDepositPlan,
+		strategy strategies.AllocationStrategy,
+		amount money.Money,
+	) ([]strategies.Allocation, error)
+	GetTransaction(ctx *context.Context, referenceID string) (*database.Transaction, error)
+	GetTransactionAllocations(ctx *context.Context, referenceID string) (map[string]money.Money, money.Money, error)
+	GetAllocationDecisions(ctx *context.Context, referenceID string) ([]database.AllocationDecision, error)
+}
+
+// Everything deposits are processed with
+// Implemented on a database by Store, and in memory by MemoryRepository; both pass the same conformance tests
+type Repository interface {
+	UserRepository
+	DepositRepository
+}
+
+var (
+	_ Repository = (*Store)(nil)
+	_ Repository = (*MemoryRepository)(nil)
+)
@@ -0,0 +1,503 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/database/dbtest"
+	"portfolio-investment/metrics"
+	"portfolio-investment/money"
+	"portfolio-investment/prices"
+	"portfolio-investment/strategies"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Repository under conformance test, with the fixtures the suite sets up through
+type conformanceRepository interface {
+	Repository
+	CreateUser(ctx *context.Context, referenceID string) (*database.User, error)
+	CreateUserDepositPlan(
+		ctx *context.Context,
+		userReferenceID string,
+		portfolioReferenceID string,
+		planType configs.PlanType,
+		amount money.Money,
+	) (*database.UserDepositPlan, error)
+	SaveAssetPrices(ctx *context.Context, quotes []prices.Quote) (int, error)
+	GetUserHoldings(ctx *context.Context, referenceID string) ([]database.Holding, error)
+	Metrics() *metrics.Metrics
+}
+
+func TestStoreConformance(t *testing.T) {
+	testConformance(t, func(t *testing.T, rebalanceOnDeposit bool) conformanceRepository {
+		db, config := dbtest.New(t)
+		config.RebalanceOnDeposit = rebalanceOnDeposit
+		return NewStore(db, config, metrics.New())
+	})
+}
+
+func TestMemoryConformance(t *testing.T) {
+	testConformance(t, func(t *testing.T, rebalanceOnDeposit bool) conformanceRepository {
+		ctx := context.Background()
+		config := configs.LoadAppConfigs()
+		config.RebalanceOnDeposit = rebalanceOnDeposit
+		memory := NewMemoryRepository(config, metrics.New())
+
+		// Default portfolios with their seeded compositions
+		compositions := []struct {
+			portfolio string
+			assets    []database.Asset
+			weights   []int
+		}{
+			{configs.DefaultPortfolioRetirement, []database.Asset{{Name: "Apple Inc.", Ticker: "AAPL"}, {Name: "Tesla Inc.", Ticker: "TSLA"}}, []int{6000, 4000}},
+			{configs.DefaultPortfolioHighRisk, []database.Asset{{Name: "Bitcoin", Ticker: "BTC"}, {Name: "Ethereum", Ticker: "ETH"}}, []int{7000, 3000}},
+		}
+		for _, composition := range compositions {
+			if _, err := memory.CreatePortfolio(&ctx, composition.portfolio, composition.portfolio); err != nil {
+				t.Fatalf("CreatePortfolio failed: %v", err)
+			}
+			var weights []AssetWeight
+			for i, asset := range composition.assets {
+				created, err := memory.CreateAsset(&ctx, asset.Name, "", asset.Ticker)
+				if err != nil {
+					t.Fatalf("CreateAsset failed: %v", err)
+				}
+				weights = append(weights, AssetWeight{AssetID: created.ID, Weight: composition.weights[i]})
+			}
+			if _, err := memory.SetPortfolioAssets(&ctx, composition.portfolio, weights); err != nil {
+				t.Fatalf("SetPortfolioAssets failed: %v", err)
+			}
+		}
+		return memory
+	})
+}
+
+// Fails every allocation after the first, like an error half way through a batch
+type failingAfterFirstStrategy struct {
+	strategies.Waterfall
+	calls *int
+}
+
+func (s failingAfterFirstStrategy) Allocate(
+	plans []database.UserDepositPlan,
+	balances strategies.Balances,
+	amount money.Money,
+) ([]strategies.Allocation, error) {
+	*s.calls++
+	if *s.calls > 1 {
+		return nil, errors.New("allocation failed")
+	}
+	return s.Waterfall.Allocate(plans, balances, amount)
+}
+
+// PRIVATE: Run the conformance suite, each case on a fresh repository with the default portfolios and no users
+func testConformance(t *testing.T, newRepository func(t *testing.T, rebalanceOnDeposit bool) conformanceRepository) {
+	const userReferenceID = "user-conformance"
+	retirement, highRisk := configs.DefaultPortfolioRetirement, configs.DefaultPortfolioHighRisk
+
+	// User with a one-time plan of 500.00 and a monthly plan of 100.00
+	setup := func(t *testing.T, ctx *context.Context, rebalanceOnDeposit bool) conformanceRepository {
+		repository := newRepository(t, rebalanceOnDeposit)
+		if _, err := repository.CreateUser(ctx, userReferenceID); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+		plans := []struct {
+			portfolio string
+			planType  configs.PlanType
+			amount    money.Money
+		}{
+			{retirement, configs.PlanTypeOnceTime, money.FromFloat(500.0)},
+			{highRisk, configs.PlanTypeMonthly, money.FromFloat(100.0)},
+		}
+		for _, plan := range plans {
+			if _, err := repository.CreateUserDepositPlan(ctx, userReferenceID, plan.portfolio, plan.planType, plan.amount); err != nil {
+				t.Fatalf("CreateUserDepositPlan failed: %v", err)
+			}
+		}
+		return repository
+	}
+	deposit := func(t *testing.T, ctx *context.Context, repository conformanceRepository, amounts ...money.Money) []database.Transaction {
+		transactions, err := repository.CreateDepositTransactions(ctx, userReferenceID, NewTransactionRequests(amounts))
+		if err != nil {
+			t.Fatalf("CreateDepositTransactions failed: %v", err)
+		}
+		return transactions
+	}
+	funds := func(t *testing.T, ctx *context.Context, repository conformanceRepository) map[string]money.Money {
+		userPortfolios, err := repository.GetUserPortfolios(ctx, userReferenceID)
+		if err != nil {
+			t.Fatalf("GetUserPortfolios failed: %v", err)
+		}
+		funds := make(map[string]money.Money)
+		for _, userPortfolio := range userPortfolios {
+			funds[userPortfolio.Portfolio.ReferenceID] = userPortfolio.Fund
+		}
+		return funds
+	}
+	// Holding cost and units per asset name
+	type position struct {
+		amount money.Money
+		units  float64
+	}
+	holdings := func(t *testing.T, ctx *context.Context, repository conformanceRepository) map[string]position {
+		userHoldings, err := repository.GetUserHoldings(ctx, userReferenceID)
+		if err != nil {
+			t.Fatalf("GetUserHoldings failed: %v", err)
+		}
+		positions := make(map[string]position)
+		for _, holding := range userHoldings {
+			positions[holding.Asset.Name] = position{holding.Amount, holding.Units}
+		}
+		return positions
+	}
+	price := func(t *testing.T, ctx *context.Context, repository conformanceRepository, quotes ...prices.Quote) {
+		if _, err := repository.SaveAssetPrices(ctx, quotes); err != nil {
+			t.Fatalf("SaveAssetPrices failed: %v", err)
+		}
+	}
+	today := prices.Day(time.Now())
+
+	var tests = []struct {
+		name               string
+		rebalanceOnDeposit bool
+		run                func(t *testing.T, ctx *context.Context, repository conformanceRepository)
+	}{
+		{"Test unknown user", false, func(t *testing.T, ctx *context.Context, repository conformanceRepository) {
+			if _, err := repository.GetUser(ctx, "unknown"); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("❌ Expected user not to be found, got %v", err)
+			}
+			if _, err := repository.GetUserDepositPlans(ctx, "unknown"); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("❌ Expected plans of unknown user not to be found, got %v", err)
+			}
+			_, err := repository.CreateDepositTransactions(ctx, "unknown", NewTransactionRequests([]money.Money{100}))
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("❌ Expected deposit for unknown user to be refused, got %v", err)
+			}
+		}},
+		{"Test unique user reference ID", false, func(t *testing.T, ctx *context.Context, repository conformanceRepository) {
+			if _, err := repository.CreateUser(ctx, userReferenceID); err == nil {
+				t.Errorf("❌ Expected duplicate user reference ID to be refused")
+			}
+		}},
+		{"Test plans open user portfolios", false, func(t *testing.T, ctx *context.Context, repository conformanceRepository) {
+			plans, err := repository.GetUserDepositPlans(ctx, userReferenceID)
+			if err != nil || len(plans) != 2 || plans[0].Portfolio.ReferenceID != retirement || plans[0].User.ReferenceID != userReferenceID {
+				t.Errorf("❌ Expected 2 plans with their portfolio and user, got %+v (%v)", plans, err)
+			}
+			expected := map[string]money.Money{retirement: 0, highRisk: 0}
+			if result := funds(t, ctx, repository); !reflect.DeepEqual(result, expected) {
+				t.Errorf("❌ Expected empty user portfolios %v, got %v", expected, result)
+			}
+		}},
+		{"Test plan references", false, func(t *testing.T, ctx *context.Context, repository conformanceRepository) {
+			_, err := repository.CreateUserDepositPlan(ctx, userReferenceID, "unknown", configs.PlanTypeMonthly, 100)
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("❌ Expected plan for unknown portfolio to be refused, got %v", err)
+			}
+			_, err = repository.CreateUserDepositPlan(ctx, "unknown", retirement, configs.PlanTypeMonthly, 100)
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("❌ Expected plan for unknown user to be refused, got %v", err)
+			}
+			_, err = repository.CreateUserDepositPlan(ctx, userReferenceID, retirement, configs.PlanTypeOnceTime, 100)
+			if !errors.Is(err, ErrPlanExists) {
+				t.Errorf("❌ Expected duplicate plan to be refused, got %v", err)
+			}
+		}},
+		{"Test transaction reference IDs", false, func(t *testing.T, ctx *context.Context, repository conformanceRepository) {
+			request := TransactionRequest{ReferenceID: "payment-1", Amount: 100}
+			requests := append(NewTransactionRequests([]money.Money{100, 100}), request)
+			transactions, err := repository.CreateDepositTransactions(ctx, userReferenceID, requests)
+			if err != nil {
+				t.Fatalf("CreateDepositTransactions failed: %v", err)
+			}
+			seen := make(map[string]bool)
+			for _, transaction := range transactions {
+				if seen[transaction.ReferenceID] || transaction.Status != configs.TrxnStatusPending || transaction.Replayed {
+					t.Errorf("❌ Expected new pending transaction with a unique reference ID, got %+v", transaction)
+				}
+				seen[transaction.ReferenceID] = true
+			}
+
+			replays, err := repository.CreateDepositTransactions(ctx, userReferenceID, []TransactionRequest{request})
+			if err != nil || !replays[0].Replayed || replays[0].ID != transactions[2].ID {
+				t.Errorf("❌ Expected replay of transaction %d, got %+v (%v)", transactions[2].ID, replays, err)
+			}
+			request.Amount++
+			_, err = repository.CreateDepositTransactions(ctx, userReferenceID, []TransactionRequest{request})
+			if !errors.Is(err, ErrIdempotencyConflict) {
+				t.Errorf("❌ Expected idempotency conflict, got %v", err)
+			}
+		}},
+		{"Test deposit allocations", false, func(t *testing.T, ctx *context.Context, repository conformanceRepository) {
+			plans, err := repository.GetUserDepositPlans(ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserDepositPlans failed: %v", err)
+			}
+			transactions := deposit(t, ctx, repository, money.FromFloat(550.0), money.FromFloat(100.0))
+			results, err := repository.DepositFunds(ctx, transactions, plans, strategies.Waterfall{})
+			if err != nil {
+				t.Fatalf("DepositFunds failed: %v", err)
+			}
+			expected := map[string]money.Money{retirement: money.FromFloat(500.0), highRisk: money.FromFloat(100.0)}
+			if !reflect.DeepEqual(results, expected) || !reflect.DeepEqual(funds(t, ctx, repository), expected) {
+				t.Errorf("❌ Expected funds %v, got %v", expected, results)
+			}
+
+			// The monthly plan is met half way through the second deposit; the rest is kept as cash
+			outcomes := []struct {
+				status      configs.TransactionStatus
+				allocations map[string]money.Money
+				cash        money.Money
+			}{
+				{configs.TrxnStatusCompleted, map[string]money.Money{retirement: money.FromFloat(500.0), highRisk: money.FromFloat(50.0)}, 0},
+				{configs.TrxnStatusPartiallyAllocated, map[string]money.Money{highRisk: money.FromFloat(50.0)}, money.FromFloat(50.0)},
+			}
+			for i, outcome := range outcomes {
+				transaction, err := repository.GetTransaction(ctx, transactions[i].ReferenceID)
+				if err != nil || transaction.Status != outcome.status || transaction.User.ReferenceID != userReferenceID {
+					t.Errorf("❌ Expected %s transaction of %s, got %+v (%v)", outcome.status, userReferenceID, transaction, err)
+				}
+				allocations, cash, err := repository.GetTransactionAllocations(ctx, transactions[i].ReferenceID)
+				if err != nil || !reflect.DeepEqual(allocations, outcome.allocations) || cash != outcome.cash {
+					t.Errorf("❌ Expected allocations %v and cash %s, got %v and %s (%v)", outcome.allocations, outcome.cash, allocations, cash, err)
+				}
+			}
+		}},
+		{"Test deposit preview persists nothing", false, func(t *testing.T, ctx *context.Context, repository conformanceRepository) {
+			plans, err := repository.GetUserDepositPlans(ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserDepositPlans failed: %v", err)
+			}
+			allocations, err := repository.PreviewDeposit(ctx, plans, strategies.Waterfall{}, money.FromFloat(550.0))
+			if err != nil {
+				t.Fatalf("PreviewDeposit failed: %v", err)
+			}
+			previewed := make(map[string]money.Money)
+			steps := make(map[strategies.Step]money.Money)
+			for _, allocation := range allocations {
+				previewed[allocation.Plan.Portfolio.ReferenceID] += allocation.Amount
+				steps[allocation.Step] += allocation.Amount
+			}
+			expectedSteps := map[strategies.Step]money.Money{strategies.StepOneTime: money.FromFloat(500.0), strategies.StepMonthly: money.FromFloat(50.0)}
+			if !reflect.DeepEqual(steps, expectedSteps) {
+				t.Errorf("❌ Expected steps %v, got %v", expectedSteps, steps)
+			}
+			expected := map[string]money.Money{retirement: 0, highRisk: 0}
+			if result := funds(t, ctx, repository); !reflect.DeepEqual(result, expected) {
+				t.Errorf("❌ Expected funds unchanged at %v, got %v", expected, result)
+			}
+
+			// Depositing the same amount allocates exactly what was previewed
+			transactions := deposit(t, ctx, repository, money.FromFloat(550.0))
+			results, err := repository.DepositFunds(ctx, transactions, plans, strategies.Waterfall{})
+			if err != nil {
+				t.Fatalf("DepositFunds failed: %v", err)
+			}
+			if !reflect.DeepEqual(results, previewed) {
+				t.Errorf("❌ Expected deposit to allocate previewed %v, got %v", previewed, results)
+			}
+		}},
+		{"Test allocation decisions recorded", false, func(t *testing.T, ctx *context.Context, repository conformanceRepository) {
+			plans, err := repository.GetUserDepositPlans(ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserDepositPlans failed: %v", err)
+			}
+			transactions := deposit(t, ctx, repository, money.FromFloat(550.0), money.FromFloat(100.0))
+			if _, err := repository.DepositFunds(ctx, transactions, plans, strategies.Waterfall{}); err != nil {
+				t.Fatalf("DepositFunds failed: %v", err)
+			}
+
+			// Step, portfolio, amount, weight out of total, fund and contributed before, and remaining before and after
+			type decision struct {
+				step                            strategies.Step
+				portfolio                       string
+				amount                          money.Money
+				weight, total                   int64
+				fund, contributed               money.Money
+				remainingBefore, remainingAfter money.Money
+			}
+			expected := [][]decision{
+				{
+					{strategies.StepOneTime, retirement, 50000, 50000, 50000, 0, 0, 55000, 5000},
+					{strategies.StepMonthly, highRisk, 5000, 10000, 10000, 0, 0, 5000, 0},
+				},
+				{
+					{strategies.StepMonthly, highRisk, 5000, 5000, 5000, 5000, 5000, 10000, 5000},
+					{strategies.StepRemainder, "", 5000, 0, 0, 0, 0, 5000, 0},
+				},
+			}
+			for i, transaction := range transactions {
+				decisions, err := repository.GetAllocationDecisions(ctx, transaction.ReferenceID)
+				if err != nil {
+					t.Fatalf("GetAllocationDecisions failed: %v", err)
+				}
+				var actual []decision
+				for j, d := range decisions {
+					portfolio := ""
+					if d.Portfolio != nil {
+						portfolio = d.Portfolio.ReferenceID
+					}
+					if d.Sequence != j+1 || d.Strategy != configs.AllocationStrategyWaterfall || (d.DepositID == nil) != (portfolio == "") {
+						t.Errorf("❌ Expected waterfall decision %d with a deposit for its plan, got %+v", j+1, d)
+					}
+					actual = append(actual, decision{strategies.Step(d.Step), portfolio, d.Amount, d.Weight, d.TotalWeight,
+						d.PortfolioFund, d.PlanContributed, d.RemainingBefore, d.RemainingAfter})
+				}
+				if !reflect.DeepEqual(actual, expected[i]) {
+					t.Errorf("❌ Expected decisions %+v, got %+v", expected[i], actual)
+				}
+			}
+		}},
+		{"Test deposits credit holdings by weight at prices", false, func(t *testing.T, ctx *context.Context, repository conformanceRepository) {
+			plans, err := repository.GetUserDepositPlans(ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserDepositPlans failed: %v", err)
+			}
+			price(t, ctx, repository, prices.Quote{Asset: "BTC", Date: today, Price: money.FromFloat(35.0)})
+			transactions := deposit(t, ctx, repository, money.FromFloat(600.0))
+			if _, err := repository.DepositFunds(ctx, transactions, plans, strategies.Waterfall{}); err != nil {
+				t.Fatalf("DepositFunds failed: %v", err)
+			}
+
+			// Assets without a price are held at cost, without units
+			expected := map[string]position{
+				"Apple Inc.": {money.FromFloat(300.0), 0},
+				"Tesla Inc.": {money.FromFloat(200.0), 0},
+				"Bitcoin":    {money.FromFloat(70.0), 2},
+				"Ethereum":   {money.FromFloat(30.0), 0},
+			}
+			if result := holdings(t, ctx, repository); !reflect.DeepEqual(result, expected) {
+				t.Errorf("❌ Expected holdings %v, got %v", expected, result)
+			}
+		}},
+		{"Test directed deposits to underweight assets", true, func(t *testing.T, ctx *context.Context, repository conformanceRepository) {
+			plans, err := repository.GetUserDepositPlans(ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserDepositPlans failed: %v", err)
+			}
+			price(t, ctx, repository,
+				prices.Quote{Asset: "Bitcoin", Date: today, Price: money.FromFloat(10.0)},
+				prices.Quote{Asset: "Ethereum", Date: today, Price: money.FromFloat(10.0)})
+			if _, err := repository.DepositFunds(ctx, deposit(t, ctx, repository, money.FromFloat(550.0)), plans, strategies.Waterfall{}); err != nil {
+				t.Fatalf("DepositFunds failed: %v", err)
+			}
+
+			// Bitcoin doubles to 70.00 of 85.00, so the next 10.00 all goes to underweight Ethereum
+			price(t, ctx, repository, prices.Quote{Asset: "Bitcoin", Date: today, Price: money.FromFloat(20.0)})
+			if _, err := repository.DepositFunds(ctx, deposit(t, ctx, repository, money.FromFloat(10.0)), plans, strategies.Waterfall{}); err != nil {
+				t.Fatalf("DepositFunds failed: %v", err)
+			}
+			expected := map[string]position{
+				"Apple Inc.": {money.FromFloat(300.0), 0},
+				"Tesla Inc.": {money.FromFloat(200.0), 0},
+				"Bitcoin":    {money.FromFloat(35.0), 3.5},
+				"Ethereum":   {money.FromFloat(25.0), 2.5},
+			}
+			if result := holdings(t, ctx, repository); !reflect.DeepEqual(result, expected) {
+				t.Errorf("❌ Expected holdings %v, got %v", expected, result)
+			}
+		}},
+		{"Test metrics recorded", false, func(t *testing.T, ctx *context.Context, repository conformanceRepository) {
+			plans, err := repository.GetUserDepositPlans(ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserDepositPlans failed: %v", err)
+			}
+			requests := []TransactionRequest{{ReferenceID: "payment-1", Amount: money.FromFloat(650.0)}}
+			if _, err := repository.CreateDepositTransactions(ctx, userReferenceID, requests); err != nil {
+				t.Fatalf("CreateDepositTransactions failed: %v", err)
+			}
+			transactions, err := repository.CreateDepositTransactions(ctx, userReferenceID, requests)
+			if err != nil {
+				t.Fatalf("CreateDepositTransactions failed: %v", err)
+			}
+			if _, err := repository.DepositFunds(ctx, transactions, plans, strategies.Waterfall{}); err != nil {
+				t.Fatalf("DepositFunds failed: %v", err)
+			}
+
+			exposed := map[string]float64{
+				`portfolio_transactions_created_total{replayed="false",type="deposit"}`:               1,
+				`portfolio_transactions_created_total{replayed="true",type="deposit"}`:                1,
+				`portfolio_transactions_processed_total{status="partially-allocated",type="deposit"}`: 1,
+				`portfolio_allocated_amount_total{portfolio="` + retirement + `"}`:                    500,
+				`portfolio_allocated_amount_total{portfolio="` + highRisk + `"}`:                      100,
+				`portfolio_allocation_duration_seconds_count{outcome="success",strategy="waterfall"}`: 1,
+			}
+			rec := httptest.NewRecorder()
+			repository.Metrics().Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			for metric, value := range exposed {
+				if line := fmt.Sprintf("%s %v\n", metric, value); !strings.Contains(rec.Body.String(), line) {
+					t.Errorf("❌ Expected %s", strings.TrimSpace(line))
+				}
+			}
+		}},
+		{"Test deposit batch rolled back", false, func(t *testing.T, ctx *context.Context, repository conformanceRepository) {
+			plans, err := repository.GetUserDepositPlans(ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserDepositPlans failed: %v", err)
+			}
+			transactions := deposit(t, ctx, repository, money.FromFloat(550.0), money.FromFloat(100.0))
+			calls := 0
+			if _, err := repository.DepositFunds(ctx, transactions, plans, failingAfterFirstStrategy{calls: &calls}); err == nil {
+				t.Fatalf("❌ Expected DepositFunds to fail")
+			}
+
+			expected := map[string]money.Money{retirement: 0, highRisk: 0}
+			if result := funds(t, ctx, repository); !reflect.DeepEqual(result, expected) {
+				t.Errorf("❌ Expected funds to be rolled back to %v, got %v", expected, result)
+			}
+			for _, transaction := range transactions {
+				stored, err := repository.GetTransaction(ctx, transaction.ReferenceID)
+				if err != nil || stored.Status != configs.TrxnStatusFailed || stored.Attempts != 1 || transaction.Status != configs.TrxnStatusFailed {
+					t.Errorf("❌ Expected transaction marked failed after 1 attempt, got %+v (%v)", stored, err)
+				}
+				allocations, cash, err := repository.GetTransactionAllocations(ctx, transaction.ReferenceID)
+				if err != nil || len(allocations) != 0 || cash != 0 {
+					t.Errorf("❌ Expected nothing allocated, got %v and cash %s (%v)", allocations, cash, err)
+				}
+				decisions, err := repository.GetAllocationDecisions(ctx, transaction.ReferenceID)
+				if err != nil || len(decisions) != 0 {
+					t.Errorf("❌ Expected no allocation decisions, got %+v (%v)", decisions, err)
+				}
+			}
+			if result := holdings(t, ctx, repository); len(result) != 0 {
+				t.Errorf("❌ Expected no holdings, got %v", result)
+			}
+		}},
+		{"Test processed transaction not deposited again", false, func(t *testing.T, ctx *context.Context, repository conformanceRepository) {
+			plans, err := repository.GetUserDepositPlans(ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserDepositPlans failed: %v", err)
+			}
+			transactions := deposit(t, ctx, repository, money.FromFloat(100.0))
+			if _, err := repository.DepositFunds(ctx, transactions, plans, strategies.Waterfall{}); err != nil {
+				t.Fatalf("DepositFunds failed: %v", err)
+			}
+			_, err = repository.DepositFunds(ctx, transactions, plans, strategies.Waterfall{})
+			if !errors.Is(err, ErrIllegalTransition) {
+				t.Errorf("❌ Expected illegal transition, got %v", err)
+			}
+			expected := map[string]money.Money{retirement: money.FromFloat(100.0), highRisk: 0}
+			if result := funds(t, ctx, repository); !reflect.DeepEqual(result, expected) {
+				t.Errorf("❌ Expected funds %v, got %v", expected, result)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			tt.run(t, &ctx, setup(t, &ctx, tt.rebalanceOnDeposit))
+		})
+	}
+	t.Log("✅ Repository conforms")
+}
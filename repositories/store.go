@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"context"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/metrics"
+
+	"gorm.io/gorm"
+)
+
+// Data access for users, portfolios, plans and transactions on a single database
+type Store struct {
+	db      *gorm.DB
+	config  *configs.AppConfig
+	metrics *metrics.Metrics
+}
+
+// PUBLIC: Build store on an open database, with retry settings from config, recording metrics (nil records none)
+func NewStore(db *gorm.DB, config *configs.AppConfig, metrics *metrics.Metrics) *Store {
+	return &Store{db: db, config: config, metrics: metrics}
+}
+
+// PUBLIC: Underlying database, e.g. for fixtures in tests
+func (s *Store) DB() *gorm.DB {
+	return s.db
+}
+
+// PUBLIC: Metrics recorded by the store, if any
+func (s *Store) Metrics() *metrics.Metrics {
+	return s.metrics
+}
+
+// PRIVATE: Database session bound to the context
+func (s *Store) withContext(ctx *context.Context) *gorm.DB {
+	return s.db.WithContext(*ctx)
+}
+
+// PRIVATE: Run handler in a DB transaction
+func (s *Store) withTransaction(ctx *context.Context, handler func(tx *gorm.DB) error) error {
+	return s.withContext(ctx).Transaction(handler)
+}
+
+// PRIVATE: Run handler in a DB transaction, retrying the whole transaction on conflict
+// Every attempt after the first is recorded as a retry
+func (s *Store) withRetry(ctx *context.Context, handler func(tx *gorm.DB) error) error {
+	attempts := 0
+	err := database.WithRetry(ctx, s.db, s.config, func(tx *gorm.DB) error {
+		attempts++
+		return handler(tx)
+	})
+	s.metrics.Retried(attempts - 1)
+	return err
+}
@@ -0,0 +1,322 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIllegalTransition   = errors.New("illegal transaction status transition")
+	ErrIdempotencyConflict = errors.New("reference ID already used for a different transaction")
+)
+
+// Requested transaction amount, with an optional client-supplied reference ID used as idempotency key
+type TransactionRequest struct {
+	ReferenceID string
+	Amount      money.Money
+}
+
+// PUBLIC: Build transaction requests with generated reference IDs
+func NewTransactionRequests(amounts []money.Money) []TransactionRequest {
+	requests := make([]TransactionRequest, 0, len(amounts))
+	for _, amount := range amounts {
+		requests = append(requests, TransactionRequest{Amount: amount})
+	}
+	return requests
+}
+
+// Allowed transaction status transitions => { From : [To] }
+var transactionTransitions = map[configs.TransactionStatus][]configs.TransactionStatus{
+	configs.TrxnStatusPending: {
+		configs.TrxnStatusProcessing,
+		configs.TrxnStatusFailed,
+	},
+	configs.TrxnStatusProcessing: {
+		configs.TrxnStatusCompleted,
+		configs.TrxnStatusPartiallyAllocated,
+		configs.TrxnStatusFailed,
+		configs.TrxnStatusPending,
+	},
+	configs.TrxnStatusFailed: {
+		configs.TrxnStatusPending,
+		configs.TrxnStatusDeadLetter,
+	},
+	configs.TrxnStatusDeadLetter: {
+		configs.TrxnStatusPending,
+	},
+	configs.TrxnStatusCompleted: {
+		configs.TrxnStatusReversed,
+	},
+	configs.TrxnStatusPartiallyAllocated: {
+		configs.TrxnStatusReversed,
+	},
+}
+
+// PRIVATE: Create a pending transaction, or return the existing one for a replayed reference ID
+// Concurrent requests racing on the same new reference ID are settled by the unique index (see createTransactions)
+func createTransaction(
+	l ledger,
+	user *database.User,
+	trxnType configs.TransactionType,
+	request TransactionRequest,
+) (*database.Transaction, error) {
+	referenceID := request.ReferenceID
+	if referenceID == "" {
+		referenceID = uuid.New().String()
+	} else {
+		existing, err := l.findTransaction(referenceID)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			if existing.UserID != user.ID || existing.Type != trxnType || existing.Amount != request.Amount {
+				return nil, fmt.Errorf("%w: %s", ErrIdempotencyConflict, referenceID)
+			}
+			existing.Replayed = true
+			return existing, nil
+		}
+	}
+
+	transaction := database.Transaction{
+		ReferenceID: referenceID,
+		UserID:      user.ID,
+		User:        *user,
+		Type:        trxnType,
+		Amount:      request.Amount,
+		Status:      configs.TrxnStatusPending,
+	}
+	if err := l.createTransaction(&transaction); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// PRIVATE: Create pending transactions of a type for user's requests, in a single unit of work
+func createTransactions(
+	work unitOfWork,
+	user *database.User,
+	trxnType configs.TransactionType,
+	requests []TransactionRequest,
+) ([]database.Transaction, error) {
+	var transactions []database.Transaction
+	create := func(l ledger) error {
+		transactions = make([]database.Transaction, 0, len(requests))
+		for _, request := range requests {
+			transaction, err := createTransaction(l, user, trxnType, request)
+			if err != nil {
+				return err
+			}
+			transactions = append(transactions, *transaction)
+		}
+		return nil
+	}
+	err := work(create)
+	// A concurrent request created the same new reference ID first, and the unique index rolled this one back:
+	// creating again reads the winner's transaction, and replays it
+	if database.IsDuplicate(err) {
+		err = work(create)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// PUBLIC: Check if a transaction may move from one status to another
+func CanTransition(from configs.TransactionStatus, to configs.TransactionStatus) bool {
+	return slices.Contains(transactionTransitions[from], to)
+}
+
+// PRIVATE: Move transaction to a new status and record the transition
+// The update only applies if the stored status still matches, so concurrent transitions can't both succeed
+func transitionTransaction(
+	l ledger,
+	transaction *database.Transaction,
+	to configs.TransactionStatus,
+	reason string,
+) error {
+	from := transaction.Status
+	if !CanTransition(from, to) {
+		return fmt.Errorf("%w: %s -> %s (transaction: %s)", ErrIllegalTransition, from, to, transaction.ReferenceID)
+	}
+
+	failureReason := ""
+	switch to {
+	case configs.TrxnStatusFailed, configs.TrxnStatusDeadLetter:
+		failureReason = reason
+	}
+	// Every failure counts as a processing attempt
+	attempted := to == configs.TrxnStatusFailed
+	updated, err := l.updateTransactionStatus(transaction, to, failureReason, attempted)
+	if err != nil {
+		return fmt.Errorf("failed to update transaction status (transaction: %s): %w", transaction.ReferenceID, err)
+	}
+	if !updated {
+		return fmt.Errorf("%w: %s -> %s (transaction: %s is no longer %s)",
+			ErrIllegalTransition, from, to, transaction.ReferenceID, from)
+	}
+
+	transition := database.TransactionTransition{
+		TransactionID: transaction.ID,
+		From:          from,
+		To:            to,
+		Reason:        reason,
+	}
+	if err := l.createTransition(&transition); err != nil {
+		return fmt.Errorf("failed to record transaction transition (transaction: %s): %w", transaction.ReferenceID, err)
+	}
+
+	transaction.Status = to
+	transaction.FailureReason = failureReason
+	if attempted {
+		transaction.Attempts++
+	}
+	return nil
+}
+
+// PRIVATE: Mark transactions as failed once their processing has been rolled back, so none are left pending
+// Returns cause, joined with the error of marking them if any
+func failTransactions(work unitOfWork, transactions []database.Transaction, cause error) error {
+	// Transition copies, so a retried attempt starts from the original statuses
+	var failed []database.Transaction
+	err := work(func(l ledger) error {
+		failed = slices.Clone(transactions)
+		for i := range failed {
+			err := transitionTransaction(l, &failed[i], configs.TrxnStatusFailed, cause.Error())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Join(cause, err)
+	}
+	copy(transactions, failed)
+	return cause
+}
+
+// PUBLIC: Get transaction record by reference ID
+func (s *Store) GetTransaction(ctx *context.Context, referenceID string) (*database.Transaction, error) {
+	var transaction database.Transaction
+	err := s.withContext(ctx).Preload("User").Where(
+		&database.Transaction{ReferenceID: referenceID},
+	).First(&transaction).Error
+	if err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// PUBLIC: Get transaction's status history, oldest first
+func (s *Store) GetTransactionTransitions(ctx *context.Context, referenceID string) ([]database.TransactionTransition, error) {
+	transaction, err := s.GetTransaction(ctx, referenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var transitions []database.TransactionTransition
+	err = s.withContext(ctx).Where(
+		&database.TransactionTransition{TransactionID: transaction.ID},
+	).Order("id").Find(&transitions).Error
+	if err != nil {
+		return nil, err
+	}
+	return transitions, nil
+}
+
+// PUBLIC: Move transaction to a new status by reference ID, refusing illegal transitions
+func (s *Store) UpdateTransactionStatus(
+	ctx *context.Context,
+	referenceID string,
+	to configs.TransactionStatus,
+	reason string,
+) (*database.Transaction, error) {
+	transaction, err := s.GetTransaction(ctx, referenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.withTransaction(ctx, func(tx *gorm.DB) error {
+		return transitionTransaction(dbLedger{tx}, transaction, to, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// PUBLIC: Claim up to `limit` deposit transactions that are due for (re)processing
+// Eligible transactions are 'pending' for longer than `pendingGrace` or 'failed' and due for retry,
+// and not leased by another worker. Each claim is a compare-and-swap on the lease, so only one worker wins.
+func (s *Store) ClaimDueDeposits(
+	ctx *context.Context,
+	owner string,
+	leaseDuration time.Duration,
+	pendingGrace time.Duration,
+	limit int,
+) ([]database.Transaction, error) {
+	db := s.withContext(ctx)
+	now := database.Now()
+
+	var candidates []database.Transaction
+	err := db.Where("type = ?", configs.TrxnTypeDeposit).
+		Where("(status = ? AND created_at <= ?) OR status = ?",
+			configs.TrxnStatusPending, now.Add(-pendingGrace), configs.TrxnStatusFailed).
+		Where("next_attempt_at IS NULL OR next_attempt_at <= ?", now).
+		Where("lease_expires_at IS NULL OR lease_expires_at <= ?", now).
+		Order("id").Limit(limit).Find(&candidates).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find due deposit transactions: %w", err)
+	}
+
+	claimed := make([]database.Transaction, 0, len(candidates))
+	leaseExpiresAt := now.Add(leaseDuration)
+	for _, candidate := range candidates {
+		result := db.Model(&database.Transaction{}).
+			Where("id = ? AND status = ?", candidate.ID, candidate.Status).
+			Where("lease_expires_at IS NULL OR lease_expires_at <= ?", now).
+			Updates(map[string]any{"lease_owner": owner, "lease_expires_at": leaseExpiresAt})
+		if result.Error != nil {
+			return claimed, fmt.Errorf("failed to claim transaction %s: %w", candidate.ReferenceID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			continue // Claimed by another worker
+		}
+
+		transaction, err := s.GetTransaction(ctx, candidate.ReferenceID)
+		if err != nil {
+			return claimed, err
+		}
+		claimed = append(claimed, *transaction)
+	}
+	return claimed, nil
+}
+
+// PUBLIC: Release worker's lease on a transaction, optionally scheduling its next attempt
+func (s *Store) ReleaseTransaction(
+	ctx *context.Context,
+	transaction *database.Transaction,
+	owner string,
+	nextAttemptAt *time.Time,
+) error {
+	err := s.withContext(ctx).Model(&database.Transaction{}).
+		Where("id = ? AND lease_owner = ?", transaction.ID, owner).
+		Updates(map[string]any{"lease_owner": "", "lease_expires_at": nil, "next_attempt_at": nextAttemptAt}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release transaction %s: %w", transaction.ReferenceID, err)
+	}
+	transaction.LeaseOwner = ""
+	transaction.LeaseExpiresAt = nil
+	transaction.NextAttemptAt = nextAttemptAt
+	return nil
+}
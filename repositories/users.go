@@ -2,13 +2,29 @@ package repositories
 
 import (
 	"context"
+	"fmt"
+	"portfolio-investment/configs"
 	"portfolio-investment/database"
+	"portfolio-investment/logging"
+	"portfolio-investment/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// PUBLIC: Create user record with a unique reference ID
+func (s *Store) CreateUser(ctx *context.Context, referenceID string) (*database.User, error) {
+	user := database.User{ReferenceID: referenceID}
+	err := s.withContext(ctx).Create(&user).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user for reference ID (%s): %w", referenceID, err)
+	}
+	return &user, nil
+}
+
 // PUBLIC: Get user's record by reference ID
-func GetUser(ctx *context.Context, referenceID string) (*database.User, error) {
+func (s *Store) GetUser(ctx *context.Context, referenceID string) (*database.User, error) {
 	var user database.User
-	err := database.WithContext(ctx).Where(&database.User{ReferenceID: referenceID}).First(&user).Error
+	err := s.withContext(ctx).Where(&database.User{ReferenceID: referenceID}).First(&user).Error
 	if err != nil {
 		return nil, err
 	}
@@ -16,14 +32,14 @@ func GetUser(ctx *context.Context, referenceID string) (*database.User, error) {
 }
 
 // PUBLIC: Get user's portfolios by reference ID
-func GetUserPortfolios(ctx *context.Context, referenceID string) ([]database.UserPortfolio, error) {
-	user, err := GetUser(ctx, referenceID)
+func (s *Store) GetUserPortfolios(ctx *context.Context, referenceID string) ([]database.UserPortfolio, error) {
+	user, err := s.GetUser(ctx, referenceID)
 	if err != nil {
 		return nil, err
 	}
 
 	var userPortfolios []database.UserPortfolio
-	err = database.WithContext(ctx).Preload("User").Preload("Portfolio").Where(
+	err = s.withContext(ctx).Preload("User").Preload("Portfolio").Where(
 		&database.UserPortfolio{UserID: user.ID},
 	).Find(&userPortfolios).Error
 	if err != nil {
@@ -33,14 +49,17 @@ func GetUserPortfolios(ctx *context.Context, referenceID string) ([]database.Use
 }
 
 // PUBLIC: Get user's deposit plan record(s) by reference ID
-func GetUserDepositPlans(ctx *context.Context, referenceID string) ([]database.UserDepositPlan, error) {
-	user, err := GetUser(ctx, referenceID)
+func (s *Store) GetUserDepositPlans(ctx *context.Context, referenceID string) (_ []database.UserDepositPlan, err error) {
+	ctx, span := tracing.Start(ctx, "repositories.GetUserDepositPlans", attribute.String(logging.UserIDKey, referenceID))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.GetUser(ctx, referenceID)
 	if err != nil {
 		return nil, err
 	}
 
 	var userDepositPlans []database.UserDepositPlan
-	err = database.WithContext(ctx).Preload("User").Preload("Portfolio").Where(
+	err = s.withContext(ctx).Preload("User").Preload("Portfolio").Where(
 		&database.UserDepositPlan{UserID: user.ID},
 	).Find(&userDepositPlans).Error
 	if err != nil {
@@ -48,3 +67,22 @@ func GetUserDepositPlans(ctx *context.Context, referenceID string) ([]database.U
 	}
 	return userDepositPlans, nil
 }
+
+// PUBLIC: Set user's default allocation strategy by reference ID
+func (s *Store) SetUserAllocationStrategy(
+	ctx *context.Context,
+	referenceID string,
+	strategyType configs.AllocationStrategyType,
+) (*database.User, error) {
+	user, err := s.GetUser(ctx, referenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.AllocationStrategy = strategyType
+	err = s.withContext(ctx).Model(user).Update("allocation_strategy", strategyType).Error
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
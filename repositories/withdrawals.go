@@ -0,0 +1,189 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/logging"
+	"portfolio-investment/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// PRIVATE: Debit user portfolios by the given amounts and record each debit
+// Returns debited funds per portfolio => { PortfolioReferenceID : Debited Fund }
+func debitFunds(
+	tx *gorm.DB,
+	userPortfolios []database.UserPortfolio,
+	transaction *database.Transaction,
+	amounts []money.Money,
+) (map[string]money.Money, error) {
+	results := make(map[string]money.Money)
+
+	for i, userPortfolio := range userPortfolios {
+		amount := amounts[i]
+		if amount <= 0 {
+			continue
+		}
+
+		// Create withdrawal
+		withdrawal := database.Withdrawal{
+			Transaction:   *transaction,
+			UserPortfolio: userPortfolio,
+			Amount:        amount,
+		}
+		err := tx.Create(&withdrawal).Error
+		if err != nil {
+			return nil, err
+		}
+
+		// Update user portfolio funds, and holdings pro-rata
+		err = updateFund(tx, &userPortfolio, -amount)
+		if err != nil {
+			return nil, err
+		}
+		if err := debitHoldings(tx, &userPortfolio, transaction, amount); err != nil {
+			return nil, err
+		}
+		results[userPortfolio.Portfolio.ReferenceID] = userPortfolio.Fund
+
+		slog.DebugContext(logging.WithTransactionID(tx.Statement.Context, transaction.ReferenceID), "Withdrew from portfolio",
+			"portfolio", userPortfolio.Portfolio.ReferenceID, "amount", amount, "fund", userPortfolio.Fund)
+	}
+
+	return results, nil
+}
+
+// PUBLIC: Create transaction records for withdrawals
+func (s *Store) CreateWithdrawalTransactions(
+	ctx *context.Context,
+	userReferenceID string,
+	amounts []money.Money,
+) ([]database.Transaction, error) {
+	db := s.withContext(ctx)
+
+	user, err := s.GetUser(ctx, userReferenceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user for reference ID (%s): %w", userReferenceID, err)
+	}
+
+	transactions := make([]database.Transaction, 0, len(amounts))
+	for _, amount := range amounts {
+		trxnReferenceID := uuid.New().String()
+		transaction := database.Transaction{
+			ReferenceID: trxnReferenceID,
+			User:        *user,
+			Type:        configs.TrxnTypeWithdrawal,
+			Amount:      amount,
+			Status:      configs.TrxnStatusPending,
+		}
+		transactions = append(transactions, transaction)
+	}
+	err = db.Create(&transactions).Error
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to create transaction for user reference ID (%s) and amounts (%v): %w",
+			userReferenceID, amounts, err,
+		)
+	}
+
+	return transactions, nil
+}
+
+// PUBLIC: Withdraw funds from user's portfolios
+// If portfolioReferenceID is empty, funds are withdrawn pro-rata across all portfolios by current fund
+// Transactions are processed atomically; if any fails, all are rolled back and marked 'failed'
+func (s *Store) WithdrawFunds(
+	ctx *context.Context,
+	transactions []database.Transaction,
+	portfolioReferenceID string,
+) (map[string]money.Money, error) {
+
+	withdrawals := make(map[string]money.Money)
+
+	// Use a transaction to ensure atomicity
+	// Any overdraw rolls back every withdrawal in the batch; a concurrent update of the funds retries it
+	err := s.withRetry(ctx, func(tx *gorm.DB) error {
+		clear(withdrawals)
+
+		for _, transaction := range transactions {
+
+			err := transitionTransaction(dbLedger{tx}, &transaction, configs.TrxnStatusProcessing, "")
+			if err != nil {
+				return err
+			}
+
+			// Reload user portfolios on every transaction to see earlier debits
+			var userPortfolios []database.UserPortfolio
+			err = tx.Preload("Portfolio").Where(
+				&database.UserPortfolio{UserID: transaction.User.ID},
+			).Find(&userPortfolios).Error
+			if err != nil {
+				return fmt.Errorf("failed to get user portfolios for user %s: %w", transaction.User.ReferenceID, err)
+			}
+
+			var amounts []money.Money
+
+			if portfolioReferenceID != "" {
+				// Targeted: withdraw the whole amount from a single portfolio, if its fund covers it
+				var target *database.UserPortfolio
+				for i := range userPortfolios {
+					if userPortfolios[i].Portfolio.ReferenceID == portfolioReferenceID {
+						target = &userPortfolios[i]
+						break
+					}
+				}
+				if target == nil {
+					return fmt.Errorf("user %s has no portfolio %s: %w",
+						transaction.User.ReferenceID, portfolioReferenceID, gorm.ErrRecordNotFound)
+				}
+				if target.Fund < transaction.Amount {
+					return fmt.Errorf("cannot withdraw %s from portfolio %s with fund %s: %w",
+						transaction.Amount, portfolioReferenceID, target.Fund, ErrInsufficientFunds)
+				}
+				userPortfolios = []database.UserPortfolio{*target}
+				amounts = []money.Money{transaction.Amount}
+			} else {
+				// Pro-rata: withdraw from each portfolio by its share of the total fund
+				funds := make([]money.Money, len(userPortfolios))
+				for i, userPortfolio := range userPortfolios {
+					funds[i] = userPortfolio.Fund
+				}
+				totalFund := money.Sum(funds...)
+				if totalFund < transaction.Amount {
+					return fmt.Errorf("cannot withdraw %s from total fund %s: %w",
+						transaction.Amount, totalFund, ErrInsufficientFunds)
+				}
+				amounts = transaction.Amount.SplitWithin(funds)
+			}
+
+			slog.InfoContext(logging.WithTransactionID(tx.Statement.Context, transaction.ReferenceID),
+				"Withdrawing", "amount", transaction.Amount)
+			results, err := debitFunds(tx, userPortfolios, &transaction, amounts)
+			if err != nil {
+				return fmt.Errorf("failed to withdraw funds: %w", err)
+			}
+			for portfolioReferenceID, funds := range results {
+				withdrawals[portfolioReferenceID] = funds
+			}
+
+			err = transitionTransaction(dbLedger{tx}, &transaction, configs.TrxnStatusCompleted, "")
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, failTransactions(s.unitOfWork(ctx), transactions, err)
+	}
+
+	return withdrawals, nil
+}
@@ -0,0 +1,122 @@
+// Investment returns: time-weighted over valuation periods, and money-weighted (XIRR) over dated cash flows
+package returns
+
+import (
+	"errors"
+	"math"
+	"portfolio-investment/money"
+	"time"
+)
+
+const (
+	daysPerYear   = 365.0
+	xirrTolerance = 1e-9
+	maxIterations = 100
+)
+
+var ErrNoSolution = errors.New("no rate of return solves the cash flows")
+
+// Valuation period ending with a cash flow: value at its start, and at its end including the flow
+type Period struct {
+	Start money.Money
+	End   money.Money
+	Flow  money.Money // Net amount added (or taken, if negative) at the end of the period
+}
+
+// Dated amount from the investor's point of view: negative when invested, positive when taken out
+type CashFlow struct {
+	Date   time.Time
+	Amount money.Money
+}
+
+// PUBLIC: Compound the returns of consecutive periods, each (end - flow) / start; cash flows don't count as gains
+// Periods starting from nothing have no return of their own and are skipped
+func TimeWeighted(periods []Period) float64 {
+	growth := 1.0
+	for _, period := range periods {
+		if period.Start <= 0 {
+			continue
+		}
+		growth *= (period.End - period.Flow).Float64() / period.Start.Float64()
+	}
+	return growth - 1
+}
+
+// PUBLIC: Annual rate at which the cash flows' net present value, discounted from the first flow's date, is zero
+// Needs at least one negative and one positive flow; found by Newton's method, falling back to bisection
+func XIRR(flows []CashFlow) (float64, error) {
+	var invested, received bool
+	for _, flow := range flows {
+		invested = invested || flow.Amount < 0
+		received = received || flow.Amount > 0
+	}
+	if !invested || !received {
+		return 0, ErrNoSolution
+	}
+	start := flows[0].Date
+	for _, flow := range flows {
+		if flow.Date.Before(start) {
+			start = flow.Date
+		}
+	}
+
+	// Net present value at a rate, and its derivative
+	npv := func(rate float64) (float64, float64) {
+		var value, derivative float64
+		for _, flow := range flows {
+			years := flow.Date.Sub(start).Hours() / 24 / daysPerYear
+			discount := math.Pow(1+rate, years)
+			value += flow.Amount.Float64() / discount
+			derivative -= years * flow.Amount.Float64() / (discount * (1 + rate))
+		}
+		return value, derivative
+	}
+
+	rate := 0.1
+	for range maxIterations {
+		value, derivative := npv(rate)
+		if math.Abs(value) < xirrTolerance {
+			return rate, nil
+		}
+		if derivative == 0 || math.IsNaN(value) {
+			break
+		}
+		next := rate - value/derivative
+		if next <= -1 || math.IsNaN(next) || math.IsInf(next, 0) {
+			break
+		}
+		if math.Abs(next-rate) < xirrTolerance {
+			return next, nil
+		}
+		rate = next
+	}
+	return bisect(npv)
+}
+
+// PRIVATE: Find the rate where npv changes sign, between just above -100% and a bound widened until it brackets one
+func bisect(npv func(rate float64) (float64, float64)) (float64, error) {
+	low, high := -0.999999, 1.0
+	lowValue, _ := npv(low)
+	highValue, _ := npv(high)
+	for lowValue*highValue > 0 {
+		if high > 1e6 {
+			return 0, ErrNoSolution
+		}
+		high *= 10
+		highValue, _ = npv(high)
+	}
+
+	for range 1000 {
+		mid := (low + high) / 2
+		value, _ := npv(mid)
+		if math.Abs(value) < xirrTolerance || high-low < xirrTolerance {
+			return mid, nil
+		}
+		if value*lowValue > 0 {
+			low, lowValue = mid, value
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2, nil
+}
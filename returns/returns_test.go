@@ -0,0 +1,81 @@
+package returns
+
+import (
+	"errors"
+	"math"
+	"portfolio-investment/money"
+	"testing"
+	"time"
+)
+
+func TestTimeWeighted(t *testing.T) {
+	var tests = []struct {
+		name     string
+		periods  []Period
+		expected float64
+	}{
+		{"Test no periods", nil, 0},
+		{"Test first deposit has no return", []Period{{Start: 0, End: 10000, Flow: 10000}}, 0},
+		{"Test single period gain", []Period{{Start: 10000, End: 11000}}, 0.1},
+		{"Test deposit isn't a gain", []Period{{Start: 10000, End: 16000, Flow: 5000}, {Start: 16000, End: 17600}}, 0.21},
+		{"Test withdrawal isn't a loss", []Period{{Start: 10000, End: 5000, Flow: -5000}, {Start: 5000, End: 4950}}, -0.01},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := TimeWeighted(tt.periods)
+			if math.Abs(actual-tt.expected) > 1e-9 {
+				t.Errorf("❌ Expected %.6f, got %.6f", tt.expected, actual)
+			} else {
+				t.Logf("✅ Time-weighted return %.6f", actual)
+			}
+		})
+	}
+}
+
+func TestXIRR(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	var tests = []struct {
+		name     string
+		flows    []CashFlow
+		expected float64
+		err      error
+	}{
+		{"Test one year at 10%", []CashFlow{
+			{date(2025, 1, 1), money.FromFloat(-1000)},
+			{date(2026, 1, 1), money.FromFloat(1100)},
+		}, 0.1, nil},
+		{"Test irregular flows", []CashFlow{ // Spreadsheet XIRR reference example
+			{date(2008, 1, 1), money.FromFloat(-10000)},
+			{date(2008, 3, 1), money.FromFloat(2750)},
+			{date(2008, 10, 30), money.FromFloat(4250)},
+			{date(2009, 2, 15), money.FromFloat(3250)},
+			{date(2009, 4, 1), money.FromFloat(2750)},
+		}, 0.373362535, nil},
+		{"Test near total loss", []CashFlow{
+			{date(2025, 1, 1), money.FromFloat(-1000)},
+			{date(2026, 1, 1), money.FromFloat(10)},
+		}, -0.99, nil},
+		{"Test flows out of order", []CashFlow{
+			{date(2026, 1, 1), money.FromFloat(1100)},
+			{date(2025, 1, 1), money.FromFloat(-1000)},
+		}, 0.1, nil},
+		{"Test only invested", []CashFlow{{date(2025, 1, 1), money.FromFloat(-1000)}}, 0, ErrNoSolution},
+		{"Test no flows", nil, 0, ErrNoSolution},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := XIRR(tt.flows)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("❌ Expected error %v, got %v", tt.err, err)
+			}
+			if math.Abs(actual-tt.expected) > 1e-6 {
+				t.Errorf("❌ Expected %.9f, got %.9f", tt.expected, actual)
+			} else {
+				t.Logf("✅ XIRR %.9f", actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"portfolio-investment/logging"
+	"portfolio-investment/money"
+	"portfolio-investment/prices"
+	"portfolio-investment/repositories"
+	"portfolio-investment/returns"
+	"portfolio-investment/tracing"
+	"slices"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var ErrInvalidRange = errors.New("invalid date range")
+
+// Longest range returns are computed over: each day with cash flows in it values every portfolio
+const MaxReturnsYears = 5
+
+// Performance of a user portfolio, or of all the user's portfolios, from the start of one day to the close of another
+type Return struct {
+	From          time.Time
+	To            time.Time
+	StartValue    money.Money // Market value at the close of the day before From
+	EndValue      money.Money // Market value at the close of To
+	NetCashFlow   money.Money // Deposits less withdrawals
+	TimeWeighted  float64     // Growth compounded between cash flows, over the whole range
+	MoneyWeighted *float64    // Annual rate (XIRR) of the start value, cash flows and end value; nil without a solution
+}
+
+// Returns of a user, overall and per portfolio
+type Returns struct {
+	User       Return
+	Portfolios map[string]Return // => { PortfolioReferenceID : Return }
+}
+
+// PUBLIC: Get time-weighted and money-weighted returns of user's portfolios, overall and per portfolio, from the start
+// of one day to the close of another; needs a store
+// Portfolios are valued at market prices at the start, the end, and the close of every day with deposits or withdrawals,
+// each valuation taking a few queries per portfolio: ranges are bounded to MaxReturnsYears, and callers interested in
+// one portfolio should use GetPortfolioReturn
+func (s *Service) GetReturns(
+	ctx *context.Context,
+	userReferenceID string,
+	from time.Time,
+	to time.Time,
+) (_ *Returns, err error) {
+	ctx, span := tracing.Start(ctx, "services.GetReturns", attribute.String(logging.UserIDKey, userReferenceID))
+	defer func() { tracing.End(span, err) }()
+
+	return s.getReturns(ctx, userReferenceID, "", from, to)
+}
+
+// PUBLIC: Get time-weighted and money-weighted return of one of user's portfolios, from the start of one day to the
+// close of another; needs a store
+// Only that portfolio is valued, and only on the days with its own deposits or withdrawals
+func (s *Service) GetPortfolioReturn(
+	ctx *context.Context,
+	userReferenceID string,
+	portfolioReferenceID string,
+	from time.Time,
+	to time.Time,
+) (_ *Return, err error) {
+	ctx, span := tracing.Start(ctx, "services.GetPortfolioReturn", attribute.String(logging.UserIDKey, userReferenceID),
+		attribute.String("portfolio", portfolioReferenceID))
+	defer func() { tracing.End(span, err) }()
+
+	results, err := s.getReturns(ctx, userReferenceID, portfolioReferenceID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &results.User, nil
+}
+
+// PRIVATE: Get returns of user's portfolios, or only of one if portfolioReferenceID isn't empty
+func (s *Service) getReturns(
+	ctx *context.Context,
+	userReferenceID string,
+	portfolioReferenceID string,
+	from time.Time,
+	to time.Time,
+) (*Returns, error) {
+	if err := s.requireStore("returns"); err != nil {
+		return nil, err
+	}
+	from, to = prices.Day(from), prices.Day(to)
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: %s is after %s", ErrInvalidRange, from.Format(prices.DateLayout), to.Format(prices.DateLayout))
+	}
+	if to.After(from.AddDate(MaxReturnsYears, 0, 0)) {
+		return nil, fmt.Errorf("%w: %s to %s is longer than %d years",
+			ErrInvalidRange, from.Format(prices.DateLayout), to.Format(prices.DateLayout), MaxReturnsYears)
+	}
+
+	flows, err := s.store.GetCashFlows(ctx, userReferenceID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cash flows: %w", err)
+	}
+	if portfolioReferenceID != "" {
+		flows = slices.DeleteFunc(flows, func(flow repositories.CashFlow) bool {
+			return flow.PortfolioReferenceID != portfolioReferenceID
+		})
+	}
+
+	// Net flows per day they were made on, and portfolio => { Day : { PortfolioReferenceID : Amount } }
+	flowed := make(map[time.Time]map[string]money.Money)
+	for _, flow := range flows {
+		day := prices.Day(flow.CreatedAt)
+		if flowed[day] == nil {
+			flowed[day] = make(map[string]money.Money)
+		}
+		flowed[day][flow.PortfolioReferenceID] += flow.Amount
+	}
+	breaks := make([]time.Time, 0, len(flowed)+1)
+	for day := range flowed {
+		breaks = append(breaks, day)
+	}
+	sort.Slice(breaks, func(i, j int) bool { return breaks[i].Before(breaks[j]) })
+	if len(breaks) == 0 || !breaks[len(breaks)-1].Equal(to) {
+		breaks = append(breaks, to)
+	}
+
+	// Market values at the start and at the close of each break => { Day : { PortfolioReferenceID : Value } }
+	start := from.AddDate(0, 0, -1)
+	values := make(map[time.Time]map[string]money.Money, len(breaks)+1)
+	for _, day := range append([]time.Time{start}, breaks...) {
+		if portfolioReferenceID == "" {
+			values[day], err = s.store.GetPortfolioMarketValues(ctx, userReferenceID, day)
+		} else {
+			var value money.Money
+			value, err = s.store.GetPortfolioMarketValue(ctx, userReferenceID, portfolioReferenceID, day)
+			values[day] = map[string]money.Money{portfolioReferenceID: value}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get market values: %w", err)
+		}
+	}
+
+	// Sum over the selected portfolios, or all of them
+	sum := func(amounts map[string]money.Money, portfolioReferenceID string) money.Money {
+		if portfolioReferenceID != "" {
+			return amounts[portfolioReferenceID]
+		}
+		total := money.Zero
+		for _, amount := range amounts {
+			total += amount
+		}
+		return total
+	}
+	compute := func(portfolioReferenceID string) Return {
+		result := Return{
+			From:       from,
+			To:         to,
+			StartValue: sum(values[start], portfolioReferenceID),
+			EndValue:   sum(values[to], portfolioReferenceID),
+		}
+
+		periods := make([]returns.Period, 0, len(breaks))
+		cashFlows := []returns.CashFlow{{Date: from, Amount: -result.StartValue}}
+		previous := start
+		for _, day := range breaks {
+			flow := sum(flowed[day], portfolioReferenceID)
+			periods = append(periods, returns.Period{
+				Start: sum(values[previous], portfolioReferenceID),
+				End:   sum(values[day], portfolioReferenceID),
+				Flow:  flow,
+			})
+			previous = day
+			result.NetCashFlow += flow
+		}
+		for _, flow := range flows {
+			if portfolioReferenceID == "" || flow.PortfolioReferenceID == portfolioReferenceID {
+				cashFlows = append(cashFlows, returns.CashFlow{Date: flow.CreatedAt, Amount: -flow.Amount})
+			}
+		}
+		cashFlows = append(cashFlows, returns.CashFlow{Date: to.AddDate(0, 0, 1), Amount: result.EndValue})
+
+		result.TimeWeighted = returns.TimeWeighted(periods)
+		if rate, err := returns.XIRR(cashFlows); err == nil {
+			result.MoneyWeighted = &rate
+		}
+		return result
+	}
+
+	results := &Returns{User: compute(""), Portfolios: make(map[string]Return, len(values[to]))}
+	for portfolioReferenceID := range values[to] {
+		results.Portfolios[portfolioReferenceID] = compute(portfolioReferenceID)
+	}
+	return results, nil
+}
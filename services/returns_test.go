@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/database/dbtest"
+	"portfolio-investment/money"
+	"portfolio-investment/prices"
+	"portfolio-investment/repositories"
+	"portfolio-investment/strategies"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestGetReturns(t *testing.T) {
+	const userReferenceID = "user-returns"
+	highRisk := configs.DefaultPortfolioHighRisk
+	ctx := context.Background()
+	db, config := dbtest.New(t)
+	store := repositories.NewStore(db, config, nil)
+	service := NewService(store)
+
+	// Bitcoin 120.00 and Ethereum 12.50 today, 240.00 and 6.25 tomorrow
+	today := prices.Day(time.Now())
+	tomorrow := today.AddDate(0, 0, 1)
+	_, err := store.SaveAssetPrices(&ctx, []prices.Quote{
+		{Asset: "Bitcoin", Date: today, Price: money.FromFloat(120.0)},
+		{Asset: "Ethereum", Date: today, Price: money.FromFloat(12.5)},
+		{Asset: "Bitcoin", Date: tomorrow, Price: money.FromFloat(240.0)},
+		{Asset: "Ethereum", Date: tomorrow, Price: money.FromFloat(6.25)},
+	})
+	if err != nil {
+		t.Fatalf("SaveAssetPrices failed: %v", err)
+	}
+
+	// 100.00 split 70/30 today is worth 155.00 tomorrow
+	if _, err := store.CreateUser(&ctx, userReferenceID); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	plan, err := store.CreateUserDepositPlan(&ctx, userReferenceID, highRisk, configs.PlanTypeMonthly, money.FromFloat(1000.0))
+	if err != nil {
+		t.Fatalf("CreateUserDepositPlan failed: %v", err)
+	}
+	deposits, err := store.CreateDepositTransactions(&ctx, userReferenceID,
+		repositories.NewTransactionRequests([]money.Money{money.FromFloat(100.0)}))
+	if err != nil {
+		t.Fatalf("CreateDepositTransactions failed: %v", err)
+	}
+	if _, err := store.DepositFunds(&ctx, deposits, []database.UserDepositPlan{*plan}, strategies.Waterfall{}); err != nil {
+		t.Fatalf("DepositFunds failed: %v", err)
+	}
+
+	var tests = []struct {
+		name         string
+		from         time.Time
+		to           time.Time
+		start        money.Money
+		end          money.Money
+		flow         money.Money
+		timeWeighted float64
+		moneyGained  bool // Whether the money-weighted return is positive, or missing
+	}{
+		{"Test return of the deposit day", today, today, 0, money.FromFloat(100.0), money.FromFloat(100.0), 0, false},
+		{"Test return over the deposit and price rise", today, tomorrow, 0, money.FromFloat(155.0), money.FromFloat(100.0), 0.55, true},
+		{"Test return after the deposit", tomorrow, tomorrow, money.FromFloat(100.0), money.FromFloat(155.0), 0, 0.55, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := service.GetReturns(&ctx, userReferenceID, tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("❌ GetReturns failed: %v", err)
+			}
+			user, portfolio := results.User, results.Portfolios[highRisk]
+			if user.StartValue != tt.start || user.EndValue != tt.end || user.NetCashFlow != tt.flow {
+				t.Fatalf("❌ Expected %s to %s with %s flowing in, got %s to %s with %s",
+					tt.start, tt.end, tt.flow, user.StartValue, user.EndValue, user.NetCashFlow)
+			}
+			if math.Abs(user.TimeWeighted-tt.timeWeighted) > 1e-9 || portfolio.TimeWeighted != user.TimeWeighted {
+				t.Errorf("❌ Expected time-weighted return %.4f, got %.4f (portfolio %.4f)",
+					tt.timeWeighted, user.TimeWeighted, portfolio.TimeWeighted)
+			}
+			if gained := user.MoneyWeighted != nil && *user.MoneyWeighted > 0; gained != tt.moneyGained {
+				t.Errorf("❌ Expected money-weighted gain %v, got %v", tt.moneyGained, user.MoneyWeighted)
+			} else {
+				t.Logf("✅ Time-weighted return %.4f", user.TimeWeighted)
+			}
+
+			// The portfolio alone returns as it does among all of them
+			single, err := service.GetPortfolioReturn(&ctx, userReferenceID, highRisk, tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("❌ GetPortfolioReturn failed: %v", err)
+			}
+			if !reflect.DeepEqual(*single, portfolio) {
+				t.Errorf("❌ Expected portfolio return %+v, got %+v", portfolio, *single)
+			}
+		})
+	}
+
+	if _, err := service.GetReturns(&ctx, userReferenceID, tomorrow, today); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("❌ Expected reversed range to be refused, got %v", err)
+	}
+	if _, err := service.GetReturns(&ctx, userReferenceID, today.AddDate(-MaxReturnsYears, 0, -1), today); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("❌ Expected range over %d years to be refused, got %v", MaxReturnsYears, err)
+	}
+	_, err = service.GetPortfolioReturn(&ctx, userReferenceID, configs.DefaultPortfolioRetirement, today, today)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("❌ Expected portfolio the user doesn't hold to be not found, got %v", err)
+	}
+}
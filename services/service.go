@@ -0,0 +1,488 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/logging"
+	"portfolio-investment/metrics"
+	"portfolio-investment/money"
+	"portfolio-investment/repositories"
+	"portfolio-investment/strategies"
+	"portfolio-investment/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+var ErrStoreRequired = errors.New("operation needs a store; build the service with NewService")
+
+// Business operations on user funds
+type Service struct {
+	repository repositories.Repository // Totals and deposits
+	store      *repositories.Store     // Withdrawals, plans and cash
+	metrics    *metrics.Metrics
+}
+
+// PUBLIC: Build service on a store, recording metrics along with it
+func NewService(store *repositories.Store) *Service {
+	return &Service{repository: store, store: store, metrics: store.Metrics()}
+}
+
+// PUBLIC: Build service for totals and deposits only, on any repository (e.g. in memory, for unit tests)
+// Withdrawals, plans, cash, market values and returns need a store (use NewService); here they fail with ErrStoreRequired
+func NewDepositService(repository repositories.Repository) *Service {
+	return &Service{repository: repository}
+}
+
+// PRIVATE: Refuse an operation a repository alone can't do when the service has no store
+func (s *Service) requireStore(operation string) error {
+	if s.store == nil {
+		return fmt.Errorf("%w: %s", ErrStoreRequired, operation)
+	}
+	return nil
+}
+
+func (s *Service) GetUserTotalFunds(ctx *context.Context, userReferenceID string) (money.Money, error) {
+	// Get user portfolios
+	userPortfolios, err := s.repository.GetUserPortfolios(ctx, userReferenceID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user portfolios: %w", err)
+	}
+
+	// Calculate total funds
+	total := money.Zero
+	for _, userPortfolio := range userPortfolios {
+		total += userPortfolio.Fund
+	}
+
+	return total, nil
+}
+
+func (s *Service) GetPortfolioTotalFunds(ctx *context.Context, userReferenceID string) (map[string]money.Money, error) {
+	// Get user portfolios
+	userPortfolios, err := s.repository.GetUserPortfolios(ctx, userReferenceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user portfolios: %w", err)
+	}
+
+	totals := make(map[string]money.Money)
+
+	// Calculate total funds
+	for _, userPortfolio := range userPortfolios {
+		portfolioReferenceID := userPortfolio.Portfolio.ReferenceID
+		if _, exists := totals[portfolioReferenceID]; !exists {
+			totals[portfolioReferenceID] = 0
+		}
+		totals[portfolioReferenceID] += userPortfolio.Fund
+	}
+
+	return totals, nil
+}
+
+// PUBLIC: Get market value of user's portfolios at the close of a day => { PortfolioReferenceID : Value }
+// Counterpart of GetPortfolioTotalFunds valued at asset prices; needs a store
+func (s *Service) GetPortfolioMarketValues(
+	ctx *context.Context,
+	userReferenceID string,
+	day time.Time,
+) (map[string]money.Money, error) {
+	if err := s.requireStore("market values"); err != nil {
+		return nil, err
+	}
+	values, err := s.store.GetPortfolioMarketValues(ctx, userReferenceID, day)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get portfolio market values: %w", err)
+	}
+	return values, nil
+}
+
+// PUBLIC: Propose trades restoring target asset weights of user's portfolios, beyond a tolerance in basis points
+// (negative for the configured one); needs a store
+func (s *Service) ProposeRebalance(
+	ctx *context.Context,
+	userReferenceID string,
+	tolerance int,
+) ([]repositories.RebalanceProposal, error) {
+	if err := s.requireStore("rebalancing"); err != nil {
+		return nil, err
+	}
+	proposals, err := s.store.ProposeRebalance(ctx, userReferenceID, tolerance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to propose rebalance: %w", err)
+	}
+	return proposals, nil
+}
+
+// PUBLIC: Get market value of all user's portfolios at the close of a day; needs a store
+func (s *Service) GetUserMarketValue(ctx *context.Context, userReferenceID string, day time.Time) (money.Money, error) {
+	values, err := s.GetPortfolioMarketValues(ctx, userReferenceID, day)
+	if err != nil {
+		return 0, err
+	}
+
+	total := money.Zero
+	for _, value := range values {
+		total += value
+	}
+	return total, nil
+}
+
+// Resolve allocation strategy for a call, falling back to the user's default
+func (s *Service) GetAllocationStrategy(
+	ctx *context.Context,
+	userReferenceID string,
+	strategyType configs.AllocationStrategyType,
+) (strategies.AllocationStrategy, error) {
+	if strategyType == "" {
+		user, err := s.repository.GetUser(ctx, userReferenceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		strategyType = user.AllocationStrategy
+	}
+	return strategies.Get(strategyType)
+}
+
+// Outcome of a single deposit transaction
+type DepositResult struct {
+	ReferenceID string
+	Amount      money.Money
+	Status      configs.TransactionStatus
+	Replayed    bool                   // Reference ID was already used; the original outcome is returned
+	Allocations map[string]money.Money // Allocated amount per portfolio => { PortfolioReferenceID : Allocated Fund }
+	Cash        money.Money            // Amount credited to cash
+}
+
+// Outcome of a batch of deposits
+type DepositResults struct {
+	Portfolios   map[string]money.Money // Updated funds per portfolio => { PortfolioReferenceID : Fund }
+	Transactions []DepositResult
+}
+
+func (s *Service) ProcessFunds(
+	ctx *context.Context,
+	userReferenceID string,
+	funds []money.Money,
+	strategyType configs.AllocationStrategyType,
+) (_ map[string]money.Money, err error) {
+	ctx, span := tracing.Start(ctx, "services.ProcessFunds",
+		attribute.String(logging.UserIDKey, userReferenceID), attribute.Int("funds", len(funds)))
+	defer func() {
+		s.metrics.ProcessFundsCalled(err)
+		tracing.End(span, err)
+	}()
+
+	validFunds := []money.Money{}
+	for _, fund := range funds {
+		if fund > 0 {
+			validFunds = append(validFunds, fund)
+		}
+	}
+	if len(validFunds) == 0 {
+		slog.WarnContext(*ctx, "No valid funds to deposit", "funds", funds)
+		return make(map[string]money.Money), nil
+	}
+
+	results, err := s.processDeposits(ctx, userReferenceID, repositories.NewTransactionRequests(validFunds), strategyType)
+	if err != nil {
+		return nil, err
+	}
+	return results.Portfolios, nil
+}
+
+// Process deposits keyed by client reference IDs
+// Replayed reference IDs are not deposited again: a still pending transaction is processed once,
+// and an already processed one returns its original allocations
+func (s *Service) ProcessDeposits(
+	ctx *context.Context,
+	userReferenceID string,
+	requests []repositories.TransactionRequest,
+	strategyType configs.AllocationStrategyType,
+) (_ *DepositResults, err error) {
+	defer func() { s.metrics.ProcessFundsCalled(err) }()
+	return s.processDeposits(ctx, userReferenceID, requests, strategyType)
+}
+
+// PRIVATE: Process deposits keyed by client reference IDs, for ProcessDeposits and ProcessFunds to record the call
+func (s *Service) processDeposits(
+	ctx *context.Context,
+	userReferenceID string,
+	requests []repositories.TransactionRequest,
+	strategyType configs.AllocationStrategyType,
+) (_ *DepositResults, err error) {
+	ctx, span := tracing.Start(ctx, "services.ProcessDeposits",
+		attribute.String(logging.UserIDKey, userReferenceID), attribute.Int("requests", len(requests)))
+	defer func() { tracing.End(span, err) }()
+
+	// Resolve allocation strategy before creating any transaction
+	strategy, err := s.GetAllocationStrategy(ctx, userReferenceID, strategyType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get allocation strategy: %w", err)
+	}
+
+	// Create a transaction for each deposit, or get the existing one for a replay
+	transactions, err := s.repository.CreateDepositTransactions(ctx, userReferenceID, requests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create deposit transaction: %w", err)
+	}
+
+	// Only process each pending transaction once, even if its reference ID is repeated
+	var pending []database.Transaction
+	queued := make(map[uint]bool)
+	for _, transaction := range transactions {
+		if transaction.Status == configs.TrxnStatusPending && !queued[transaction.ID] {
+			pending = append(pending, transaction)
+			queued[transaction.ID] = true
+		}
+	}
+
+	results := &DepositResults{Portfolios: make(map[string]money.Money)}
+	if len(pending) > 0 {
+		slog.InfoContext(*ctx, "Processing deposits", "transactions", len(pending))
+
+		// Get user deposit plans
+		plans, err := s.repository.GetUserDepositPlans(ctx, userReferenceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user one-time deposit plans: %w", err)
+		}
+
+		// Deposit funds into the plans
+		results.Portfolios, err = s.repository.DepositFunds(ctx, pending, plans, strategy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to deposit funds: %w", err)
+		}
+
+		slog.InfoContext(*ctx, "Completed deposits", "transactions", len(pending), "portfolios", results.Portfolios)
+	}
+
+	// Report each transaction's outcome as recorded
+	for _, transaction := range transactions {
+		current, err := s.repository.GetTransaction(ctx, transaction.ReferenceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get transaction: %w", err)
+		}
+		allocations, cash, err := s.repository.GetTransactionAllocations(ctx, transaction.ReferenceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get transaction allocations: %w", err)
+		}
+		results.Transactions = append(results.Transactions, DepositResult{
+			ReferenceID: current.ReferenceID,
+			Amount:      current.Amount,
+			Status:      current.Status,
+			Replayed:    transaction.Replayed,
+			Allocations: allocations,
+			Cash:        cash,
+		})
+	}
+
+	return results, nil
+}
+
+// Amount a deposit would allocate to a single plan, and the steps it would come from
+type PlanPreview struct {
+	Plan   database.UserDepositPlan
+	Amount money.Money
+	Steps  map[strategies.Step]money.Money // Amount per allocation step => { Step : Amount }
+}
+
+// Outcome a deposit would have, without it being made
+type DepositPreview struct {
+	Amount     money.Money
+	Strategy   configs.AllocationStrategyType
+	Plans      []PlanPreview
+	Portfolios map[string]money.Money          // Amount per portfolio => { PortfolioReferenceID : Amount }
+	Steps      map[strategies.Step]money.Money // Amount per allocation step, including the remainder
+	Cash       money.Money                     // Amount that would be credited to cash
+}
+
+// Preview how a deposit would be allocated to the user's plans, using the same logic as ProcessDeposits
+// Nothing is persisted: no transaction is created, and no fund changes
+func (s *Service) PreviewDeposit(
+	ctx *context.Context,
+	userReferenceID string,
+	amount money.Money,
+	strategyType configs.AllocationStrategyType,
+) (*DepositPreview, error) {
+
+	// Resolve allocation strategy
+	strategy, err := s.GetAllocationStrategy(ctx, userReferenceID, strategyType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get allocation strategy: %w", err)
+	}
+
+	// Get user deposit plans
+	plans, err := s.repository.GetUserDepositPlans(ctx, userReferenceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user deposit plans: %w", err)
+	}
+
+	allocations, err := s.repository.PreviewDeposit(ctx, plans, strategy, amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview deposit: %w", err)
+	}
+
+	preview := &DepositPreview{
+		Amount:     amount,
+		Strategy:   strategy.Type(),
+		Portfolios: make(map[string]money.Money),
+		Steps:      make(map[strategies.Step]money.Money),
+	}
+
+	// Sum allocations per plan, in plan order, and per portfolio and step
+	planIndex := make(map[uint]int)
+	allocated := money.Zero
+	for _, allocation := range allocations {
+		if allocation.Amount == 0 {
+			continue
+		}
+		i, exists := planIndex[allocation.Plan.ID]
+		if !exists {
+			i = len(preview.Plans)
+			planIndex[allocation.Plan.ID] = i
+			preview.Plans = append(preview.Plans, PlanPreview{
+				Plan:  allocation.Plan,
+				Steps: make(map[strategies.Step]money.Money),
+			})
+		}
+		preview.Plans[i].Amount += allocation.Amount
+		preview.Plans[i].Steps[allocation.Step] += allocation.Amount
+		preview.Portfolios[allocation.Plan.Portfolio.ReferenceID] += allocation.Amount
+		preview.Steps[allocation.Step] += allocation.Amount
+		allocated += allocation.Amount
+	}
+
+	// Whatever no plan takes is credited to cash, as on deposit
+	if remainder := amount - allocated; remainder > 0 {
+		preview.Cash = remainder
+		preview.Steps[strategies.StepRemainder] = remainder
+	}
+
+	return preview, nil
+}
+
+// Get why a user's deposit was allocated the way it was: every allocation decision, in order
+// A transaction of another user is not found
+func (s *Service) GetAllocationDecisions(
+	ctx *context.Context,
+	userReferenceID string,
+	transactionReferenceID string,
+) (*database.Transaction, []database.AllocationDecision, error) {
+	transaction, err := s.repository.GetTransaction(ctx, transactionReferenceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get transaction: %w", err)
+	}
+	if transaction.User.ReferenceID != userReferenceID {
+		return nil, nil, fmt.Errorf("failed to get transaction (%s) of user (%s): %w",
+			transactionReferenceID, userReferenceID, gorm.ErrRecordNotFound)
+	}
+
+	decisions, err := s.repository.GetAllocationDecisions(ctx, transactionReferenceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get allocation decisions: %w", err)
+	}
+	return transaction, decisions, nil
+}
+
+func (s *Service) ProcessWithdrawals(
+	ctx *context.Context,
+	userReferenceID string,
+	portfolioReferenceID string,
+	funds []money.Money,
+) (map[string]money.Money, error) {
+	if err := s.requireStore("withdrawals"); err != nil {
+		return nil, err
+	}
+	validFunds := []money.Money{}
+	for _, fund := range funds {
+		if fund > 0 {
+			validFunds = append(validFunds, fund)
+		}
+	}
+	if len(validFunds) == 0 {
+		slog.WarnContext(*ctx, "No valid funds to withdraw", "funds", funds)
+		return make(map[string]money.Money), nil
+	}
+
+	// Create a transaction for the withdrawal
+	transactions, err := s.store.CreateWithdrawalTransactions(ctx, userReferenceID, validFunds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create withdrawal transaction: %w", err)
+	}
+
+	slog.InfoContext(*ctx, "Processing withdrawals", "funds", validFunds)
+
+	// Withdraw funds from the portfolios
+	results, err := s.store.WithdrawFunds(ctx, transactions, portfolioReferenceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to withdraw funds: %w", err)
+	}
+
+	slog.InfoContext(*ctx, "Completed withdrawals", "funds", validFunds, "portfolios", results)
+	return results, nil
+}
+
+// Sweep user's cash into plans with the user's default allocation strategy
+func (s *Service) sweepCash(ctx *context.Context, userReferenceID string) error {
+	if err := s.requireStore("cash sweeps"); err != nil {
+		return err
+	}
+	strategy, err := s.GetAllocationStrategy(ctx, userReferenceID, "")
+	if err != nil {
+		return fmt.Errorf("failed to get allocation strategy: %w", err)
+	}
+	if _, err := s.store.SweepCash(ctx, userReferenceID, strategy); err != nil {
+		return fmt.Errorf("failed to sweep cash: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) AddDepositPlan(
+	ctx *context.Context,
+	userReferenceID string,
+	portfolioReferenceID string,
+	planType configs.PlanType,
+	amount money.Money,
+) (*database.UserDepositPlan, error) {
+	if err := s.requireStore("deposit plans"); err != nil {
+		return nil, err
+	}
+	plan, err := s.store.CreateUserDepositPlan(ctx, userReferenceID, portfolioReferenceID, planType, amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create deposit plan: %w", err)
+	}
+
+	// New plan may take unallocated cash
+	if err := s.sweepCash(ctx, userReferenceID); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (s *Service) UpdateDepositPlan(
+	ctx *context.Context,
+	userReferenceID string,
+	portfolioReferenceID string,
+	planType configs.PlanType,
+	amount money.Money,
+) (*database.UserDepositPlan, error) {
+	if err := s.requireStore("deposit plans"); err != nil {
+		return nil, err
+	}
+	plan, previous, err := s.store.UpdateUserDepositPlanAmount(ctx, userReferenceID, portfolioReferenceID, planType, amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update deposit plan: %w", err)
+	}
+
+	// Topped up plan may take unallocated cash
+	if amount > previous {
+		if err := s.sweepCash(ctx, userReferenceID); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,826 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/database/dbtest"
+	"portfolio-investment/metrics"
+	"portfolio-investment/money"
+	"portfolio-investment/repositories"
+	"portfolio-investment/strategies"
+	"portfolio-investment/tracing/tracingtest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Service on a fresh seeded database, private to the test
+func newTestService(t *testing.T) *Service {
+	db, config := dbtest.New(t)
+	return NewService(repositories.NewStore(db, config, nil))
+}
+
+func TestProcessFunds(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer func() {
+		time.Sleep(1 * time.Second) // Wait for logs
+		cancel()
+	}()
+
+	userReferenceID := "user-123"
+
+	var tests = []struct {
+		name  string
+		funds []money.Money
+	}{
+		{"Test with valid happy case whole number funds", []money.Money{money.FromFloat(10500.0), money.FromFloat(100.0)}},
+		{"Test with valid decimal funds", []money.Money{money.FromFloat(10500.50), money.FromFloat(100.25)}},
+		{"Test with valid prime decimal funds", []money.Money{money.FromFloat(10501.37), money.FromFloat(100.73)}},
+		{"Test with valid mixed funds", []money.Money{money.FromFloat(10500.0), money.FromFloat(100.25), money.FromFloat(200.75)}},
+		{"Test with large funds", []money.Money{money.FromFloat(100000.0), money.FromFloat(3000050025.0)}},
+		{"Test with zero fund", []money.Money{money.FromFloat(0.0)}},
+		{"Test with negative fund", []money.Money{money.FromFloat(-100.0)}},
+		{"Test with mixed valid and invalid funds", []money.Money{money.FromFloat(10500.0), money.FromFloat(-100.0), money.FromFloat(200.0), money.FromFloat(0.0), money.FromFloat(300.75)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each case starts from the seeded state
+			service := newTestService(t)
+			funds := tt.funds
+			totalFunds := money.Zero
+			for _, fund := range funds {
+				if fund > 0 {
+					totalFunds += fund
+				}
+			}
+
+			fmt.Println("\n----------------------------------------------------------------------------------------------------")
+
+			// Get funds before processing
+			oldTotals, err := service.GetPortfolioTotalFunds(&ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserTotalFunds failed: %v", err)
+			}
+			fmt.Printf("📌 Old total funds: %v\n", oldTotals)
+			oldCash, err := service.store.GetUserCash(&ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserCash failed: %v", err)
+			}
+
+			// Process funds
+			resultTotals, err := service.ProcessFunds(&ctx, userReferenceID, funds, "")
+			if err != nil {
+				t.Fatalf("ProcessFunds failed: %v", err)
+			}
+			fmt.Printf("📌 Result total funds: %v\n", resultTotals)
+
+			// Get funds after processing
+			newTotals, err := service.GetPortfolioTotalFunds(&ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("ProcessFunds failed: %v", err)
+			}
+			fmt.Printf("📌 New total funds: %v\n", newTotals)
+			newCash, err := service.store.GetUserCash(&ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserCash failed: %v", err)
+			}
+
+			// Check if the new totals are greater than the old totals
+			totalAllocated := money.Zero
+			for portfolioReferenceID, resultTotal := range resultTotals {
+				oldTotal, oldTotalExists := oldTotals[portfolioReferenceID]
+				newTotal, newTotalExists := newTotals[portfolioReferenceID]
+				if !oldTotalExists {
+					t.Errorf("❌ Portfolio ID %s does not exist in old totals", portfolioReferenceID)
+				} else if !newTotalExists {
+					t.Errorf("❌ Portfolio ID %s does not exist in new totals", portfolioReferenceID)
+				} else if resultTotal < oldTotal {
+					t.Errorf("❌ Expected total funds for portfolio '%s' to increase, but got %s (old: %s)", portfolioReferenceID, resultTotal, oldTotal)
+				} else if resultTotal != newTotal {
+					t.Errorf("❌ Mismatch in total funds for portfolio '%s': expected %s, got %s", portfolioReferenceID, resultTotal, newTotal)
+				} else {
+					t.Logf("✅ Portfolio '%s' total funds increased as expected: %s (old: %s)",
+						portfolioReferenceID, resultTotal, oldTotal)
+				}
+
+				// Calculate total allocated funds
+				if resultTotal > 0 {
+					totalAllocated += (resultTotal - oldTotal)
+				}
+			}
+
+			// Unallocated funds are kept as cash
+			totalAllocated += newCash - oldCash
+
+			if totalFunds > 0 && totalAllocated != totalFunds {
+				t.Errorf("❌ Total allocated funds (%s) do not match expected total funds (%s)", totalAllocated, totalFunds)
+			} else {
+				t.Logf("✅ Total allocated funds match expected total funds: %s", totalAllocated)
+			}
+
+			fmt.Print("----------------------------------------------------------------------------------------------------\n\n")
+		})
+	}
+
+}
+
+func TestProcessFundsMetrics(t *testing.T) {
+	ctx := context.Background()
+	db, config := dbtest.New(t)
+	service := NewService(repositories.NewStore(db, config, metrics.New()))
+
+	// Every call is counted, including those returning before any deposit is processed
+	var tests = []struct {
+		name   string
+		user   string
+		funds  []money.Money
+		failed bool
+	}{
+		{"Test nothing due", "user-123", []money.Money{0}, false},
+		{"Test deposit processed", "user-123", []money.Money{money.FromFloat(100.0)}, false},
+		{"Test unknown user", "unknown-user", []money.Money{money.FromFloat(100.0)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.ProcessFunds(&ctx, tt.user, tt.funds, ""); (err != nil) != tt.failed {
+				t.Fatalf("❌ Expected failure %v, got %v", tt.failed, err)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	service.metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range []string{
+		`portfolio_process_funds_calls_total{outcome="success"} 2`,
+		`portfolio_process_funds_calls_total{outcome="error"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("❌ Expected %s", line)
+		} else {
+			t.Logf("✅ %s", line)
+		}
+	}
+}
+
+func TestProcessWithdrawals(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	userReferenceID := "user-123"
+
+	var tests = []struct {
+		name                 string
+		portfolioReferenceID string
+		funds                []money.Money
+		insufficient         bool
+	}{
+		{"Test targeted withdrawal", configs.DefaultPortfolioRetirement, []money.Money{money.FromFloat(50.0)}, false},
+		{"Test pro-rata withdrawal", "", []money.Money{money.FromFloat(100.0), money.FromFloat(25.50)}, false},
+		{"Test zero withdrawal", "", []money.Money{money.FromFloat(0.0)}, false},
+		{"Test targeted overdraw", configs.DefaultPortfolioRetirement, []money.Money{money.Money(math.MaxInt64 / 2)}, true},
+		{"Test pro-rata overdraw", "", []money.Money{money.FromFloat(10.0), money.Money(math.MaxInt64 / 2)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Ensure there are funds to withdraw from
+			service := newTestService(t)
+			if _, err := service.ProcessFunds(&ctx, userReferenceID, []money.Money{money.FromFloat(10600.0)}, ""); err != nil {
+				t.Fatalf("ProcessFunds failed: %v", err)
+			}
+
+			totalFunds := money.Zero
+			for _, fund := range tt.funds {
+				if fund > 0 {
+					totalFunds += fund
+				}
+			}
+
+			oldTotal, err := service.GetUserTotalFunds(&ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserTotalFunds failed: %v", err)
+			}
+
+			_, err = service.ProcessWithdrawals(&ctx, userReferenceID, tt.portfolioReferenceID, tt.funds)
+			if tt.insufficient {
+				if !errors.Is(err, repositories.ErrInsufficientFunds) {
+					t.Fatalf("❌ Expected insufficient funds error, got %v", err)
+				}
+				totalFunds = money.Zero // Whole batch must be rolled back
+			} else if err != nil {
+				t.Fatalf("ProcessWithdrawals failed: %v", err)
+			}
+
+			newTotal, err := service.GetUserTotalFunds(&ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserTotalFunds failed: %v", err)
+			}
+
+			if oldTotal-newTotal != totalFunds {
+				t.Errorf("❌ Expected total funds to decrease by %s, got %s (old: %s, new: %s)",
+					totalFunds, oldTotal-newTotal, oldTotal, newTotal)
+			} else {
+				t.Logf("✅ Total funds decreased as expected: %s", oldTotal-newTotal)
+			}
+		})
+	}
+}
+
+func TestProcessFundsMonthlyPeriod(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	service := newTestService(t)
+	userReferenceID := "user-123"
+
+	// Fund every plan for the current period, then move all contributions into last month
+	if _, err := service.ProcessFunds(&ctx, userReferenceID, []money.Money{money.FromFloat(10600.0)}, ""); err != nil {
+		t.Fatalf("ProcessFunds failed: %v", err)
+	}
+	lastMonth := database.Now().AddDate(0, -1, 0)
+	err := service.store.DB().WithContext(ctx).Model(&database.Deposit{}).Where("1 = 1").Update("created_at", lastMonth).Error
+	if err != nil {
+		t.Fatalf("Failed to backdate deposits: %v", err)
+	}
+
+	oldTotals, err := service.GetPortfolioTotalFunds(&ctx, userReferenceID)
+	if err != nil {
+		t.Fatalf("GetPortfolioTotalFunds failed: %v", err)
+	}
+
+	// New month: the monthly plan should be topped up again before any equal split
+	if _, err := service.ProcessFunds(&ctx, userReferenceID, []money.Money{money.FromFloat(100.0)}, ""); err != nil {
+		t.Fatalf("ProcessFunds failed: %v", err)
+	}
+
+	newTotals, err := service.GetPortfolioTotalFunds(&ctx, userReferenceID)
+	if err != nil {
+		t.Fatalf("GetPortfolioTotalFunds failed: %v", err)
+	}
+
+	retirement := configs.DefaultPortfolioRetirement
+	highRisk := configs.DefaultPortfolioHighRisk
+	if newTotals[retirement]-oldTotals[retirement] != money.FromFloat(100.0) {
+		t.Errorf("❌ Expected monthly plan for '%s' to receive 100.00, got %s",
+			retirement, newTotals[retirement]-oldTotals[retirement])
+	} else if newTotals[highRisk] != oldTotals[highRisk] {
+		t.Errorf("❌ Expected '%s' to be unchanged, got %s (old: %s)", highRisk, newTotals[highRisk], oldTotals[highRisk])
+	} else {
+		t.Logf("✅ Monthly plan for '%s' topped up in new period", retirement)
+	}
+}
+
+func TestProcessFundsCash(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	service := newTestService(t)
+	userReferenceID := "user-cash"
+	if err := service.store.DB().WithContext(ctx).Create(&database.User{ReferenceID: userReferenceID}).Error; err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// No plans: every cent is kept as cash
+	if _, err := service.ProcessFunds(&ctx, userReferenceID, []money.Money{money.FromFloat(150.25)}, ""); err != nil {
+		t.Fatalf("ProcessFunds failed: %v", err)
+	}
+	cash, err := service.store.GetUserCash(&ctx, userReferenceID)
+	if err != nil {
+		t.Fatalf("GetUserCash failed: %v", err)
+	}
+	if cash != money.FromFloat(150.25) {
+		t.Fatalf("❌ Expected cash to be 150.25, got %s", cash)
+	}
+
+	// Adding a plan sweeps cash into it, up to the planned amount
+	_, err = service.AddDepositPlan(&ctx, userReferenceID, configs.DefaultPortfolioRetirement, configs.PlanTypeOnceTime, money.FromFloat(100.0))
+	if err != nil {
+		t.Fatalf("AddDepositPlan failed: %v", err)
+	}
+	// Topping up the plan sweeps the rest
+	_, err = service.UpdateDepositPlan(&ctx, userReferenceID, configs.DefaultPortfolioRetirement, configs.PlanTypeOnceTime, money.FromFloat(200.0))
+	if err != nil {
+		t.Fatalf("UpdateDepositPlan failed: %v", err)
+	}
+
+	cash, err = service.store.GetUserCash(&ctx, userReferenceID)
+	if err != nil {
+		t.Fatalf("GetUserCash failed: %v", err)
+	}
+	total, err := service.GetUserTotalFunds(&ctx, userReferenceID)
+	if err != nil {
+		t.Fatalf("GetUserTotalFunds failed: %v", err)
+	}
+	if cash != money.Zero || total != money.FromFloat(150.25) {
+		t.Errorf("❌ Expected all cash swept into plans, got cash %s and total funds %s", cash, total)
+	} else {
+		t.Logf("✅ Cash swept into plans: %s", total)
+	}
+}
+
+type failingStrategy struct{}
+
+func (failingStrategy) Type() configs.AllocationStrategyType {
+	return "failing"
+}
+
+func (failingStrategy) Allocate([]database.UserDepositPlan, strategies.Balances, money.Money) ([]strategies.Allocation, error) {
+	return nil, errors.New("allocation failed")
+}
+
+func TestTransactionStatus(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	service := newTestService(t)
+	userReferenceID := "user-123"
+	plans, err := service.store.GetUserDepositPlans(&ctx, userReferenceID)
+	if err != nil {
+		t.Fatalf("GetUserDepositPlans failed: %v", err)
+	}
+
+	var tests = []struct {
+		name        string
+		strategy    strategies.AllocationStrategy
+		status      configs.TransactionStatus
+		transitions []configs.TransactionStatus
+	}{
+		{"Test completed deposit", strategies.Waterfall{}, configs.TrxnStatusCompleted,
+			[]configs.TransactionStatus{configs.TrxnStatusProcessing, configs.TrxnStatusCompleted}},
+		{"Test failed deposit", failingStrategy{}, configs.TrxnStatusFailed,
+			[]configs.TransactionStatus{configs.TrxnStatusFailed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactions, err := service.store.CreateDepositTransactions(&ctx, userReferenceID, repositories.NewTransactionRequests([]money.Money{money.FromFloat(100.0)}))
+			if err != nil {
+				t.Fatalf("CreateDepositTransactions failed: %v", err)
+			}
+			_, err = service.store.DepositFunds(&ctx, transactions, plans, tt.strategy)
+			if (err != nil) != (tt.status == configs.TrxnStatusFailed) {
+				t.Fatalf("❌ Unexpected DepositFunds result: %v", err)
+			}
+
+			referenceID := transactions[0].ReferenceID
+			transaction, err := service.store.GetTransaction(&ctx, referenceID)
+			if err != nil {
+				t.Fatalf("GetTransaction failed: %v", err)
+			}
+			if transaction.Status != tt.status {
+				t.Errorf("❌ Expected status %s, got %s", tt.status, transaction.Status)
+			}
+			if tt.status == configs.TrxnStatusFailed && transaction.FailureReason == "" {
+				t.Errorf("❌ Expected failure reason to be recorded")
+			}
+
+			transitions, err := service.store.GetTransactionTransitions(&ctx, referenceID)
+			if err != nil {
+				t.Fatalf("GetTransactionTransitions failed: %v", err)
+			}
+			if len(transitions) != len(tt.transitions) {
+				t.Fatalf("❌ Expected %d transitions, got %d", len(tt.transitions), len(transitions))
+			}
+			for i, transition := range transitions {
+				if transition.To != tt.transitions[i] {
+					t.Errorf("❌ Expected transition %d to %s, got %s", i, tt.transitions[i], transition.To)
+				}
+			}
+
+			// Processed transactions can't be picked up again
+			_, err = service.store.UpdateTransactionStatus(&ctx, referenceID, configs.TrxnStatusProcessing, "")
+			if !errors.Is(err, repositories.ErrIllegalTransition) {
+				t.Errorf("❌ Expected illegal transition error, got %v", err)
+			} else {
+				t.Logf("✅ Transaction %s ended %s with transitions enforced", referenceID, transaction.Status)
+			}
+		})
+	}
+}
+
+func TestProcessDepositsIdempotency(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	service := newTestService(t)
+	userReferenceID := "user-123"
+	otherUserReferenceID := "user-idempotency"
+	if err := service.store.DB().WithContext(ctx).Create(&database.User{ReferenceID: otherUserReferenceID}).Error; err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	request := repositories.TransactionRequest{ReferenceID: "payment-42", Amount: money.FromFloat(120.0)}
+
+	original, err := service.ProcessDeposits(&ctx, userReferenceID, []repositories.TransactionRequest{request}, "")
+	if err != nil {
+		t.Fatalf("ProcessDeposits failed: %v", err)
+	}
+	initialTotal, err := service.GetUserTotalFunds(&ctx, userReferenceID)
+	if err != nil {
+		t.Fatalf("GetUserTotalFunds failed: %v", err)
+	}
+
+	var tests = []struct {
+		name     string
+		user     string
+		request  repositories.TransactionRequest
+		conflict bool
+	}{
+		{"Test replay returns original result", userReferenceID, request, false},
+		{"Test key reuse with different amount", userReferenceID,
+			repositories.TransactionRequest{ReferenceID: "payment-42", Amount: money.FromFloat(121.0)}, true},
+		{"Test key reuse by another user", otherUserReferenceID, request, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replay, err := service.ProcessDeposits(&ctx, tt.user, []repositories.TransactionRequest{tt.request}, "")
+			if tt.conflict {
+				if !errors.Is(err, repositories.ErrIdempotencyConflict) {
+					t.Fatalf("❌ Expected idempotency conflict, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessDeposits failed: %v", err)
+			}
+			if !replay.Transactions[0].Replayed {
+				t.Errorf("❌ Expected transaction to be replayed")
+			}
+			if !reflect.DeepEqual(replay.Transactions[0].Allocations, original.Transactions[0].Allocations) ||
+				replay.Transactions[0].Cash != original.Transactions[0].Cash {
+				t.Errorf("❌ Expected original allocations %v, got %v",
+					original.Transactions[0].Allocations, replay.Transactions[0].Allocations)
+			}
+		})
+	}
+
+	// Nothing was deposited twice
+	total, err := service.GetUserTotalFunds(&ctx, userReferenceID)
+	if err != nil {
+		t.Fatalf("GetUserTotalFunds failed: %v", err)
+	}
+	if total != initialTotal {
+		t.Errorf("❌ Expected total %s after replays, got %s", initialTotal, total)
+	} else {
+		t.Logf("✅ Replays left total at %s", total)
+	}
+}
+
+func TestCreateTransactionsRace(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	service := newTestService(t)
+	userReferenceID := "user-123"
+	requests := []repositories.TransactionRequest{{ReferenceID: "payment-race", Amount: money.FromFloat(50.0)}}
+	winner, err := service.store.CreateDepositTransactions(&ctx, userReferenceID, requests)
+	if err != nil {
+		t.Fatalf("CreateDepositTransactions failed: %v", err)
+	}
+
+	// The first lookup misses the winner's transaction, as if it was committed right after, so the insert collides
+	db := service.store.DB()
+	missed := false
+	err = db.Callback().Query().After("gorm:query").Register("test:miss_transaction", func(tx *gorm.DB) {
+		if tx.Statement.Table == "transactions" && !missed && tx.Statement.ReflectValue.Kind() == reflect.Slice {
+			missed = true
+			tx.Statement.ReflectValue.SetLen(0)
+			tx.RowsAffected = 0
+		}
+	})
+	if err != nil {
+		t.Fatalf("Failed to register callback: %v", err)
+	}
+	t.Cleanup(func() { db.Callback().Query().Remove("test:miss_transaction") })
+
+	loser, err := service.store.CreateDepositTransactions(&ctx, userReferenceID, requests)
+	if err != nil {
+		t.Fatalf("❌ Expected the losing request to replay, got %v", err)
+	}
+	if !missed || !loser[0].Replayed || loser[0].ID != winner[0].ID {
+		t.Errorf("❌ Expected replay of transaction %d after a missed lookup, got %+v", winner[0].ID, loser[0])
+	} else {
+		t.Logf("✅ Losing request replayed transaction %d", loser[0].ID)
+	}
+}
+
+// Conflicts on the first allocation only, like a concurrent update of the same funds
+type conflictingStrategy struct {
+	strategies.Waterfall
+	calls *int
+}
+
+func (s conflictingStrategy) Allocate(
+	plans []database.UserDepositPlan,
+	balances strategies.Balances,
+	amount money.Money,
+) ([]strategies.Allocation, error) {
+	*s.calls++
+	if *s.calls == 1 {
+		return nil, database.ErrConflict
+	}
+	return s.Waterfall.Allocate(plans, balances, amount)
+}
+
+func TestDepositFundsRetry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	service := newTestService(t)
+	userReferenceID := "user-123"
+	plans, err := service.store.GetUserDepositPlans(&ctx, userReferenceID)
+	if err != nil {
+		t.Fatalf("GetUserDepositPlans failed: %v", err)
+	}
+	transactions, err := service.store.CreateDepositTransactions(&ctx, userReferenceID,
+		repositories.NewTransactionRequests([]money.Money{money.FromFloat(100.0)}))
+	if err != nil {
+		t.Fatalf("CreateDepositTransactions failed: %v", err)
+	}
+
+	calls := 0
+	if _, err := service.store.DepositFunds(&ctx, transactions, plans, conflictingStrategy{calls: &calls}); err != nil {
+		t.Fatalf("❌ Expected DepositFunds to succeed on retry: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("❌ Expected allocation to run twice, got %d", calls)
+	}
+
+	// The rolled back attempt left nothing behind
+	allocations, cash, err := service.store.GetTransactionAllocations(&ctx, transactions[0].ReferenceID)
+	if err != nil {
+		t.Fatalf("GetTransactionAllocations failed: %v", err)
+	}
+	allocated := cash
+	for _, amount := range allocations {
+		allocated += amount
+	}
+	if allocated != transactions[0].Amount {
+		t.Errorf("❌ Expected %s allocated once, got %s", transactions[0].Amount, allocated)
+	} else {
+		t.Logf("✅ Allocated %s once after retry", allocated)
+	}
+}
+
+func TestProcessFundsConcurrency(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	service := newTestService(t)
+	// Fresh user, so totals only reflect this test's deposits
+	userReferenceID := "user-concurrent"
+	if err := service.store.DB().WithContext(ctx).Create(&database.User{ReferenceID: userReferenceID}).Error; err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	for _, plan := range []struct {
+		portfolio string
+		planType  configs.PlanType
+		amount    money.Money
+	}{
+		{configs.DefaultPortfolioRetirement, configs.PlanTypeOnceTime, money.FromFloat(150.0)},
+		{configs.DefaultPortfolioHighRisk, configs.PlanTypeMonthly, money.FromFloat(50.0)},
+	} {
+		if _, err := service.store.CreateUserDepositPlan(&ctx, userReferenceID, plan.portfolio, plan.planType, plan.amount); err != nil {
+			t.Fatalf("CreateUserDepositPlan failed: %v", err)
+		}
+	}
+
+	const workers = 25
+	amount := money.FromFloat(10.01)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.ProcessFunds(&ctx, userReferenceID, []money.Money{amount}, ""); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("❌ Concurrent ProcessFunds failed: %v", err)
+	}
+
+	// No deposit was lost or applied twice
+	total, err := service.GetUserTotalFunds(&ctx, userReferenceID)
+	if err != nil {
+		t.Fatalf("GetUserTotalFunds failed: %v", err)
+	}
+	cash, err := service.store.GetUserCash(&ctx, userReferenceID)
+	if err != nil {
+		t.Fatalf("GetUserCash failed: %v", err)
+	}
+	expected := amount * workers
+	if total+cash != expected {
+		t.Errorf("❌ Expected funds and cash to total %s, got %s (cash %s)", expected, total+cash, cash)
+	} else {
+		t.Logf("✅ %d concurrent deposits total %s", workers, total+cash)
+	}
+}
+
+func TestProcessDepositsInMemory(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// No database: deposits run on the in-memory repository
+	memory := repositories.NewMemoryRepository(configs.LoadAppConfigs(), nil)
+	userReferenceID := "user-memory"
+	if _, err := memory.CreatePortfolio(&ctx, configs.DefaultPortfolioRetirement, "Retirement"); err != nil {
+		t.Fatalf("CreatePortfolio failed: %v", err)
+	}
+	if _, err := memory.CreateUser(&ctx, userReferenceID); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	_, err := memory.CreateUserDepositPlan(&ctx, userReferenceID, configs.DefaultPortfolioRetirement,
+		configs.PlanTypeOnceTime, money.FromFloat(100.0))
+	if err != nil {
+		t.Fatalf("CreateUserDepositPlan failed: %v", err)
+	}
+	service := NewDepositService(memory)
+
+	var tests = []struct {
+		name     string
+		request  repositories.TransactionRequest
+		replayed bool
+		total    money.Money
+		cash     money.Money
+	}{
+		{"Test deposit beyond plan", repositories.TransactionRequest{ReferenceID: "payment-1", Amount: money.FromFloat(150.0)}, false,
+			money.FromFloat(100.0), money.FromFloat(50.0)},
+		{"Test replayed deposit", repositories.TransactionRequest{ReferenceID: "payment-1", Amount: money.FromFloat(150.0)}, true,
+			money.FromFloat(100.0), money.FromFloat(50.0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := service.ProcessDeposits(&ctx, userReferenceID, []repositories.TransactionRequest{tt.request}, "")
+			if err != nil {
+				t.Fatalf("ProcessDeposits failed: %v", err)
+			}
+			total, err := service.GetUserTotalFunds(&ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserTotalFunds failed: %v", err)
+			}
+
+			result := results.Transactions[0]
+			if result.Replayed != tt.replayed || result.Cash != tt.cash || total != tt.total {
+				t.Errorf("❌ Expected replayed %v, cash %s and total %s, got %v, %s and %s",
+					tt.replayed, tt.cash, tt.total, result.Replayed, result.Cash, total)
+			} else {
+				t.Logf("✅ Deposit %s ended %s with total %s", result.ReferenceID, result.Status, total)
+			}
+		})
+	}
+}
+
+func TestDepositServiceWithoutStore(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Operations beyond totals and deposits are refused, instead of dereferencing the missing store
+	service := NewDepositService(repositories.NewMemoryRepository(configs.LoadAppConfigs(), nil))
+	const userReferenceID = "user-memory"
+	now := time.Now()
+
+	var tests = []struct {
+		name string
+		run  func() error
+	}{
+		{"Test market values", func() error {
+			_, err := service.GetPortfolioMarketValues(&ctx, userReferenceID, now)
+			return err
+		}},
+		{"Test rebalance", func() error {
+			_, err := service.ProposeRebalance(&ctx, userReferenceID, -1)
+			return err
+		}},
+		{"Test withdrawals", func() error {
+			_, err := service.ProcessWithdrawals(&ctx, userReferenceID, "", []money.Money{money.FromFloat(10.0)})
+			return err
+		}},
+		{"Test cash sweep", func() error {
+			return service.sweepCash(&ctx, userReferenceID)
+		}},
+		{"Test returns", func() error {
+			_, err := service.GetReturns(&ctx, userReferenceID, now, now)
+			return err
+		}},
+		{"Test new deposit plan", func() error {
+			_, err := service.AddDepositPlan(&ctx, userReferenceID, configs.DefaultPortfolioRetirement, configs.PlanTypeMonthly, 100)
+			return err
+		}},
+		{"Test updated deposit plan", func() error {
+			_, err := service.UpdateDepositPlan(&ctx, userReferenceID, configs.DefaultPortfolioRetirement, configs.PlanTypeMonthly, 100)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(); !errors.Is(err, ErrStoreRequired) {
+				t.Errorf("❌ Expected store to be required, got %v", err)
+			} else {
+				t.Logf("✅ Refused: %v", err)
+			}
+		})
+	}
+}
+
+func TestProcessFundsTracing(t *testing.T) {
+	recorder := tracingtest.New(t)
+	service := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := service.ProcessFunds(&ctx, "user-123", []money.Money{money.FromFloat(100.0)}, ""); err != nil {
+		t.Fatalf("ProcessFunds failed: %v", err)
+	}
+	spans := tracingtest.Spans(recorder)
+
+	// Each span is a child of the one before it in the chain
+	var tests = []struct {
+		name   string
+		parent string
+	}{
+		{"services.ProcessDeposits", "services.ProcessFunds"},
+		{"repositories.CreateDepositTransactions", "services.ProcessDeposits"},
+		{"repositories.GetUserDepositPlans", "services.ProcessDeposits"},
+		{"repositories.DepositFunds", "services.ProcessDeposits"},
+		{"repositories.allocateFunds", "repositories.DepositFunds"},
+		{"insert allocation_decisions", "repositories.allocateFunds"},
+	}
+	for _, tt := range tests {
+		t.Run("Test "+tt.name+" span", func(t *testing.T) {
+			span, parent := spans[tt.name], spans[tt.parent]
+			if span == nil || parent == nil {
+				t.Fatalf("❌ Expected %s and %s spans, got %d spans", tt.name, tt.parent, len(spans))
+			}
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() || span.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+				t.Errorf("❌ Expected %s under %s", tt.name, tt.parent)
+			} else {
+				t.Logf("✅ %s under %s", tt.name, tt.parent)
+			}
+		})
+	}
+}
+
+func TestPreviewDeposit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	memory := repositories.NewMemoryRepository(configs.LoadAppConfigs(), nil)
+	userReferenceID := "user-preview"
+	if _, err := memory.CreatePortfolio(&ctx, configs.DefaultPortfolioRetirement, "Retirement"); err != nil {
+		t.Fatalf("CreatePortfolio failed: %v", err)
+	}
+	if _, err := memory.CreateUser(&ctx, userReferenceID); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	_, err := memory.CreateUserDepositPlan(&ctx, userReferenceID, configs.DefaultPortfolioRetirement,
+		configs.PlanTypeOnceTime, money.FromFloat(100.0))
+	if err != nil {
+		t.Fatalf("CreateUserDepositPlan failed: %v", err)
+	}
+	service := NewDepositService(memory)
+
+	var tests = []struct {
+		name   string
+		amount money.Money
+		steps  map[strategies.Step]money.Money
+		cash   money.Money
+	}{
+		{"Test preview within plan", money.FromFloat(40.0),
+			map[strategies.Step]money.Money{strategies.StepOneTime: money.FromFloat(40.0)}, 0},
+		{"Test preview beyond plan", money.FromFloat(150.0),
+			map[strategies.Step]money.Money{strategies.StepOneTime: money.FromFloat(100.0), strategies.StepRemainder: money.FromFloat(50.0)},
+			money.FromFloat(50.0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preview, err := service.PreviewDeposit(&ctx, userReferenceID, tt.amount, "")
+			if err != nil {
+				t.Fatalf("PreviewDeposit failed: %v", err)
+			}
+			total, err := service.GetUserTotalFunds(&ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserTotalFunds failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(preview.Steps, tt.steps) || preview.Cash != tt.cash || total != 0 {
+				t.Errorf("❌ Expected steps %v, cash %s and no funds, got %v, %s and %s", tt.steps, tt.cash, preview.Steps, preview.Cash, total)
+			} else if len(preview.Plans) != 1 || preview.Plans[0].Amount != tt.amount-tt.cash {
+				t.Errorf("❌ Expected one plan allocated %s, got %+v", tt.amount-tt.cash, preview.Plans)
+			} else {
+				t.Logf("✅ Preview of %s allocates %v with cash %s", tt.amount, preview.Portfolios, preview.Cash)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package strategies
+
+import (
+	"fmt"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+)
+
+// Fill plans one at a time in priority order ('one-time' before 'monthly', then plan order)
+// Each plan is topped up to its planned amount before the next receives anything;
+// 'monthly' plans are topped up to their planned amount for the current period.
+// Anything left once every plan is met is split pro-rata by planned amount.
+type Priority struct{}
+
+func (Priority) Type() configs.AllocationStrategyType {
+	return configs.AllocationStrategyPriority
+}
+
+func (Priority) Allocate(plans []database.UserDepositPlan, balances Balances, amount money.Money) ([]Allocation, error) {
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("%w to allocate %s", ErrNoPlans, amount)
+	}
+
+	oneTimePlans, monthlyPlans := separatePlans(plans)
+	ordered := append(oneTimePlans, monthlyPlans...)
+
+	// Portfolio funds count towards the first 'one-time' plans (in priority order) on that portfolio
+	available := make(Funds, len(balances.Funds))
+	for portfolioID, fund := range balances.Funds {
+		available[portfolioID] = fund
+	}
+
+	remainingFund := amount
+	var allocations []Allocation
+	for _, plan := range ordered {
+		var covered money.Money
+		if plan.Type == configs.PlanTypeMonthly {
+			covered = balances.Contributions[plan.ID]
+		} else {
+			covered = money.Min(available[plan.PortfolioID], plan.Amount)
+			available[plan.PortfolioID] -= covered
+		}
+
+		shortfall := plan.Amount - covered
+		allocated := money.Min(remainingFund, shortfall)
+		if allocated <= 0 {
+			continue
+		}
+		allocations = append(allocations, Allocation{
+			Plan: plan, Step: StepPriority, Amount: allocated, Weight: int64(shortfall), TotalWeight: int64(shortfall),
+		})
+		remainingFund -= allocated
+	}
+
+	if remainingFund > 0 {
+		allocations = append(allocations, splitByPlanAmount(ordered, remainingFund, StepProRata)...)
+	}
+
+	return allocations, nil
+}
@@ -0,0 +1,22 @@
+package strategies
+
+import (
+	"fmt"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+)
+
+// Split every deposit across all plans by planned amount, ignoring current funds
+type ProRata struct{}
+
+func (ProRata) Type() configs.AllocationStrategyType {
+	return configs.AllocationStrategyProRata
+}
+
+func (ProRata) Allocate(plans []database.UserDepositPlan, balances Balances, amount money.Money) ([]Allocation, error) {
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("%w to allocate %s", ErrNoPlans, amount)
+	}
+	return splitByPlanAmount(plans, amount, StepProRata), nil
+}
@@ -0,0 +1,156 @@
+package strategies
+
+import (
+	"errors"
+	"fmt"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+	"time"
+)
+
+var (
+	ErrUnknownStrategy = errors.New("unknown allocation strategy")
+	ErrNoPlans         = errors.New("no deposit plans")
+)
+
+type Step string
+
+const (
+	StepOneTime      Step = "one-time"
+	StepMonthly      Step = "monthly"
+	StepEqualSplit   Step = "equal-split"
+	StepProRata      Step = "pro-rata"
+	StepPriority     Step = "priority"
+	StepTargetWeight Step = "target-weight"
+	StepRemainder    Step = "remainder" // Left unallocated by the strategy, and credited to cash instead
+)
+
+// Amount allocated to a single deposit plan, and the step that allocated it
+// The step's amount is split across its plans by weight: the plan got Weight out of TotalWeight
+// Weights are proportions, not amounts, even when taken from amounts in cents (e.g. shortfalls)
+type Allocation struct {
+	Plan        database.UserDepositPlan
+	Step        Step
+	Amount      money.Money
+	Weight      int64
+	TotalWeight int64
+}
+
+// PUBLIC: Plan's share of the step's amount, from 0 to 1
+func (a Allocation) Ratio() float64 {
+	if a.TotalWeight == 0 {
+		return 0
+	}
+	return float64(a.Weight) / float64(a.TotalWeight)
+}
+
+// Current funds per portfolio => { PortfolioID : Fund }
+type Funds map[uint]money.Money
+
+// Contributions per plan within the plan's current period => { PlanID : Amount }
+type Contributions map[uint]money.Money
+
+// Current state a strategy allocates against
+type Balances struct {
+	Funds         Funds
+	Contributions Contributions
+}
+
+// Decides how a deposited amount is split across a user's deposit plans
+// Implementations must be pure: no persistence, no side effects
+type AllocationStrategy interface {
+	Type() configs.AllocationStrategyType
+	Allocate(plans []database.UserDepositPlan, balances Balances, amount money.Money) ([]Allocation, error)
+}
+
+// PUBLIC: Get allocation strategy by type. Empty type returns the default (waterfall) strategy
+func Get(strategyType configs.AllocationStrategyType) (AllocationStrategy, error) {
+	switch strategyType {
+	case "", configs.AllocationStrategyWaterfall:
+		return Waterfall{}, nil
+	case configs.AllocationStrategyProRata:
+		return ProRata{}, nil
+	case configs.AllocationStrategyPriority:
+		return Priority{}, nil
+	case configs.AllocationStrategyTargetWeight:
+		return TargetWeight{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStrategy, strategyType)
+	}
+}
+
+// PUBLIC: Start of the current period for a recurring plan type
+// Returns false for plan types without a period (e.g. 'one-time')
+func PeriodStart(planType configs.PlanType, now time.Time) (time.Time, bool) {
+	switch planType {
+	case configs.PlanTypeMonthly:
+		now = now.UTC()
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// PRIVATE: Separate plans into one-time and monthly
+func separatePlans(plans []database.UserDepositPlan) ([]database.UserDepositPlan, []database.UserDepositPlan) {
+	var oneTimePlans []database.UserDepositPlan
+	var monthlyPlans []database.UserDepositPlan
+	for _, plan := range plans {
+		switch plan.Type {
+		case configs.PlanTypeOnceTime:
+			oneTimePlans = append(oneTimePlans, plan)
+		case configs.PlanTypeMonthly:
+			monthlyPlans = append(monthlyPlans, plan)
+		}
+	}
+	return oneTimePlans, monthlyPlans
+}
+
+// PRIVATE: Remaining amount per plan to meet its planned amount within the current period
+func periodShortfalls(plans []database.UserDepositPlan, contributions Contributions) []money.Money {
+	shortfalls := make([]money.Money, len(plans))
+	for i, plan := range plans {
+		if shortfall := plan.Amount - contributions[plan.ID]; shortfall > 0 {
+			shortfalls[i] = shortfall
+		}
+	}
+	return shortfalls
+}
+
+// PRIVATE: Split amount across plans by planned amount, skipping zero allocations
+func splitByPlanAmount(plans []database.UserDepositPlan, amount money.Money, step Step) []Allocation {
+	weights := make([]money.Money, len(plans))
+	for i, plan := range plans {
+		weights[i] = plan.Amount
+	}
+	return splitByWeights(plans, weights, amount, step)
+}
+
+// PRIVATE: Split amount across plans by the given weights, skipping zero allocations
+func splitByWeights(plans []database.UserDepositPlan, weights []money.Money, amount money.Money, step Step) []Allocation {
+	// Weights as Split applies them: negatives count as zero, and all zero splits equally
+	applied := make([]money.Money, len(weights))
+	total := money.Zero
+	for i, weight := range weights {
+		applied[i] = max(weight, 0)
+		total += applied[i]
+	}
+	if total == 0 {
+		for i := range applied {
+			applied[i] = 1
+		}
+		total = money.Money(len(applied))
+	}
+
+	var allocations []Allocation
+	for i, share := range amount.Split(weights) {
+		if share <= 0 {
+			continue
+		}
+		allocations = append(allocations, Allocation{
+			Plan: plans[i], Step: step, Amount: share, Weight: int64(applied[i]), TotalWeight: int64(total),
+		})
+	}
+	return allocations
+}
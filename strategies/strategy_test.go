@@ -0,0 +1,116 @@
+package strategies
+
+import (
+	"errors"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func newPlan(id uint, planType configs.PlanType, portfolioID uint, amount float64) database.UserDepositPlan {
+	return database.UserDepositPlan{
+		Model:       gorm.Model{ID: id},
+		Type:        planType,
+		PortfolioID: portfolioID,
+		Portfolio:   database.Portfolio{Model: gorm.Model{ID: portfolioID}},
+		Amount:      money.FromFloat(amount),
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	// Retirement (1): one-time 500, monthly 100 | High Risk (2): one-time 10000, monthly 0
+	plans := []database.UserDepositPlan{
+		newPlan(1, configs.PlanTypeOnceTime, 1, 500.0),
+		newPlan(2, configs.PlanTypeMonthly, 1, 100.0),
+		newPlan(3, configs.PlanTypeOnceTime, 2, 10000.0),
+		newPlan(4, configs.PlanTypeMonthly, 2, 0.0),
+	}
+
+	var tests = []struct {
+		name     string
+		strategy configs.AllocationStrategyType
+		balances Balances
+		amount   float64
+		expected map[uint]float64 // PlanID => Amount
+	}{
+		{"Waterfall fills one-time plans first", configs.AllocationStrategyWaterfall, Balances{Funds: Funds{}},
+			10500.0, map[uint]float64{1: 500.0, 3: 10000.0}},
+		{"Waterfall fills monthly plans for the current period", configs.AllocationStrategyWaterfall,
+			Balances{Funds: Funds{1: money.FromFloat(600.0), 2: money.FromFloat(10000.0)}, Contributions: Contributions{2: money.FromFloat(40.0)}},
+			60.0, map[uint]float64{2: 60.0}},
+		{"Waterfall splits equally when all met", configs.AllocationStrategyWaterfall,
+			Balances{Funds: Funds{1: money.FromFloat(600.0), 2: money.FromFloat(10000.0)}, Contributions: Contributions{2: money.FromFloat(100.0)}},
+			100.0, map[uint]float64{1: 2.38, 3: 47.62, 2: 50.0}},
+		{"Pro-rata ignores current funds", configs.AllocationStrategyProRata, Balances{Funds: Funds{1: money.FromFloat(600.0)}},
+			106.0, map[uint]float64{1: 5.0, 2: 1.0, 3: 100.0}},
+		{"Priority fills plans in order", configs.AllocationStrategyPriority, Balances{Funds: Funds{1: money.FromFloat(200.0)}},
+			400.0, map[uint]float64{1: 300.0, 3: 100.0}},
+		{"Priority tops up monthly plans for the current period", configs.AllocationStrategyPriority,
+			Balances{Funds: Funds{1: money.FromFloat(500.0), 2: money.FromFloat(10000.0)}, Contributions: Contributions{2: money.FromFloat(75.0)}},
+			25.0, map[uint]float64{2: 25.0}},
+		{"Priority spreads leftover pro-rata", configs.AllocationStrategyPriority,
+			Balances{Funds: Funds{1: money.FromFloat(600.0), 2: money.FromFloat(10000.0)}, Contributions: Contributions{2: money.FromFloat(100.0)}},
+			106.0, map[uint]float64{1: 5.0, 2: 1.0, 3: 100.0}},
+		{"Target weight fills underweight portfolio", configs.AllocationStrategyTargetWeight, Balances{Funds: Funds{1: 0, 2: money.FromFloat(10000.0)}},
+			600.0, map[uint]float64{1: 500.0, 2: 100.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, err := Get(tt.strategy)
+			if err != nil {
+				t.Fatalf("❌ Get failed: %v", err)
+			}
+			allocations, err := strategy.Allocate(plans, tt.balances, money.FromFloat(tt.amount))
+			if err != nil {
+				t.Fatalf("❌ Allocate failed: %v", err)
+			}
+
+			results := make(map[uint]money.Money)
+			for _, allocation := range allocations {
+				results[allocation.Plan.ID] += allocation.Amount
+			}
+			if money.Sum(mapValues(results)...) != money.FromFloat(tt.amount) {
+				t.Errorf("❌ Expected allocations to sum to %.2f, got %v", tt.amount, results)
+			}
+			for planID, expected := range tt.expected {
+				if results[planID] != money.FromFloat(expected) {
+					t.Errorf("❌ Expected plan %d to get %.2f, got %s", planID, expected, results[planID])
+				}
+			}
+		})
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	now := time.Date(2025, time.March, 17, 15, 4, 5, 0, time.UTC)
+	if start, ok := PeriodStart(configs.PlanTypeMonthly, now); !ok || !start.Equal(time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("❌ Expected monthly period to start on 2025-03-01, got %v", start)
+	}
+	if _, ok := PeriodStart(configs.PlanTypeOnceTime, now); ok {
+		t.Errorf("❌ Expected one-time plans to have no period")
+	}
+}
+
+func TestGet(t *testing.T) {
+	if strategy, err := Get(""); err != nil || strategy.Type() != configs.AllocationStrategyWaterfall {
+		t.Errorf("❌ Expected default strategy to be waterfall, got %v (%v)", strategy, err)
+	}
+	if _, err := Get("unknown"); !errors.Is(err, ErrUnknownStrategy) {
+		t.Errorf("❌ Expected unknown strategy error, got %v", err)
+	}
+	if _, err := (Waterfall{}).Allocate(nil, Balances{}, 100); !errors.Is(err, ErrNoPlans) {
+		t.Errorf("❌ Expected no plans error, got %v", err)
+	}
+}
+
+func mapValues(values map[uint]money.Money) []money.Money {
+	result := make([]money.Money, 0, len(values))
+	for _, value := range values {
+		result = append(result, value)
+	}
+	return result
+}
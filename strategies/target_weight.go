@@ -0,0 +1,61 @@
+package strategies
+
+import (
+	"fmt"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+)
+
+// Fill underweight portfolios first, so that funds move towards target weights
+// Target weight of a portfolio is its share of the total planned amount across all plans.
+type TargetWeight struct{}
+
+func (TargetWeight) Type() configs.AllocationStrategyType {
+	return configs.AllocationStrategyTargetWeight
+}
+
+func (TargetWeight) Allocate(plans []database.UserDepositPlan, balances Balances, amount money.Money) ([]Allocation, error) {
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("%w to allocate %s", ErrNoPlans, amount)
+	}
+
+	// Group plans by portfolio, preserving first-seen order
+	var portfolioIDs []uint
+	portfolioPlans := make(map[uint][]database.UserDepositPlan)
+	for _, plan := range plans {
+		if _, exists := portfolioPlans[plan.PortfolioID]; !exists {
+			portfolioIDs = append(portfolioIDs, plan.PortfolioID)
+		}
+		portfolioPlans[plan.PortfolioID] = append(portfolioPlans[plan.PortfolioID], plan)
+	}
+
+	// Target amount per portfolio after this deposit
+	weights := make([]money.Money, len(portfolioIDs))
+	totalAfter := amount
+	for i, portfolioID := range portfolioIDs {
+		for _, plan := range portfolioPlans[portfolioID] {
+			weights[i] += plan.Amount
+		}
+		totalAfter += balances.Funds[portfolioID]
+	}
+	targets := totalAfter.Split(weights)
+
+	// Split the amount by how far each portfolio is below its target
+	deficits := make([]money.Money, len(portfolioIDs))
+	for i, portfolioID := range portfolioIDs {
+		if deficit := targets[i] - balances.Funds[portfolioID]; deficit > 0 {
+			deficits[i] = deficit
+		}
+	}
+
+	var allocations []Allocation
+	for i, portfolioAmount := range amount.Split(deficits) {
+		if portfolioAmount <= 0 {
+			continue
+		}
+		allocations = append(allocations, splitByPlanAmount(portfolioPlans[portfolioIDs[i]], portfolioAmount, StepTargetWeight)...)
+	}
+
+	return allocations, nil
+}
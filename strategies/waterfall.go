@@ -0,0 +1,67 @@
+package strategies
+
+import (
+	"fmt"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+)
+
+// Default strategy:
+// 1. First allocate funds to 'one-time' plan portfolios till planned amount is met
+// 2. Then allocate funds to 'monthly' plan portfolios till planned amount for the current month is met
+// 3. If both 'one-time' & 'monthly' planned amount are met, distribute funds equally to both
+type Waterfall struct{}
+
+func (Waterfall) Type() configs.AllocationStrategyType {
+	return configs.AllocationStrategyWaterfall
+}
+
+func (Waterfall) Allocate(plans []database.UserDepositPlan, balances Balances, amount money.Money) ([]Allocation, error) {
+	oneTimePlans, monthlyPlans := separatePlans(plans)
+	if len(monthlyPlans) == 0 && len(oneTimePlans) == 0 {
+		return nil, fmt.Errorf("%w to allocate %s", ErrNoPlans, amount)
+	}
+
+	// Get total current funds and total planned amounts for one-time plans
+	totalOneTimeFund, totalOneTimePlanAmount := money.Zero, money.Zero
+	for _, plan := range oneTimePlans {
+		totalOneTimePlanAmount += plan.Amount
+		totalOneTimeFund += balances.Funds[plan.PortfolioID]
+	}
+
+	// Monthly plans are met by contributions within the current month, not lifetime funds
+	monthlyShortfalls := periodShortfalls(monthlyPlans, balances.Contributions)
+
+	remainingFund := amount
+	var allocations []Allocation
+
+	// Step 1: Allocate to 'one-time' plans
+	remainingOneTimeAllocation := totalOneTimePlanAmount - totalOneTimeFund
+	oneTimeAllocation := money.Min(remainingFund, remainingOneTimeAllocation)
+	if oneTimeAllocation > 0 {
+		allocations = append(allocations, splitByPlanAmount(oneTimePlans, oneTimeAllocation, StepOneTime)...)
+		remainingFund -= oneTimeAllocation
+	}
+
+	// Step 2: Allocate to 'monthly' plans
+	remainingMonthlyAllocation := money.Sum(monthlyShortfalls...)
+	monthlyAllocation := money.Min(remainingFund, remainingMonthlyAllocation)
+	if monthlyAllocation > 0 {
+		allocations = append(allocations, splitByWeights(monthlyPlans, monthlyShortfalls, monthlyAllocation, StepMonthly)...)
+		remainingFund -= monthlyAllocation
+	}
+
+	// Step 3: Split remaining fund equally if both are fully funded
+	if remainingFund > 0 && remainingOneTimeAllocation <= 0 && remainingMonthlyAllocation <= 0 {
+		splitFund := remainingFund / 2
+		if len(oneTimePlans) > 0 {
+			allocations = append(allocations, splitByPlanAmount(oneTimePlans, splitFund, StepEqualSplit)...)
+		}
+		if len(monthlyPlans) > 0 {
+			allocations = append(allocations, splitByPlanAmount(monthlyPlans, remainingFund-splitFund, StepEqualSplit)...)
+		}
+	}
+
+	return allocations, nil
+}
@@ -0,0 +1,94 @@
+// OpenTelemetry tracing: a tracer provider exporting as configured, and spans started from *context.Context
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"portfolio-investment/configs"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the tracer the app's spans are started with
+const TracerName = "portfolio-investment"
+
+// Flushes and stops exporting spans
+type Shutdown func(ctx context.Context) error
+
+// PUBLIC: Set the global tracer provider exporting as configured, and the W3C trace context propagator
+// OTLP is configured by the standard OTEL_EXPORTER_OTLP_* environment variables, and the service name can be
+// overridden by OTEL_SERVICE_NAME. With no exporter, trace context is still propagated but nothing is recorded
+func Setup(ctx context.Context, config *configs.AppConfig, serviceName string) (Shutdown, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var file io.Closer
+	var err error
+	switch config.TraceExporter {
+	case configs.TraceExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case configs.TraceExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case configs.TraceExporterFile:
+		var f *os.File
+		f, err = os.OpenFile(config.TraceFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file %s: %w", config.TraceFile, err)
+		}
+		file = f
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	case configs.TraceExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported trace exporter: %s", config.TraceExporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", config.TraceExporter, err)
+	}
+
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceName(serviceName)),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// PUBLIC: Start a span, child of the one the context carries
+// Returns a pointer to a new context carrying the span, to pass down instead of ctx, so the caller's context is left as it was
+func Start(ctx *context.Context, name string, attributes ...attribute.KeyValue) (*context.Context, trace.Span) {
+	spanCtx, span := otel.Tracer(TracerName).Start(*ctx, name, trace.WithAttributes(attributes...))
+	return &spanCtx, span
+}
+
+// PUBLIC: End a span, recording the error it ended with, if any
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"portfolio-investment/configs"
+	"portfolio-investment/tracing/tracingtest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestSetup(t *testing.T) {
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	var tests = []struct {
+		name     string
+		exporter configs.TraceExporter
+		recorded bool
+	}{
+		{"Test no exporter records nothing", configs.TraceExporterNone, false},
+		{"Test file exporter appends spans", configs.TraceExporterFile, true},
+		{"Test unknown exporter refused", "zipkin", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			otel.SetTracerProvider(noop.NewTracerProvider())
+			file := filepath.Join(t.TempDir(), "traces.json")
+			shutdown, err := Setup(context.Background(), &configs.AppConfig{TraceExporter: tt.exporter, TraceFile: file}, "portfolio-test")
+			if tt.exporter == "zipkin" {
+				if err == nil {
+					t.Errorf("❌ Expected unknown exporter to be refused")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Setup failed: %v", err)
+			}
+
+			ctx := context.Background()
+			spanCtx, span := Start(&ctx, "services.ProcessFunds")
+			End(span, nil)
+			if err := shutdown(context.Background()); err != nil {
+				t.Fatalf("Shutdown failed: %v", err)
+			}
+
+			exported, _ := os.ReadFile(file)
+			recorded := strings.Contains(string(exported), `"Name":"services.ProcessFunds"`)
+			if recorded != tt.recorded || trace.SpanContextFromContext(*spanCtx).IsValid() != tt.recorded {
+				t.Errorf("❌ Expected span recorded: %v, got %s", tt.recorded, exported)
+			} else {
+				t.Logf("✅ Span recorded: %v", recorded)
+			}
+		})
+	}
+}
+
+func TestStart(t *testing.T) {
+	recorder := tracingtest.New(t)
+	ctx := context.Background()
+
+	spanCtx, span := Start(&ctx, "repositories.DepositFunds")
+	_, child := Start(spanCtx, "repositories.allocateFunds")
+	End(child, errors.New("allocation failed"))
+	End(span, nil)
+
+	spans := tracingtest.Spans(recorder)
+	parent, failed := spans["repositories.DepositFunds"], spans["repositories.allocateFunds"]
+	switch {
+	case trace.SpanContextFromContext(ctx).IsValid():
+		t.Errorf("❌ Expected caller's context left without the span")
+	case failed.Parent().SpanID() != parent.SpanContext().SpanID():
+		t.Errorf("❌ Expected child of the span carried by the new context, got parent %s", failed.Parent().SpanID())
+	case failed.Status().Code != codes.Error || parent.Status().Code != codes.Unset:
+		t.Errorf("❌ Expected only the failed span in error, got %v and %v", failed.Status(), parent.Status())
+	default:
+		t.Logf("✅ Spans nested and ended with their status")
+	}
+}
@@ -0,0 +1,38 @@
+// Spans recorded in memory for tests
+package tracingtest
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// PUBLIC: Record spans of the global tracer provider until the test ends, and propagate W3C trace context
+// Set up before opening the test database, as query tracing takes the global tracer provider when it is opened
+func New(t testing.TB) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+// PUBLIC: Ended spans by name, the last one recorded for a repeated name
+func Spans(recorder *tracetest.SpanRecorder) map[string]sdktrace.ReadOnlySpan {
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	return spans
+}
@@ -0,0 +1,186 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/logging"
+	"portfolio-investment/repositories"
+	"portfolio-investment/services"
+	"portfolio-investment/tracing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Recovers deposit transactions that were never processed (e.g. the process crashed after creating them)
+// or that failed, and runs them through DepositFunds with retries and backoff
+type DepositWorker struct {
+	ID            string
+	PollInterval  time.Duration
+	LeaseDuration time.Duration
+	PendingGrace  time.Duration
+	BatchSize     int
+	MaxAttempts   int
+	BackoffBase   time.Duration
+	BackoffMax    time.Duration
+
+	service *services.Service
+	store   *repositories.Store
+	logger  *slog.Logger
+}
+
+// PUBLIC: Build deposit worker on a service and its store, with settings from app config and a unique worker ID
+// Logs to the default slog logger, tagged with the worker ID
+func NewDepositWorker(config *configs.AppConfig, service *services.Service, store *repositories.Store) *DepositWorker {
+	hostname, _ := os.Hostname()
+	id := fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.New().String()[:8])
+	return &DepositWorker{
+		ID:            id,
+		PollInterval:  config.WorkerPollInterval,
+		LeaseDuration: config.WorkerLeaseDuration,
+		PendingGrace:  config.WorkerPendingGrace,
+		BatchSize:     config.WorkerBatchSize,
+		MaxAttempts:   config.WorkerMaxAttempts,
+		BackoffBase:   config.WorkerBackoffBase,
+		BackoffMax:    config.WorkerBackoffMax,
+		service:       service,
+		store:         store,
+		logger:        slog.Default().With("worker_id", id),
+	}
+}
+
+// PUBLIC: Poll and process due deposits until the context is cancelled
+func (w *DepositWorker) Run(ctx context.Context) {
+	w.logger.InfoContext(ctx, "Deposit worker started")
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		claimed, err := w.ProcessDue(&ctx)
+		if err != nil {
+			w.logger.ErrorContext(ctx, "Failed to claim due deposits", "error", err)
+		} else if claimed > 0 {
+			w.logger.InfoContext(ctx, "Processed due deposits", "transactions", claimed)
+		}
+
+		select {
+		case <-ctx.Done():
+			w.logger.InfoContext(ctx, "Deposit worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PUBLIC: Claim and process a single batch of due deposits
+// Returns the number of claimed transactions
+func (w *DepositWorker) ProcessDue(ctx *context.Context) (int, error) {
+	transactions, err := w.store.ClaimDueDeposits(ctx, w.ID, w.LeaseDuration, w.PendingGrace, w.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range transactions {
+		transactionCtx := logging.WithTransactionID(
+			logging.WithUserID(*ctx, transactions[i].User.ReferenceID), transactions[i].ReferenceID)
+		spanCtx, span := tracing.Start(&transactionCtx, "workers.ProcessDeposit",
+			attribute.String(logging.TransactionIDKey, transactions[i].ReferenceID), attribute.String("worker_id", w.ID))
+		err := w.process(spanCtx, &transactions[i])
+		if err != nil {
+			w.logger.WarnContext(*spanCtx, "Failed to process deposit", "error", err)
+		}
+		tracing.End(span, err)
+	}
+	return len(transactions), nil
+}
+
+// PUBLIC: Delay before the next attempt, doubling per attempt up to the maximum
+func (w *DepositWorker) Backoff(attempts int) time.Duration {
+	backoff := w.BackoffBase
+	for i := 1; i < attempts && backoff < w.BackoffMax; i++ {
+		backoff *= 2
+	}
+	return min(backoff, w.BackoffMax)
+}
+
+// PRIVATE: Process a claimed transaction, always releasing the lease
+func (w *DepositWorker) process(ctx *context.Context, transaction *database.Transaction) error {
+	var nextAttemptAt *time.Time
+	defer func() {
+		if err := w.store.ReleaseTransaction(ctx, transaction, w.ID, nextAttemptAt); err != nil {
+			w.logger.ErrorContext(*ctx, "Failed to release deposit", "error", err)
+		}
+	}()
+
+	// Failed transactions go back to pending before retrying, unless they are out of attempts
+	if transaction.Status == configs.TrxnStatusFailed {
+		if transaction.Attempts >= w.MaxAttempts {
+			return w.deadLetter(ctx, transaction)
+		}
+		retried, err := w.store.UpdateTransactionStatus(ctx, transaction.ReferenceID, configs.TrxnStatusPending,
+			fmt.Sprintf("retry attempt %d by %s", transaction.Attempts+1, w.ID))
+		if err != nil {
+			return err
+		}
+		*transaction = *retried
+	}
+
+	err := w.deposit(ctx, transaction)
+	if err == nil {
+		return nil
+	}
+
+	// Schedule retry with backoff, or give up
+	failed, getErr := w.store.GetTransaction(ctx, transaction.ReferenceID)
+	if getErr != nil {
+		return fmt.Errorf("%w (and failed to reload transaction: %v)", err, getErr)
+	}
+	*transaction = *failed
+	if transaction.Status != configs.TrxnStatusFailed {
+		return err
+	}
+	if transaction.Attempts >= w.MaxAttempts {
+		return w.deadLetter(ctx, transaction)
+	}
+	next := database.Now().Add(w.Backoff(transaction.Attempts))
+	nextAttemptAt = &next
+	return fmt.Errorf("attempt %d failed, retrying at %s: %w", transaction.Attempts, next.Format(time.RFC3339), err)
+}
+
+// PRIVATE: Deposit a pending transaction with the user's current plans and default strategy
+func (w *DepositWorker) deposit(ctx *context.Context, transaction *database.Transaction) error {
+	userReferenceID := transaction.User.ReferenceID
+
+	strategy, err := w.service.GetAllocationStrategy(ctx, userReferenceID, "")
+	if err == nil {
+		var plans []database.UserDepositPlan
+		plans, err = w.store.GetUserDepositPlans(ctx, userReferenceID)
+		if err == nil {
+			_, err = w.store.DepositFunds(ctx, []database.Transaction{*transaction}, plans, strategy)
+			return err // DepositFunds marks the transaction failed itself
+		}
+	}
+
+	// Couldn't start processing: record the failed attempt
+	_, failErr := w.store.UpdateTransactionStatus(ctx, transaction.ReferenceID, configs.TrxnStatusFailed, err.Error())
+	if failErr != nil {
+		return fmt.Errorf("%w (and failed to mark transaction failed: %v)", err, failErr)
+	}
+	return err
+}
+
+// PRIVATE: Move a permanently failing transaction to the dead-letter state
+func (w *DepositWorker) deadLetter(ctx *context.Context, transaction *database.Transaction) error {
+	reason := fmt.Sprintf("gave up after %d attempts: %s", transaction.Attempts, transaction.FailureReason)
+	deadLettered, err := w.store.UpdateTransactionStatus(ctx, transaction.ReferenceID, configs.TrxnStatusDeadLetter, reason)
+	if err != nil {
+		return err
+	}
+	*transaction = *deadLettered
+	return fmt.Errorf("moved to %s: %s", configs.TrxnStatusDeadLetter, reason)
+}
@@ -0,0 +1,166 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/database/dbtest"
+	"portfolio-investment/money"
+	"portfolio-investment/repositories"
+	"portfolio-investment/services"
+	"testing"
+	"time"
+)
+
+// Worker on its own store; workers built on the same store share its database
+func newTestWorker(id string, store *repositories.Store) *DepositWorker {
+	return &DepositWorker{
+		ID:            id,
+		PollInterval:  10 * time.Millisecond,
+		LeaseDuration: time.Minute,
+		PendingGrace:  0,
+		BatchSize:     10,
+		MaxAttempts:   3,
+		BackoffBase:   0,
+		BackoffMax:    0,
+		service:       services.NewService(store),
+		store:         store,
+		logger:        slog.Default().With("worker_id", id),
+	}
+}
+
+// Store on a fresh seeded database, private to the test
+func newTestStore(t *testing.T) *repositories.Store {
+	db, config := dbtest.New(t)
+	return repositories.NewStore(db, config, nil)
+}
+
+func TestDepositWorkerRecoversPending(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store := newTestStore(t)
+	service := services.NewService(store)
+	userReferenceID := "user-123"
+	oldTotal, err := service.GetUserTotalFunds(&ctx, userReferenceID)
+	if err != nil {
+		t.Fatalf("GetUserTotalFunds failed: %v", err)
+	}
+
+	// Simulate a crash between creating and processing the transactions
+	amounts := []money.Money{money.FromFloat(100.0), money.FromFloat(250.50)}
+	transactions, err := store.CreateDepositTransactions(&ctx, userReferenceID, repositories.NewTransactionRequests(amounts))
+	if err != nil {
+		t.Fatalf("CreateDepositTransactions failed: %v", err)
+	}
+
+	// A claimed transaction is leased to its worker only
+	workerA, workerB := newTestWorker("worker-a", store), newTestWorker("worker-b", store)
+	claimed, err := store.ClaimDueDeposits(&ctx, workerA.ID, workerA.LeaseDuration, workerA.PendingGrace, workerA.BatchSize)
+	if err != nil || len(claimed) != len(transactions) {
+		t.Fatalf("❌ Expected worker A to claim %d transactions, got %d (%v)", len(transactions), len(claimed), err)
+	}
+	if count, err := workerB.ProcessDue(&ctx); err != nil || count != 0 {
+		t.Fatalf("❌ Expected worker B to claim nothing while leased, got %d (%v)", count, err)
+	}
+
+	// Once worker A lets go (e.g. its lease expires), worker B recovers them
+	for i := range claimed {
+		if err := store.ReleaseTransaction(&ctx, &claimed[i], workerA.ID, nil); err != nil {
+			t.Fatalf("ReleaseTransaction failed: %v", err)
+		}
+	}
+	if count, err := workerB.ProcessDue(&ctx); err != nil || count != len(transactions) {
+		t.Fatalf("❌ Expected worker B to process %d transactions, got %d (%v)", len(transactions), count, err)
+	}
+	if count, err := workerA.ProcessDue(&ctx); err != nil || count != 0 {
+		t.Fatalf("❌ Expected nothing left to claim, got %d (%v)", count, err)
+	}
+
+	for _, transaction := range transactions {
+		processed, err := store.GetTransaction(&ctx, transaction.ReferenceID)
+		if err != nil {
+			t.Fatalf("GetTransaction failed: %v", err)
+		}
+		if processed.Status != configs.TrxnStatusCompleted && processed.Status != configs.TrxnStatusPartiallyAllocated {
+			t.Errorf("❌ Expected transaction %s to be processed, got %s", processed.ReferenceID, processed.Status)
+		}
+		if processed.LeaseOwner != "" {
+			t.Errorf("❌ Expected lease on %s to be released, still held by %s", processed.ReferenceID, processed.LeaseOwner)
+		}
+	}
+
+	newTotal, err := service.GetUserTotalFunds(&ctx, userReferenceID)
+	if err != nil {
+		t.Fatalf("GetUserTotalFunds failed: %v", err)
+	}
+	cash, err := store.GetUserCash(&ctx, userReferenceID)
+	if err != nil {
+		t.Fatalf("GetUserCash failed: %v", err)
+	}
+	if newTotal-oldTotal+cash != money.Sum(amounts...) {
+		t.Errorf("❌ Expected %s to be deposited exactly once, got %s", money.Sum(amounts...), newTotal-oldTotal+cash)
+	} else {
+		t.Logf("✅ Pending deposits processed exactly once")
+	}
+}
+
+func TestDepositWorkerDeadLetters(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store := newTestStore(t)
+	// A plan whose user portfolio has gone missing can never be deposited to
+	userReferenceID := "user-broken"
+	if err := store.DB().WithContext(ctx).Create(&database.User{ReferenceID: userReferenceID}).Error; err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	plan, err := store.CreateUserDepositPlan(&ctx, userReferenceID, configs.DefaultPortfolioRetirement,
+		configs.PlanTypeOnceTime, money.FromFloat(100.0))
+	if err != nil {
+		t.Fatalf("CreateUserDepositPlan failed: %v", err)
+	}
+	err = store.DB().WithContext(ctx).Where(&database.UserPortfolio{UserID: plan.UserID}).Delete(&database.UserPortfolio{}).Error
+	if err != nil {
+		t.Fatalf("Failed to delete user portfolio: %v", err)
+	}
+
+	transactions, err := store.CreateDepositTransactions(&ctx, userReferenceID, repositories.NewTransactionRequests([]money.Money{money.FromFloat(50.0)}))
+	if err != nil {
+		t.Fatalf("CreateDepositTransactions failed: %v", err)
+	}
+
+	worker := newTestWorker("worker-dead-letter", store)
+	for i := 0; i < worker.MaxAttempts; i++ {
+		if _, err := worker.ProcessDue(&ctx); err != nil {
+			t.Fatalf("ProcessDue failed: %v", err)
+		}
+	}
+
+	transaction, err := store.GetTransaction(&ctx, transactions[0].ReferenceID)
+	if err != nil {
+		t.Fatalf("GetTransaction failed: %v", err)
+	}
+	if transaction.Status != configs.TrxnStatusDeadLetter || transaction.Attempts != worker.MaxAttempts {
+		t.Errorf("❌ Expected %s after %d attempts, got %s after %d",
+			configs.TrxnStatusDeadLetter, worker.MaxAttempts, transaction.Status, transaction.Attempts)
+	} else {
+		t.Logf("✅ Transaction dead-lettered: %s", transaction.FailureReason)
+	}
+
+	// Dead-lettered transactions are no longer picked up
+	if claimed, err := worker.ProcessDue(&ctx); err != nil || claimed != 0 {
+		t.Errorf("❌ Expected nothing to claim, got %d (%v)", claimed, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	worker := &DepositWorker{BackoffBase: time.Second, BackoffMax: 10 * time.Second}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}
+	for i, backoff := range expected {
+		if result := worker.Backoff(i + 1); result != backoff {
+			t.Errorf("❌ Expected backoff %s for attempt %d, got %s", backoff, i+1, result)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"portfolio-investment/configs"
+	"portfolio-investment/repositories"
+	"time"
+)
+
+// Reconciles every user's funds on a schedule, reporting discrepancies and, if enabled, repairing them
+type ReconciliationJob struct {
+	Interval time.Duration
+	Repair   bool
+
+	store  *repositories.Store
+	logger *slog.Logger
+}
+
+// PUBLIC: Build reconciliation job on a store, with settings from app config
+// Logs to the default slog logger
+func NewReconciliationJob(config *configs.AppConfig, store *repositories.Store) *ReconciliationJob {
+	return &ReconciliationJob{
+		Interval: config.ReconcileInterval,
+		Repair:   config.ReconcileRepair,
+		store:    store,
+		logger:   slog.Default().With("job", "reconciliation"),
+	}
+}
+
+// PUBLIC: Reconcile on every interval until the context is cancelled, starting right away
+func (j *ReconciliationJob) Run(ctx context.Context) {
+	j.logger.InfoContext(ctx, "Reconciliation job started", "interval", j.Interval, "repair", j.Repair)
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	for {
+		j.RunOnce(&ctx)
+
+		select {
+		case <-ctx.Done():
+			j.logger.InfoContext(ctx, "Reconciliation job stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PUBLIC: Reconcile every user's funds once
+func (j *ReconciliationJob) RunOnce(ctx *context.Context) (*repositories.ReconciliationReport, error) {
+	report, err := j.store.Reconcile(ctx, "", j.Repair)
+	if err != nil {
+		j.logger.ErrorContext(*ctx, "Failed to reconcile", "error", err)
+		return nil, err
+	}
+
+	level := slog.LevelInfo
+	if len(report.Discrepancies) > 0 {
+		level = slog.LevelWarn
+	}
+	j.logger.Log(*ctx, level, "Reconciled funds", "user_portfolios", report.UserPortfolios, "user_cash", report.UserCash,
+		"transactions", report.Transactions, "discrepancies", len(report.Discrepancies))
+	return report, nil
+}
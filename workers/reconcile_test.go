@@ -0,0 +1,53 @@
+package workers
+
+import (
+	"context"
+	"portfolio-investment/configs"
+	"portfolio-investment/database"
+	"portfolio-investment/money"
+	"portfolio-investment/services"
+	"testing"
+	"time"
+)
+
+func TestReconciliationJob(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store := newTestStore(t)
+	service := services.NewService(store)
+	userReferenceID := "user-123"
+	if _, err := service.ProcessFunds(&ctx, userReferenceID, []money.Money{money.FromFloat(100.0)}, ""); err != nil {
+		t.Fatalf("ProcessFunds failed: %v", err)
+	}
+	store.DB().Model(&database.UserPortfolio{}).Where("fund_cents > 0").Update("fund_cents", money.FromFloat(1000.0))
+
+	var tests = []struct {
+		name          string
+		repair        bool
+		discrepancies int
+		total         money.Money
+	}{
+		{"Test report only", false, 2, money.FromFloat(2000.0)},
+		{"Test repair", true, 2, money.FromFloat(100.0)},
+		{"Test repaired", false, 0, money.FromFloat(100.0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := NewReconciliationJob(&configs.AppConfig{ReconcileInterval: time.Hour, ReconcileRepair: tt.repair}, store)
+			report, err := job.RunOnce(&ctx)
+			if err != nil {
+				t.Fatalf("RunOnce failed: %v", err)
+			}
+			total, err := service.GetUserTotalFunds(&ctx, userReferenceID)
+			if err != nil {
+				t.Fatalf("GetUserTotalFunds failed: %v", err)
+			}
+			if len(report.Discrepancies) != tt.discrepancies || total != tt.total {
+				t.Errorf("❌ Expected %d discrepancies and total %s, got %+v and %s", tt.discrepancies, tt.total, report.Discrepancies, total)
+			} else {
+				t.Logf("✅ %d discrepancies, total %s", len(report.Discrepancies), total)
+			}
+		})
+	}
+}